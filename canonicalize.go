@@ -0,0 +1,143 @@
+package maps
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+// CanonicalizeOptions are options for the Canonicalize function.
+type CanonicalizeOptions struct {
+	NormalizeOptions
+
+	// Sort the elements of slices.  See SortSlices.
+	SortSlices bool
+
+	// Round floats to this many decimal places.  Negative values disable rounding.
+	// See RoundFloats.
+	RoundFloatPlaces int
+}
+
+// CanonicalizeOptionFunc is a function which modifies CanonicalizeOptions.  It
+// implements NormalizeOption, so it can be passed to Canonicalize along with
+// other NormalizeOptions.
+type CanonicalizeOptionFunc func(*CanonicalizeOptions)
+
+// Apply implements NormalizeOption.  It does nothing: CanonicalizeOptionFuncs only
+// apply to Canonicalize.
+func (f CanonicalizeOptionFunc) Apply(*NormalizeOptions) {}
+
+// SortSlices causes Canonicalize to sort the elements of every slice, so slices
+// with the same elements in different orders canonicalize identically.  Elements
+// are ordered by their JSON encoding.
+//
+// Only Canonicalize sorts slices.  Other functions which accept NormalizeOptions, like
+// Normalize, ignore this option.
+func SortSlices() NormalizeOption {
+	return CanonicalizeOptionFunc(func(options *CanonicalizeOptions) {
+		options.SortSlices = true
+	})
+}
+
+// RoundFloats causes Canonicalize to round all numbers to the given number of
+// decimal places, so numbers which differ by less than the precision canonicalize
+// identically.  Numbers which are already more precise than float64 can represent at
+// that many places, like 1e300, or any number with more than 308 places, are unchanged.
+//
+// Only Canonicalize rounds numbers.  Other functions which accept NormalizeOptions, like
+// Normalize, ignore this option.
+func RoundFloats(places int) NormalizeOption {
+	return CanonicalizeOptionFunc(func(options *CanonicalizeOptions) {
+		options.RoundFloatPlaces = places
+	})
+}
+
+// Canonicalize normalizes v, then rewrites it into a canonical form, according to the
+// options.  Two values which are equivalent under those options canonicalize to trees which
+// are deeply equal, so they can be compared with reflect.DeepEqual, or used as cache keys
+// after marshaling, without repeating the normalization:
+//
+//	c1, _ := Canonicalize(v1, SortSlices(), RoundFloats(3))
+//	c2, _ := Canonicalize(v2, SortSlices(), RoundFloats(3))
+//	reflect.DeepEqual(c1, c2)
+//
+// opts may include NormalizeOptions, which default to Copy, Marshal, and Deep, and
+// CanonicalizeOptions, like SortSlices and RoundFloats.  v is not modified.
+func Canonicalize(v interface{}, opts ...NormalizeOption) (interface{}, error) {
+	o := CanonicalizeOptions{
+		NormalizeOptions: NormalizeOptions{
+			Copy:    true,
+			Marshal: true,
+			Deep:    true,
+		},
+		RoundFloatPlaces: -1,
+	}
+	for _, opt := range opts {
+		if co, ok := opt.(CanonicalizeOptionFunc); ok {
+			co(&o)
+		} else {
+			opt.Apply(&o.NormalizeOptions)
+		}
+	}
+	v, err := normalize(v, &o.NormalizeOptions)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalize(v, &o)
+}
+
+// canonicalize rewrites the normalized value v in place.
+func canonicalize(v interface{}, opts *CanonicalizeOptions) (interface{}, error) {
+	var err error
+	switch t := v.(type) {
+	case float64:
+		if opts.RoundFloatPlaces >= 0 {
+			p := math.Pow10(opts.RoundFloatPlaces)
+			scaled := t * p
+			if math.IsInf(scaled, 0) || math.IsNaN(scaled) {
+				// p overflowed, or t is too large to have a fractional part at
+				// this precision, so there's nothing to round
+				return t, nil
+			}
+			// adding 0 turns -0 into 0
+			return math.Round(scaled)/p + 0, nil
+		}
+	case map[string]interface{}:
+		for key, value := range t {
+			if t[key], err = canonicalize(value, opts); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			if t[i], err = canonicalize(value, opts); err != nil {
+				return nil, err
+			}
+		}
+		if opts.SortSlices && len(t) > 1 {
+			// elements are already canonical, so their encodings are too
+			keys := make([][]byte, len(t))
+			for i, value := range t {
+				if keys[i], err = json.Marshal(value); err != nil {
+					return nil, err
+				}
+			}
+			sort.Sort(byKeys{keys: keys, s: t})
+		}
+	}
+	return v, nil
+}
+
+// byKeys sorts a slice by a parallel slice of sort keys.
+type byKeys struct {
+	keys [][]byte
+	s    []interface{}
+}
+
+func (b byKeys) Len() int           { return len(b.s) }
+func (b byKeys) Less(i, j int) bool { return bytes.Compare(b.keys[i], b.keys[j]) < 0 }
+func (b byKeys) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.s[i], b.s[j] = b.s[j], b.s[i]
+}
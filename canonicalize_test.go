@@ -0,0 +1,103 @@
+package maps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name   string
+		v1, v2 interface{}
+		opts   []NormalizeOption
+	}{
+		{
+			name: "struct and map",
+			v1:   Widget{Size: 1, Color: "red"},
+			v2:   dict{"color": "red", "size": 1},
+		},
+		{
+			name: "sorted slices",
+			v1:   dict{"tags": []string{"red", "green", "blue"}},
+			v2:   dict{"tags": []interface{}{"blue", "red", "green"}},
+			opts: []NormalizeOption{SortSlices()},
+		},
+		{
+			name: "nested sorted slices",
+			v1:   []interface{}{dict{"tags": []int{3, 1, 2}, "name": "a"}, dict{"name": "b"}},
+			v2:   []interface{}{dict{"name": "b"}, dict{"name": "a", "tags": []int{1, 2, 3}}},
+			opts: []NormalizeOption{SortSlices()},
+		},
+		{
+			name: "mixed types",
+			v1:   []interface{}{"a", 1, true, nil, dict{"a": 1}, []int{1}},
+			v2:   []interface{}{[]int{1}, dict{"a": 1}, nil, true, 1, "a"},
+			opts: []NormalizeOption{SortSlices()},
+		},
+		{
+			name: "rounded floats",
+			v1:   dict{"x": 1.23449, "y": []float64{0.1 + 0.2}},
+			v2:   dict{"x": 1.2341, "y": []float64{0.3}},
+			opts: []NormalizeOption{RoundFloats(3)},
+		},
+		{
+			name: "negative zero",
+			v1:   dict{"x": -0.0001},
+			v2:   dict{"x": 0},
+			opts: []NormalizeOption{RoundFloats(2)},
+		},
+		{
+			name: "rounding before sorting",
+			v1:   []float64{2.0001, 1.0001},
+			v2:   []float64{1, 2},
+			opts: []NormalizeOption{RoundFloats(2), SortSlices()},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c1, err := Canonicalize(test.v1, test.opts...)
+			require.NoError(t, err)
+			c2, err := Canonicalize(test.v2, test.opts...)
+			require.NoError(t, err)
+			assert.True(t, reflect.DeepEqual(c1, c2), "c1: %#v\nc2: %#v", c1, c2)
+		})
+	}
+
+	// without options, order and precision matter
+	c1, err := Canonicalize([]int{1, 2})
+	require.NoError(t, err)
+	c2, err := Canonicalize([]int{2, 1})
+	require.NoError(t, err)
+	assert.False(t, reflect.DeepEqual(c1, c2))
+
+	c1, err = Canonicalize(1.0001, RoundFloats(4))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0001, c1)
+
+	// v is not modified
+	v := dict{"tags": []interface{}{"b", "a"}, "x": 1.23456}
+	_, err = Canonicalize(v, SortSlices(), RoundFloats(1))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"tags": []interface{}{"b", "a"}, "x": 1.23456}, v)
+
+	// precision beyond what float64 can represent leaves numbers unchanged
+	for _, places := range []int{308, 400, math.MaxInt32} {
+		c1, err = Canonicalize([]interface{}{1.5, 1e300, -2.25}, RoundFloats(places))
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{1.5, 1e300, -2.25}, c1, "places: %v", places)
+	}
+	c1, err = Canonicalize(1e300, RoundFloats(10))
+	require.NoError(t, err)
+	assert.Equal(t, 1e300, c1)
+
+	// other functions ignore canonicalize options
+	n, err := Normalize([]interface{}{2.25, 1.0}, SortSlices(), RoundFloats(0))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{2.25, 1.0}, n)
+
+	_, err = Canonicalize(dict{"color": make(chan string)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package maps
+
+import (
+	"reflect"
+)
+
+// Comparer performs Contains and Equivalent comparisons with a fixed set of options,
+// and caches the normalized form of the v1 values.  When the same large value is
+// compared against many others, this avoids normalizing it again for each comparison:
+//
+//	c := NewComparer(ParseTimes())
+//	for _, v2 := range patterns {
+//	  if c.Contains(bigValue, v2) { ... }
+//	}
+//
+// Values are cached by pointer identity, so only maps, slices, and pointers are cached.
+// Other values, like structs, are normalized on each call, as usual.  Since the
+// cache doesn't know when a value changes, callers must not modify a v1 value after
+// comparing it, or the comparer will keep using the stale, normalized form.  Call Reset
+// to clear the cache.
+//
+// The cache holds references to the v1 values, so they won't be garbage collected until
+// the Comparer is.
+//
+// A Comparer is not safe for concurrent use.
+type Comparer struct {
+	opts      []ContainsOption
+	normalize NormalizeOptions
+	cache     map[comparerKey]Normalized
+}
+
+type comparerKey struct {
+	typ reflect.Type
+	ptr uintptr
+	len int
+}
+
+// NewComparer returns a new Comparer, which will use opts for all its comparisons.
+func NewComparer(opts ...ContainsOption) *Comparer {
+	// capture any normalization options set by opts, like ParseTimes
+	ctx := newCtx()
+	for _, o := range opts {
+		o(ctx)
+	}
+	nopts := ctx.NormalizeOptions
+	ctx.release()
+
+	nopts.Copy = true
+	nopts.Marshal = true
+	nopts.Deep = true
+
+	return &Comparer{
+		opts:      opts,
+		normalize: nopts,
+		cache:     map[comparerKey]Normalized{},
+	}
+}
+
+// Contains is the same as the Contains function, using the Comparer's options
+// and cache.
+func (c *Comparer) Contains(v1, v2 interface{}) bool {
+	return Contains(c.normalized(v1), v2, c.opts...)
+}
+
+// ContainsMatch is the same as the ContainsMatch function, using the Comparer's options
+// and cache.
+func (c *Comparer) ContainsMatch(v1, v2 interface{}) Match {
+	return ContainsMatch(c.normalized(v1), v2, c.opts...)
+}
+
+// Equivalent is the same as the Equivalent function, using the Comparer's options
+// and cache.
+func (c *Comparer) Equivalent(v1, v2 interface{}) bool {
+	return Equivalent(c.normalized(v1), v2, c.opts...)
+}
+
+// EquivalentMatch is the same as the EquivalentMatch function, using the Comparer's options
+// and cache.
+func (c *Comparer) EquivalentMatch(v1, v2 interface{}) Match {
+	return EquivalentMatch(c.normalized(v1), v2, c.opts...)
+}
+
+// Reset clears the cache.
+func (c *Comparer) Reset() {
+	c.cache = map[comparerKey]Normalized{}
+}
+
+// normalized returns the cached, normalized form of v.  If v can't be cached,
+// or can't be normalized, v is returned, and the comparison functions will normalize
+// it (and report any errors) as usual.
+func (c *Comparer) normalized(v interface{}) interface{} {
+	if _, ok := v.(Normalized); ok {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	var key comparerKey
+	switch rv.Kind() {
+	case reflect.Map, reflect.Ptr:
+		if rv.IsNil() {
+			return v
+		}
+		key = comparerKey{typ: rv.Type(), ptr: rv.Pointer()}
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v
+		}
+		key = comparerKey{typ: rv.Type(), ptr: rv.Pointer(), len: rv.Len()}
+	default:
+		return v
+	}
+	if n, ok := c.cache[key]; ok {
+		return n
+	}
+	nv, err := normalize(v, &c.normalize)
+	if err != nil {
+		return v
+	}
+	n := Normalized{v: nv}
+	c.cache[key] = n
+	return n
+}
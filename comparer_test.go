@@ -0,0 +1,73 @@
+package maps
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestComparer(t *testing.T) {
+	c := NewComparer()
+
+	v1 := dict{"widget": &Widget{Size: 1, Color: "red"}, "tags": []string{"red", "green"}}
+	assert.True(t, c.Contains(v1, dict{"widget": dict{"color": "red"}}))
+	assert.False(t, c.Contains(v1, dict{"widget": dict{"color": "blue"}}))
+	assert.True(t, c.Equivalent(v1, dict{"widget": dict{"size": 1, "color": "red"}, "tags": []string{"green", "red"}}))
+	assert.Len(t, c.cache, 1)
+
+	m := c.ContainsMatch(v1, dict{"tags": []string{"blue"}})
+	assert.False(t, m.Matches)
+	assert.Equal(t, "tags", m.Path)
+	assert.False(t, c.EquivalentMatch(v1, dict{}).Matches)
+	assert.Len(t, c.cache, 1)
+
+	// the cached form is used, so changes to v1 aren't seen until Reset
+	v1["tags"] = []string{"blue"}
+	assert.True(t, c.Contains(v1, dict{"tags": []string{"red"}}))
+	c.Reset()
+	assert.False(t, c.Contains(v1, dict{"tags": []string{"red"}}))
+
+	// the cache normalizes without modifying v1
+	assert.Equal(t, &Widget{Size: 1, Color: "red"}, v1["widget"])
+
+	// slices are keyed by length too
+	s := []int{1, 2, 3}
+	assert.True(t, c.Equivalent(s, []int{1, 2, 3}))
+	assert.True(t, c.Equivalent(s[:2], []int{1, 2}))
+
+	// values which can't be cached work as usual
+	assert.True(t, c.Contains(Widget{Size: 1}, dict{"size": 1}))
+	assert.True(t, c.Contains("red", "red"))
+	assert.True(t, c.Contains(nil, nil))
+	assert.False(t, c.Contains(dict{"color": make(chan string)}, dict{"color": "red"}))
+
+	// options are applied, including normalization options
+	tm := time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC)
+	c = NewComparer(ParseTimes(), IgnoreTimeZones(true))
+	v1 = dict{"createdAt": tm}
+	assert.True(t, c.Contains(v1, dict{"createdAt": tm.In(time.FixedZone("test", -5*60*60))}))
+	assert.False(t, c.Contains(v1, dict{"createdAt": tm.Add(time.Hour)}))
+}
+
+func BenchmarkComparer(b *testing.B) {
+	v1 := json.RawMessage(largeTestVal1)
+	v2 := []dict{
+		{"principal": dict{"cust": dict{"groups": []string{"CCKM Users"}}}},
+		{"principal": dict{"cust": dict{"groups": []string{"blue"}}}},
+		{"environment": dict{"obligations": dict{"blue": dict{"details": dict{"color": "blue"}}}}},
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Contains(v1, v2[i%len(v2)])
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		c := NewComparer()
+		for i := 0; i < b.N; i++ {
+			c.Contains(v1, v2[i%len(v2)])
+		}
+	})
+}
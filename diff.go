@@ -0,0 +1,111 @@
+package maps
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Change is a difference between two values, reported by Diff.
+type Change struct {
+	// Path to the changed value, in the syntax ParsePath understands, so
+	// it can be passed to Get.  The root is "".
+	Path string
+	// Op is "add", "remove", or "replace".
+	Op string
+	// OldValue is the value in v1.  It's nil for adds.
+	OldValue interface{}
+	// NewValue is the value in v2.  It's nil for removes.
+	NewValue interface{}
+}
+
+// Diff returns the changes needed to turn v1 into v2.  Both values are normalized, with
+// opts, first.  Maps and slices are compared recursively, and each difference is reported
+// at the deepest path it occurs:
+//
+//   - Keys only in v2 are reported as "add", with NewValue.
+//   - Keys only in v1 are reported as "remove", with OldValue.
+//   - Other values which aren't equal are reported as "replace", with both values.  If
+//     a value changes type, like from a map to a string, the whole value is replaced.
+//
+// Slices are compared by position: elements at the same index are compared, and elements
+// past the end of the shorter slice are added or removed.  So inserting an element at the
+// start of a slice replaces every element.
+//
+// The changes are sorted by map key and slice index, so the result is deterministic.  If the
+// values are equal, the result is empty.
+func Diff(v1, v2 interface{}, opts ...NormalizeOption) ([]Change, error) {
+	o := NormalizeOptions{
+		Copy:    true,
+		Marshal: true,
+		Deep:    true,
+	}
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+	v1, err := normalize(v1, &o)
+	if err != nil {
+		return nil, err
+	}
+	v2, err = normalize(v2, &o)
+	if err != nil {
+		return nil, err
+	}
+	return diff(v1, v2, nil, nil), nil
+}
+
+// diff appends the changes between normalized values v1 and v2 to changes.  path is the
+// path to both values.
+func diff(v1, v2 interface{}, path Path, changes []Change) []Change {
+	switch t1 := v1.(type) {
+	case map[string]interface{}:
+		t2, ok := v2.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(t1)+len(t2))
+		for key := range t1 {
+			keys = append(keys, key)
+		}
+		for key := range t2 {
+			if _, present := t1[key]; !present {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keyPath := append(path[:len(path):len(path)], key)
+			val1, in1 := t1[key]
+			val2, in2 := t2[key]
+			switch {
+			case !in2:
+				changes = append(changes, Change{Path: keyPath.String(), Op: "remove", OldValue: val1})
+			case !in1:
+				changes = append(changes, Change{Path: keyPath.String(), Op: "add", NewValue: val2})
+			default:
+				changes = diff(val1, val2, keyPath, changes)
+			}
+		}
+		return changes
+	case []interface{}:
+		t2, ok := v2.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(t1) || i < len(t2); i++ {
+			idxPath := append(path[:len(path):len(path)], i)
+			switch {
+			case i >= len(t2):
+				changes = append(changes, Change{Path: idxPath.String(), Op: "remove", OldValue: t1[i]})
+			case i >= len(t1):
+				changes = append(changes, Change{Path: idxPath.String(), Op: "add", NewValue: t2[i]})
+			default:
+				changes = diff(t1[i], t2[i], idxPath, changes)
+			}
+		}
+		return changes
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		changes = append(changes, Change{Path: path.String(), Op: "replace", OldValue: v1, NewValue: v2})
+	}
+	return changes
+}
@@ -0,0 +1,104 @@
+package maps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		v1, v2   interface{}
+		expected []Change
+	}{
+		{name: "equal", v1: dict{"a": 1, "b": []int{1}}, v2: dict{"a": 1.0, "b": []float64{1}}, expected: []Change{}},
+		{name: "scalars", v1: 1, v2: 2, expected: []Change{{Path: "", Op: "replace", OldValue: 1.0, NewValue: 2.0}}},
+		{
+			name: "maps",
+			v1:   dict{"a": 1, "b": 2, "d": dict{"x": "y"}},
+			v2:   dict{"b": 3, "c": 4, "d": dict{"x": "z"}},
+			expected: []Change{
+				{Path: "a", Op: "remove", OldValue: 1.0},
+				{Path: "b", Op: "replace", OldValue: 2.0, NewValue: 3.0},
+				{Path: "c", Op: "add", NewValue: 4.0},
+				{Path: "d.x", Op: "replace", OldValue: "y", NewValue: "z"},
+			},
+		},
+		{
+			name: "slices",
+			v1:   dict{"tags": []interface{}{"a", "b", dict{"c": 1}}},
+			v2:   dict{"tags": []interface{}{"a", "x", dict{"c": 2}, "d", "e"}},
+			expected: []Change{
+				{Path: "tags[1]", Op: "replace", OldValue: "b", NewValue: "x"},
+				{Path: "tags[2].c", Op: "replace", OldValue: 1.0, NewValue: 2.0},
+				{Path: "tags[3]", Op: "add", NewValue: "d"},
+				{Path: "tags[4]", Op: "add", NewValue: "e"},
+			},
+		},
+		{
+			name: "shorter slice",
+			v1:   []int{1, 2, 3},
+			v2:   []int{1},
+			expected: []Change{
+				{Path: "[1]", Op: "remove", OldValue: 2.0},
+				{Path: "[2]", Op: "remove", OldValue: 3.0},
+			},
+		},
+		{
+			name: "type change",
+			v1:   dict{"a": dict{"b": 1}},
+			v2:   dict{"a": []int{1}},
+			expected: []Change{
+				{Path: "a", Op: "replace", OldValue: dict{"b": 1.0}, NewValue: []interface{}{1.0}},
+			},
+		},
+		{
+			name: "escaped keys",
+			v1:   dict{"my.key": 1},
+			v2:   dict{"my.key": 2},
+			expected: []Change{
+				{Path: `my\.key`, Op: "replace", OldValue: 1.0, NewValue: 2.0},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := Diff(test.v1, test.v2)
+			require.NoError(t, err)
+			if len(test.expected) == 0 {
+				assert.Empty(t, changes)
+				return
+			}
+			assert.Equal(t, test.expected, changes)
+
+			// the paths can be used with Get
+			for _, change := range changes {
+				if change.Op != "add" {
+					v, err := Get(test.v1, change.Path)
+					require.NoError(t, err)
+					n, _ := Normalize(v)
+					assert.Equal(t, change.OldValue, n)
+				}
+			}
+		})
+	}
+
+	t.Run("options", func(t *testing.T) {
+		tm := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+		changes, err := Diff(dict{"t": tm}, dict{"t": tm.Add(time.Second)}, NormalizeTime(true))
+		require.NoError(t, err)
+		assert.Equal(t, []Change{{Path: "t", Op: "replace", OldValue: tm, NewValue: tm.Add(time.Second)}}, changes)
+	})
+
+	_, err := Diff(dict{"a": make(chan int)}, dict{})
+	assert.Error(t, err)
+
+	// v1 and v2 aren't modified
+	v1, v2 := dict{"a": 1, "b": []interface{}{2}}, dict{"a": 3}
+	_, err = Diff(v1, v2)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"a": 1, "b": []interface{}{2}}, v1)
+	assert.Equal(t, dict{"a": 3}, v2)
+}
@@ -0,0 +1,312 @@
+package maps
+
+import (
+	"github.com/ansel1/merry"
+	"strconv"
+	"strings"
+)
+
+// Flatten converts v into a flat map, with an entry for each leaf value in v.  The
+// keys are the paths to the leaves, in the syntax ParsePath understands, so they can
+// be passed to Get, and the map can be converted back to a tree with Unflatten:
+//
+//	Flatten({"a":{"b":[1,2]},"c":"red"}) // {"a.b[0]":1, "a.b[1]":2, "c":"red"}
+//
+// Keys which contain dots or brackets are escaped, like Path.String().
+//
+// v is normalized first, with the options, which default to Marshal.  Empty maps and
+// slices are leaves, so they aren't lost.  time.Time values are leaves if the
+// NormalizeTime option is set.  If v is itself a leaf, the result has a single entry,
+// with an empty key.
+//
+// opts may also include FlattenOptions, like FlattenSeparator and SlicesAsLeaves.
+func Flatten(v interface{}, opts ...NormalizeOption) (map[string]interface{}, error) {
+	o := FlattenOptions{
+		NormalizeOptions: NormalizeOptions{Marshal: true},
+		Separator:        ".",
+	}
+	for _, opt := range opts {
+		if fo, ok := opt.(FlattenOptionFunc); ok {
+			fo(&o)
+		} else {
+			opt.Apply(&o.NormalizeOptions)
+		}
+	}
+	o.Copy = false
+	o.Deep = false
+
+	f := flattener{opts: &o, out: map[string]interface{}{}}
+	if err := f.flatten(v, nil); err != nil {
+		return nil, err
+	}
+	return f.out, nil
+}
+
+// FlattenOptions are options for the Flatten function.
+type FlattenOptions struct {
+	NormalizeOptions
+
+	// Separator between keys.  Defaults to ".".  See FlattenSeparator.
+	Separator string
+
+	// Treat slices as leaves, rather than flattening them.  See SlicesAsLeaves.
+	SlicesAsLeaves bool
+}
+
+// FlattenOptionFunc is a function which modifies FlattenOptions.  It
+// implements NormalizeOption, so it can be passed to Flatten along with
+// other NormalizeOptions.
+type FlattenOptionFunc func(*FlattenOptions)
+
+// Apply implements NormalizeOption.  It does nothing: FlattenOptionFuncs only
+// apply to Flatten.
+func (f FlattenOptionFunc) Apply(*NormalizeOptions) {}
+
+// FlattenSeparator sets the separator Flatten puts between keys, like "_" for
+// "a_b[0]".  With a separator other than ".", keys aren't escaped, and can't be
+// parsed by ParsePath or Unflatten.  If keys collide, Flatten returns an error:
+// with "_", {"a_b":1} and {"a":{"b":1}} would both flatten to "a_b".
+func FlattenSeparator(sep string) NormalizeOption {
+	return FlattenOptionFunc(func(options *FlattenOptions) {
+		options.Separator = sep
+	})
+}
+
+// SlicesAsLeaves causes Flatten to treat slices as leaves, so the values in the
+// flattened map may be slices:
+//
+//	Flatten({"a":{"b":[1,2]}}, SlicesAsLeaves()) // {"a.b":[1,2]}
+func SlicesAsLeaves() NormalizeOption {
+	return FlattenOptionFunc(func(options *FlattenOptions) {
+		options.SlicesAsLeaves = true
+	})
+}
+
+// flattener adds the leaves of a value to out.
+type flattener struct {
+	opts *FlattenOptions
+	// compare is true when flattening for FlattenBeforeCompare.  Slices are leaves, but
+	// maps within them are flattened, and keys are not escaped.
+	compare bool
+	out     map[string]interface{}
+}
+
+func (f *flattener) flatten(v interface{}, path Path) error {
+	if _, ok := v.(matcher); ok {
+		return f.add(path, v)
+	}
+	v, err := normalize(v, &f.opts.NormalizeOptions)
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			break
+		}
+		for key, value := range t {
+			if err := f.flatten(value, append(path[:len(path):len(path)], key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(t) == 0 {
+			break
+		}
+		if f.compare {
+			s := make([]interface{}, len(t))
+			for i, value := range t {
+				if s[i], err = f.flattenElement(value); err != nil {
+					return err
+				}
+			}
+			v = s
+			break
+		}
+		if f.opts.SlicesAsLeaves {
+			// the slice is a value in the result, so normalize its contents too
+			opts := f.opts.NormalizeOptions
+			opts.Deep = true
+			if v, err = normalize(t, &opts); err != nil {
+				return err
+			}
+			break
+		}
+		for i, value := range t {
+			if err := f.flatten(value, append(path[:len(path):len(path)], i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return f.add(path, v)
+}
+
+// flattenElement flattens maps inside slices, for FlattenBeforeCompare.
+func (f *flattener) flattenElement(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return v, nil
+	}
+	inner := flattener{opts: f.opts, compare: f.compare, out: map[string]interface{}{}}
+	if err := inner.flatten(v, nil); err != nil {
+		return nil, err
+	}
+	if leaf, ok := inner.out[""]; ok && len(inner.out) == 1 {
+		// v was a leaf, like an empty map
+		return leaf, nil
+	}
+	return inner.out, nil
+}
+
+func (f *flattener) add(path Path, v interface{}) error {
+	var key string
+	if !f.compare && f.opts.Separator == "." {
+		key = path.String()
+	} else {
+		key = joinKeys(path, f.opts.Separator)
+	}
+	if _, present := f.out[key]; present {
+		return merry.Errorf("flattened key collision at %v", key)
+	}
+	f.out[key] = v
+	return nil
+}
+
+// joinKeys joins the elements of path with sep.  Unlike Path.String(), keys are
+// not escaped, so with ".", keys which contain dots look like nested keys.
+func joinKeys(path Path, sep string) string {
+	var sb strings.Builder
+	for _, elem := range path {
+		switch t := elem.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteString(sep)
+			}
+			sb.WriteString(t)
+		case int:
+			sb.WriteString("[")
+			sb.WriteString(strconv.Itoa(t))
+			sb.WriteString("]")
+		}
+	}
+	return sb.String()
+}
+
+// UnflattenConflictError indicates two keys passed to Unflatten conflict, like
+// "a" and "a.b", or "a[0]" and "a.b".
+var UnflattenConflictError = merry.New("Conflicting flattened keys")
+
+// Unflatten is the inverse of Flatten.  It parses each key in m with ParsePath, and
+// builds a tree of nested maps and slices with the values at those paths:
+//
+//	Unflatten({"a.b[0]":1, "a.b[1]":2, "c":"red"}) // {"a":{"b":[1,2]},"c":"red"}
+//
+// Slices grow as needed, and elements with no key are nil.  The empty key sets the
+// root value.  Keys may only contain map keys and non-negative slice indexes.
+//
+// If keys conflict, like "a" and "a.b", or "a[0]" and "a.b", Unflatten returns
+// UnflattenConflictError, rather than letting one value clobber the other.  The
+// values in m are not copied.
+func Unflatten(m map[string]interface{}) (interface{}, error) {
+	root := &unflattenNode{}
+	for _, key := range sortedKeys(m) {
+		path, err := ParsePath(key)
+		if err != nil {
+			return nil, merry.Prependf(err, "invalid key %q", key)
+		}
+		if err := root.set(key, path, m[key]); err != nil {
+			return nil, err
+		}
+	}
+	if len(m) == 0 {
+		return map[string]interface{}{}, nil
+	}
+	return root.value(), nil
+}
+
+// unflattenNode is a node in the tree Unflatten is building.  It is either a
+// leaf, or a map, or a slice.
+type unflattenNode struct {
+	isLeaf bool
+	leaf   interface{}
+	// key is the flattened key which set the leaf, or first created the map or slice
+	key   string
+	keys  map[string]*unflattenNode
+	elems []*unflattenNode
+}
+
+func (n *unflattenNode) set(key string, path Path, v interface{}) error {
+	for _, elem := range path {
+		switch t := elem.(type) {
+		case string:
+			if err := n.checkKind(key, n.elems != nil); err != nil {
+				return err
+			}
+			if n.keys == nil {
+				n.keys, n.key = map[string]*unflattenNode{}, key
+			}
+			child := n.keys[t]
+			if child == nil {
+				child = &unflattenNode{}
+				n.keys[t] = child
+			}
+			n = child
+		case int:
+			if t < 0 {
+				return merry.Errorf("invalid key %q: negative index %v", key, t)
+			}
+			if err := n.checkKind(key, n.keys != nil); err != nil {
+				return err
+			}
+			if n.elems == nil {
+				n.key = key
+			}
+			for len(n.elems) <= t {
+				n.elems = append(n.elems, nil)
+			}
+			if n.elems[t] == nil {
+				n.elems[t] = &unflattenNode{}
+			}
+			n = n.elems[t]
+		default:
+			return merry.Errorf("invalid key %q: only map keys and slice indexes are supported", key)
+		}
+	}
+	if n.isLeaf || n.keys != nil || n.elems != nil {
+		return UnflattenConflictError.Here().WithMessagef("keys %q and %q conflict", n.key, key)
+	}
+	n.isLeaf, n.leaf, n.key = true, v, key
+	return nil
+}
+
+// checkKind returns an error if n is a leaf, or is already the other kind of container.
+func (n *unflattenNode) checkKind(key string, otherKind bool) error {
+	if n.isLeaf || otherKind {
+		return UnflattenConflictError.Here().WithMessagef("keys %q and %q conflict", n.key, key)
+	}
+	return nil
+}
+
+func (n *unflattenNode) value() interface{} {
+	switch {
+	case n == nil:
+		return nil
+	case n.keys != nil:
+		m := make(map[string]interface{}, len(n.keys))
+		for k, child := range n.keys {
+			m[k] = child.value()
+		}
+		return m
+	case n.elems != nil:
+		s := make([]interface{}, len(n.elems))
+		for i, child := range n.elems {
+			s[i] = child.value()
+		}
+		return s
+	default:
+		return n.leaf
+	}
+}
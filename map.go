@@ -8,17 +8,23 @@ package maps
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ansel1/merry"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"io"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,6 +36,44 @@ func Keys(m map[string]interface{}) (keys []string) {
 	return keys
 }
 
+// KeysSorted returns a slice of the keys in the map, sorted.
+func KeysSorted(m map[string]interface{}) []string {
+	keys := Keys(m)
+	sort.Strings(keys)
+	return keys
+}
+
+// Values returns a slice of the values in the map, in no particular order.
+func Values(m map[string]interface{}) (values []interface{}) {
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Entry is a key and value from a map.  See Entries.
+type Entry struct {
+	Key   string
+	Value interface{}
+}
+
+// Entries returns a slice of the keys and values in the map, in no particular order.
+func Entries(m map[string]interface{}) (entries []Entry) {
+	for key, value := range m {
+		entries = append(entries, Entry{Key: key, Value: value})
+	}
+	return entries
+}
+
+// EntriesSorted returns a slice of the keys and values in the map, sorted by key.
+func EntriesSorted(m map[string]interface{}) []Entry {
+	entries := Entries(m)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
 // Merge returns a new map, which is the deep merge of the
 // normalized values of v1 and v2.
 //
@@ -41,123 +85,924 @@ func Keys(m map[string]interface{}) (keys []string) {
 //
 //	[5, 6, 7] + [5, 5, 5, 4] = [5, 6, 7, 4]
 //
+// The SliceIdentity option changes how slice elements are matched, and the
+// SliceReplace option replaces v1's slices with v2's instead.  The ConflictResolver
+// option customizes which value wins when v1 and v2's values can't be merged.
+//
 // The return value is a copy.  v1 and v2 are not modified.
+//
+// opts may include NormalizeOptions, and MergeOptions, like SliceIdentity.
+// If v1 or v2 can't be normalized, or the MaxMergeNodes limit is exceeded, Merge
+// returns nil, which looks the same as merging two nils.  Callers which need to tell a
+// failed or truncated merge from a nil result should use MergeWithError, which returns
+// the error, or MergeTooLargeError when the limit is exceeded.
 func Merge(v1, v2 interface{}, opts ...NormalizeOption) interface{} {
+	v, _ := MergeWithError(v1, v2, opts...)
+	return v
+}
+
+// MergeWithError is like Merge, but returns an error if v1 or v2 can't be
+// normalized, or MergeTooLargeError if the MaxMergeNodes limit is exceeded.
+func MergeWithError(v1, v2 interface{}, opts ...NormalizeOption) (interface{}, error) {
+	o := newMergeOptions(opts)
+	v1, err := normalize(v1, &o.NormalizeOptions)
+	if err != nil {
+		return nil, err
+	}
+	v2, err = normalize(v2, &o.NormalizeOptions)
+	if err != nil {
+		return nil, err
+	}
+	o.nodes = countNodes(v1, o.MaxNodes)
+	v := merge(v1, v2, &o)
+	if o.tooLarge() {
+		return nil, MergeTooLargeError.Here().WithMessagef("merge exceeded %d nodes", o.MaxNodes)
+	}
+	return v, nil
+}
+
+// MergeAll merges all the values together, left to right, like Merge.  Later values
+// override earlier ones:
+//
+//	MergeAll(defaults, site, user) // user's values override site's, which override defaults
+//
+// It's equivalent to calling Merge repeatedly, but each value is only normalized once,
+// and the result is merged in place, rather than copied at each step.  MergeAll with
+// no values returns nil, and with one value returns a normalized copy of it.
+func MergeAll(vs ...interface{}) interface{} {
+	return MergeAllWithOptions(vs)
+}
+
+// MergeAllWithOptions is like MergeAll, but with options.  opts may include
+// NormalizeOptions and MergeOptions, like Merge.  If the MaxMergeNodes limit is
+// exceeded, it returns nil.
+func MergeAllWithOptions(vs []interface{}, opts ...NormalizeOption) interface{} {
+	if len(vs) == 0 {
+		return nil
+	}
+	o := newMergeOptions(opts)
+	v, _ := normalize(vs[0], &o.NormalizeOptions)
+	o.nodes = countNodes(v, o.MaxNodes)
+	for _, v2 := range vs[1:] {
+		v2, _ = normalize(v2, &o.NormalizeOptions)
+		v = merge(v, v2, &o)
+		if o.tooLarge() {
+			break
+		}
+	}
+	if o.tooLarge() {
+		return nil
+	}
+	return v
+}
+
+// MergeJSONStream decodes a stream of JSON documents from r, like concatenated or
+// newline-delimited JSON, and merges them together, left to right, as with Merge.  Each
+// document is merged into the result as it is decoded, so the documents aren't all held
+// in memory at once:
+//
+//	r := strings.NewReader(`{"color":"red","size":1} {"size":2}`)
+//	MergeJSONStream(r) // {"color":"red","size":2}
+//
+// opts may include NormalizeOptions and MergeOptions, like Merge.  If a document can't
+// be decoded, the error includes the index of the document in the stream, starting
+// at 0.  An empty stream returns nil.  If the result exceeds the MaxMergeNodes limit,
+// MergeJSONStream stops reading and returns MergeTooLargeError.
+func MergeJSONStream(r io.Reader, opts ...NormalizeOption) (interface{}, error) {
+	o := newMergeOptions(opts)
+	// decoded values are not shared with anything else, so there's no need to copy them
+	o.Copy = false
+
+	dec := json.NewDecoder(r)
+	var result interface{}
+	for i := 0; ; i++ {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, merry.Prependf(err, "error decoding document %d", i)
+		}
+		if v, err = normalize(v, &o.NormalizeOptions); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			// nothing to merge with yet
+			result = v
+			o.nodes = countNodes(result, o.MaxNodes)
+		} else {
+			result = merge(result, v, &o)
+		}
+		if o.tooLarge() {
+			return nil, MergeTooLargeError.Here().WithMessagef("merging document %d exceeded %d nodes", i, o.MaxNodes)
+		}
+	}
+}
+
+func newMergeOptions(opts []NormalizeOption) MergeOptions {
+	o := MergeOptions{
+		NormalizeOptions: NormalizeOptions{
+			Copy:    true,
+			Marshal: true,
+			Deep:    true,
+		},
+	}
+	for _, opt := range opts {
+		if mo, ok := opt.(MergeOptionFunc); ok {
+			mo(&o)
+		} else {
+			opt.Apply(&o.NormalizeOptions)
+		}
+	}
+	return o
+}
+
+// MergeOptions are options for the Merge function.
+type MergeOptions struct {
+	NormalizeOptions
+
+	// Computes the identity of slice elements.  See SliceIdentity.
+	SliceIdentity func(elem interface{}) interface{}
+
+	// Maximum number of nodes in the result.  See MaxMergeNodes.
+	MaxNodes int
+
+	// Replace slices instead of merging them.  See SliceReplace.
+	ReplaceSlices bool
+
+	// Chooses the merged value when v2 would replace a v1 value.  See ConflictResolver.
+	ResolveConflict func(path string, v1, v2 interface{}) interface{}
+
+	nodes int      // number of nodes in the result so far, if MaxNodes is set
+	path  []string // path to the value being merged, if ResolveConflict is set
+}
+
+// MergeTooLargeError indicates the result of a merge would exceed the MaxMergeNodes limit.
+var MergeTooLargeError = merry.New("Merge result too large")
+
+// MergeOptionFunc is a function which modifies MergeOptions.  It
+// implements NormalizeOption, so it can be passed to Merge along with
+// other NormalizeOptions.
+type MergeOptionFunc func(*MergeOptions)
+
+// Apply implements NormalizeOption.  It does nothing: MergeOptionFuncs only
+// apply to Merge.
+func (f MergeOptionFunc) Apply(*NormalizeOptions) {}
+
+// SliceIdentity configures how Merge matches up the elements of slices.  identity
+// is called with each normalized slice element, and returns the element's identity.
+// When merging slices, v2 elements with the same identity as a v1 element are merged
+// into that element recursively.  Other v2 elements are appended.  Identities are
+// compared with reflect.DeepEqual.
+//
+// For example, to merge lists of objects by a composite key:
+//
+//	byNameAndZone := SliceIdentity(func(elem interface{}) interface{} {
+//	  m, ok := elem.(map[string]interface{})
+//	  if !ok {
+//	    return nil
+//	  }
+//	  return [2]interface{}{m["name"], m["zone"]}
+//	})
+//	Merge(v1, v2, byNameAndZone)
+//
+// If identity returns nil, the element has no identity, and is merged the default
+// way: it's appended unless v1 already has an equal element.
+func SliceIdentity(identity func(elem interface{}) interface{}) NormalizeOption {
+	return MergeOptionFunc(func(options *MergeOptions) {
+		options.SliceIdentity = identity
+	})
+}
+
+// MergeByKey configures Merge to match up slice elements which are maps by the value of
+// field, like SliceIdentity.  Maps with the same value for field are merged recursively.
+// Elements which aren't maps, or don't have the field, are merged the default way.  For
+// example, merging lists of resources by name:
+//
+//	v1 := {"containers":[{"name":"web","image":"web:1"},{"name":"log","image":"log:1"}]}
+//	v2 := {"containers":[{"name":"web","image":"web:2"},{"name":"db","image":"db:1"}]}
+//	Merge(v1, v2, MergeByKey("name"))
+//	// {"containers":[{"name":"web","image":"web:2"},{"name":"log","image":"log:1"},{"name":"db","image":"db:1"}]}
+func MergeByKey(field string) NormalizeOption {
+	return SliceIdentity(func(elem interface{}) interface{} {
+		if m, ok := elem.(map[string]interface{}); ok {
+			return m[field]
+		}
+		return nil
+	})
+}
+
+// SliceReplace causes Merge to replace v1's slices with v2's slices, rather than
+// adding v2's elements to v1's slices.  This applies to nested slices too:
+//
+//	Merge({"a":{"b":[5,6,7]}}, {"a":{"b":[5,4]}})                 // {"a":{"b":[5,6,7,4]}}
+//	Merge({"a":{"b":[5,6,7]}}, {"a":{"b":[5,4]}}, SliceReplace()) // {"a":{"b":[5,4]}}
+//
+// SliceReplace takes precedence over SliceIdentity.
+func SliceReplace() NormalizeOption {
+	return MergeOptionFunc(func(options *MergeOptions) {
+		options.ReplaceSlices = true
+	})
+}
+
+// ConflictResolver sets a function which resolves conflicts between v1 and v2.  By
+// default, when v1 and v2 both have a value at the same path, and the values can't be
+// merged, because they aren't both maps or both slices, v2's value replaces v1's.  With
+// this option, resolve is called with the path and both normalized values, and its return
+// value is used instead.  For example, to keep the larger number:
+//
+//	Merge(v1, v2, ConflictResolver(func(path string, a, b interface{}) interface{} {
+//	  if fa, ok := a.(float64); ok {
+//	    if fb, ok := b.(float64); ok && fa > fb {
+//	      return a
+//	    }
+//	  }
+//	  return b
+//	}))
+//
+// Paths are formatted like the paths in Trace messages, e.g. "servers[1].size".  The
+// root value's path is "".  resolve isn't called for keys which are only in one of the
+// values.  With SliceReplace, it is also called when v2's slice would replace v1's.
+func ConflictResolver(resolve func(path string, v1, v2 interface{}) interface{}) NormalizeOption {
+	return MergeOptionFunc(func(options *MergeOptions) {
+		options.ResolveConflict = resolve
+	})
+}
+
+// MaxMergeNodes limits the size of the result of a merge to n nodes.  Every value in the
+// result counts as a node, including nested values: each map, slice, and scalar, and the root
+// value itself.  For example, {"a":[1,2]} is 4 nodes.  Nodes are counted as the merge proceeds,
+// and the merge stops as soon as the limit is exceeded.
+//
+// This protects against merging untrusted documents which would produce very large results,
+// particularly with MergeJSONStream, where each document adds to the result.  n <= 0 means no
+// limit, which is the default.
+//
+// When the limit is exceeded, MergeWithError and MergeJSONStream return MergeTooLargeError.
+// Merge, MergeAll, and MergeAllWithOptions don't return errors, so they return nil.
+func MaxMergeNodes(n int) NormalizeOption {
+	return MergeOptionFunc(func(options *MergeOptions) {
+		options.MaxNodes = n
+	})
+}
+
+// Intersect returns a new value, containing only the parts of the normalized values
+// of v1 and v2 which are the same in both:
+//
+//   - For maps, keys present in both are kept, with the intersection of their values.
+//     Keys whose values have nothing in common are omitted.
+//   - For slices, elements of v1 which are equivalent to an element of v2 are kept,
+//     in v1's order.  Each v2 element can only match one v1 element, so duplicates are kept
+//     as many times as they appear in both.
+//   - Other values are kept if they are equal.
+//
+// For example:
+//
+//	v1 := {"region":"east", "size":2, "tags":["red","blue"], "labels":{"env":"prod"}}
+//	v2 := {"region":"east", "size":3, "tags":["blue","green"], "labels":{"env":"dev"}}
+//	Intersect(v1, v2) // {"region":"east", "tags":["blue"]}
+//
+// If v1 and v2 have nothing in common, Intersect returns nil.  v1 and v2 are
+// not modified.
+func Intersect(v1, v2 interface{}) (interface{}, error) {
 	o := NormalizeOptions{
 		Copy:    true,
 		Marshal: true,
 		Deep:    true,
 	}
-	for _, opt := range opts {
-		opt.Apply(&o)
+	v1, err := normalize(v1, &o)
+	if err != nil {
+		return nil, err
+	}
+	v2, err = normalize(v2, &o)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := intersect(v1, v2); ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// intersect returns the intersection of normalized values v1 and v2, and whether
+// they had anything in common.  Two empty maps or slices are the same, so they have
+// something in common.
+func intersect(v1, v2 interface{}) (interface{}, bool) {
+	switch t1 := v1.(type) {
+	case map[string]interface{}:
+		t2, ok := v2.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m := map[string]interface{}{}
+		for key, value := range t1 {
+			if value2, present := t2[key]; present {
+				if value, ok = intersect(value, value2); ok {
+					m[key] = value
+				}
+			}
+		}
+		return m, len(m) > 0 || (len(t1) == 0 && len(t2) == 0)
+	case []interface{}:
+		t2, ok := v2.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		s := []interface{}{}
+		used := make([]bool, len(t2))
+	Search:
+		for _, value := range t1 {
+			for i, value2 := range t2 {
+				if !used[i] && Equivalent(value, value2) {
+					used[i] = true
+					s = append(s, value)
+					continue Search
+				}
+			}
+		}
+		return s, len(s) > 0 || (len(t1) == 0 && len(t2) == 0)
+	}
+	if Equivalent(v1, v2) {
+		return v1, true
+	}
+	return nil, false
+}
+
+// MergeDefaults returns a new map, which is the deep merge of the
+// normalized values of defaults and v.  Values in v override values
+// in defaults, like Merge.
+//
+// Unlike Merge, empty values in v (see Empty) are treated as not set,
+// and don't override the value in defaults.  This is useful when v is a struct,
+// since fields without `omitempty` will be normalized to zero values:
+//
+//	type Config struct {
+//	  Host string `json:"host"`
+//	  Port int    `json:"port"`
+//	}
+//	MergeDefaults(map[string]interface{}{"host": "localhost", "port": 80}, Config{Port: 8080})
+//	// {"host": "localhost", "port": 8080}
+//
+// Empty maps are not set either, including nested maps which only contained empty
+// values.
+//
+// The return value is a copy.  defaults and v are not modified.
+func MergeDefaults(defaults, v interface{}) (interface{}, error) {
+	o := NormalizeOptions{
+		Copy:    true,
+		Marshal: true,
+		Deep:    true,
+	}
+	defaults, err := normalize(defaults, &o)
+	if err != nil {
+		return nil, err
+	}
+	v, err = normalize(v, &o)
+	if err != nil {
+		return nil, err
+	}
+	v = deleteEmptyKeys(v)
+	if Empty(v) {
+		return defaults, nil
+	}
+	return merge(defaults, v, nil), nil
+}
+
+// deleteEmptyKeys recursively removes keys with empty values from
+// normalized maps.  Maps are modified in place.
+func deleteEmptyKeys(v interface{}) interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		for key, value := range m {
+			if value = deleteEmptyKeys(value); Empty(value) {
+				delete(m, key)
+			} else {
+				m[key] = value
+			}
+		}
 	}
-	v1, _ = normalize(v1, &o)
-	v2, _ = normalize(v2, &o)
-	return merge(v1, v2)
+	return v
 }
 
-func merge(v1, v2 interface{}) interface{} {
+// merge merges normalized v2 into v1.  v1 is modified in place.  opts
+// may be nil.  If the MaxNodes limit is exceeded, merge stops early, and the
+// result is incomplete.
+func merge(v1, v2 interface{}, opts *MergeOptions) interface{} {
+	if o1, isOrdered := v1.(*OrderedMap); isOrdered || isOrderedMap(v2) {
+		if merged, ok := mergeOrdered(o1, v1, v2, opts); ok {
+			return merged
+		}
+	}
 	switch t1 := v1.(type) {
 	case map[string]interface{}:
 		if t2, isMap := v2.(map[string]interface{}); isMap {
 			for key, value := range t2 {
-				t1[key] = merge(t1[key], value)
+				if old, present := t1[key]; present {
+					opts.push(".", key)
+					t1[key] = merge(old, value, opts)
+					opts.pop(2)
+				} else {
+					t1[key] = value
+					opts.added(value)
+				}
+				if opts.tooLarge() {
+					break
+				}
 			}
 			return t1
 		}
 	case []interface{}:
-		if t2, isSlice := v2.([]interface{}); isSlice {
+		if t2, isSlice := v2.([]interface{}); isSlice && (opts == nil || !opts.ReplaceSlices) {
+			if opts != nil && opts.SliceIdentity != nil {
+				return mergeByIdentity(t1, t2, opts)
+			}
 			orig := t1[:]
+			ctx := newEquivCtx()
+			defer ctx.release()
 			for _, value := range t2 {
-				if !sliceContains(orig, value) {
+				if !sliceContains(orig, value, ctx) {
 					t1 = append(t1, value)
+					opts.added(value)
+					if opts.tooLarge() {
+						break
+					}
 				}
 			}
 			return t1
 		}
 	}
+	if opts != nil && opts.ResolveConflict != nil {
+		v2 = opts.ResolveConflict(strings.TrimPrefix(strings.Join(opts.path, ""), "."), v1, v2)
+	}
+	opts.removed(v1)
+	opts.added(v2)
 	return v2
 }
 
-func sliceContains(s []interface{}, v interface{}) bool {
+// isOrderedMap returns true if v is an *OrderedMap.
+func isOrderedMap(v interface{}) bool {
+	_, ok := v.(*OrderedMap)
+	return ok
+}
+
+// mergeOrdered merges v2 into v1, when either is an *OrderedMap, which Normalize makes
+// with PreserveOrder.  o1 is v1, if it's an *OrderedMap.  The result is an *OrderedMap.
+// New keys are added after v1's keys, in v2's order.  Plain maps don't have an order,
+// so their keys are added in sorted order, so the result is the same every time.  ok is
+// false if v1 and v2 aren't both maps.
+func mergeOrdered(o1 *OrderedMap, v1, v2 interface{}, opts *MergeOptions) (merged interface{}, ok bool) {
+	if o1 == nil {
+		m, isMap := v1.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		o1 = orderedFromMap(m)
+	}
+	o2, isOrdered := v2.(*OrderedMap)
+	if !isOrdered {
+		m, isMap := v2.(map[string]interface{})
+		if !isMap {
+			return nil, false
+		}
+		o2 = orderedFromMap(m)
+	}
+	for _, key := range o2.keys {
+		value := o2.values[key]
+		if old, present := o1.values[key]; present {
+			opts.push(".", key)
+			o1.values[key] = merge(old, value, opts)
+			opts.pop(2)
+		} else {
+			o1.Set(key, value)
+			opts.added(value)
+		}
+		if opts.tooLarge() {
+			break
+		}
+	}
+	return o1, true
+}
+
+// orderedFromMap returns an *OrderedMap with the keys and values of m, with the keys
+// sorted.  The values map is shared with m.
+func orderedFromMap(m map[string]interface{}) *OrderedMap {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return &OrderedMap{keys: keys, values: m}
+}
+
+// push adds elements to the path of the value being merged, if it's needed.
+func (o *MergeOptions) push(elems ...string) {
+	if o != nil && o.ResolveConflict != nil {
+		o.path = append(o.path, elems...)
+	}
+}
+
+// pop removes the last n elements pushed to the path.
+func (o *MergeOptions) pop(n int) {
+	if o != nil && o.ResolveConflict != nil {
+		o.path = o.path[:len(o.path)-n]
+	}
+}
+
+// added counts the nodes in v, which was added to the result of the merge.
+func (o *MergeOptions) added(v interface{}) {
+	if o != nil && o.MaxNodes > 0 {
+		o.nodes += countNodes(v, o.MaxNodes-o.nodes)
+	}
+}
+
+// removed subtracts the nodes in v, which was replaced in the result of the merge.
+func (o *MergeOptions) removed(v interface{}) {
+	if o != nil && o.MaxNodes > 0 {
+		o.nodes -= countNodes(v, o.MaxNodes)
+	}
+}
+
+func (o *MergeOptions) tooLarge() bool {
+	return o != nil && o.MaxNodes > 0 && o.nodes > o.MaxNodes
+}
+
+// countNodes counts the values in v, including v itself.  It stops counting once
+// the count exceeds limit.  If limit <= 0, it just returns 1.
+func countNodes(v interface{}, limit int) int {
+	n := 1
+	if limit <= 0 {
+		return n
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, value := range t {
+			if n > limit {
+				break
+			}
+			n += countNodes(value, limit-n)
+		}
+	case *OrderedMap:
+		for _, value := range t.values {
+			if n > limit {
+				break
+			}
+			n += countNodes(value, limit-n)
+		}
+	case []interface{}:
+		for _, value := range t {
+			if n > limit {
+				break
+			}
+			n += countNodes(value, limit-n)
+		}
+	}
+	return n
+}
+
+func mergeByIdentity(t1, t2 []interface{}, opts *MergeOptions) []interface{} {
+	ids := make([]interface{}, len(t1), len(t1)+len(t2))
+	for i, value := range t1 {
+		ids[i] = opts.SliceIdentity(value)
+	}
+	orig := t1[:]
+	ctx := newEquivCtx()
+	defer ctx.release()
+Search:
+	for _, value := range t2 {
+		if id := opts.SliceIdentity(value); id != nil {
+			for i, id1 := range ids {
+				if id1 != nil && reflect.DeepEqual(id, id1) {
+					opts.push("[" + strconv.Itoa(i) + "]")
+					t1[i] = merge(t1[i], value, opts)
+					opts.pop(1)
+					if opts.tooLarge() {
+						break Search
+					}
+					continue Search
+				}
+			}
+			t1 = append(t1, value)
+			ids = append(ids, id)
+		} else if !sliceContains(orig, value, ctx) {
+			t1 = append(t1, value)
+			ids = append(ids, nil)
+		} else {
+			continue
+		}
+		opts.added(value)
+		if opts.tooLarge() {
+			break
+		}
+	}
+	return t1
+}
+
+// newEquivCtx returns a ctx for calling sliceContains.  It should be released when done.
+// Nested slices are compared positionally, so slices with the same elements in a different
+// order, or repeated a different number of times, are different elements.
+func newEquivCtx() *containsCtx {
+	ctx := newCtx()
+	ctx.equiv = true
+	ctx.orderedSlices = true
+	ctx.Marshal = true
+	return ctx
+}
+
+// sliceContains returns true if s contains an element equal to v.  Elements are
+// compared like Equivalent with OrderedSlices, rather than with reflect.DeepEqual, so
+// values which are normalized to different types, like the numbers 1 and 1.0 with
+// PreserveInts, are still equal.  s and v have already been normalized, so they're
+// compared directly, reusing ctx for each element.
+func sliceContains(s []interface{}, v interface{}, ctx *containsCtx) bool {
 	switch v.(type) {
-	case string, float64, bool, nil:
+	case string, bool, nil:
+		for _, value := range s {
+			if value == v {
+				return true
+			}
+		}
+		return false
+	case float64:
 		for _, value := range s {
 			if value == v {
 				return true
 			}
+			// other numeric types, with PreserveInts or NumbersAsJSONNumber
+			if _, ok := value.(float64); !ok && equivalentNormalized(v, value, ctx) {
+				return true
+			}
 		}
 		return false
 	}
 	for _, value := range s {
-		if reflect.DeepEqual(v, value) {
+		if equivalentNormalized(v, value, ctx) {
 			return true
 		}
 	}
 	return false
 }
 
+// equivalentNormalized compares v1 and v2 with ctx, which was made by newEquivCtx.
+func equivalentNormalized(v1, v2 interface{}, ctx *containsCtx) bool {
+	ctx.Error = nil
+	return contains(v1, v2, ctx)
+}
+
 // Transform applies a transformation function to each value in tree.
 // Values are normalized before being passed to the transformer function.
 // Any maps and slices are passed to the transform function as the whole value
 // first, then each child value of the map/slice is passed to the transform
-// function.
+// function.  The BottomUp option reverses this order.
 //
 // The value returned by the transformer will replace the original value.
 //
 // If the transform function returns a non-primitive value, it will recurse into the new value.
 //
 // If the transformer function returns the error ErrStop, the process will abort with no error.
+//
+// opts may include NormalizeOptions, and TransformOptions, like BottomUp.
 func Transform(v interface{}, transformer func(in interface{}) (interface{}, error), opts ...NormalizeOption) (interface{}, error) {
-	o := NormalizeOptions{
-		Copy:    true,
-		Marshal: true,
+	o := TransformOptions{
+		NormalizeOptions: NormalizeOptions{
+			Copy:    true,
+			Marshal: true,
+		},
 	}
 	for _, opt := range opts {
-		opt.Apply(&o)
+		if to, ok := opt.(TransformOptionFunc); ok {
+			to(&o)
+		} else {
+			opt.Apply(&o.NormalizeOptions)
+		}
 	}
 	o.Deep = false
 
-	v, err := transform(v, transformer, &o)
+	var errs TransformErrors
+	v, err := transform(v, transformer, &o, nil, &errs)
 	if err == ErrStop {
-		return v, nil
+		err = nil
+	}
+	if err == nil && len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return pathLess(errs[i].Path, errs[j].Path)
+		})
+		return v, errs
 	}
 	return v, err
 }
 
-// ErrStop can be returned by transform functions to end recursion early.  The Transform function will
-// not return an error.
-var ErrStop = errors.New("stop")
+// TransformOptions are options for the Transform function.
+type TransformOptions struct {
+	NormalizeOptions
 
-func transform(v interface{}, transformer func(in interface{}) (interface{}, error), opts *NormalizeOptions) (interface{}, error) {
-	v, _ = normalize(v, opts)
-	var err error
-	v, err = transformer(v)
-	if err != nil {
-		return v, err
-	}
-	// normalize again, in case the transformer function altered v
-	v, _ = normalize(v, opts)
-	switch t := v.(type) {
-	case map[string]interface{}:
-		for key, value := range t {
-			t[key], err = transform(value, transformer, opts)
-			if err != nil {
-				break
-			}
-		}
-	case []interface{}:
-		for i, value := range t {
-			t[i], err = transform(value, transformer, opts)
+	// Pass the children of maps and slices to the transformer function before the
+	// map or slice itself.
+	BottomUp bool
+
+	// Continue after transformer errors, and return them all as TransformErrors.
+	CollectErrors bool
+}
+
+// TransformOptionFunc is a function which modifies TransformOptions.  It
+// implements NormalizeOption, so it can be passed to Transform along with
+// other NormalizeOptions.
+type TransformOptionFunc func(*TransformOptions)
+
+// Apply implements NormalizeOption.  It does nothing: TransformOptionFuncs only
+// apply to Transform.
+func (f TransformOptionFunc) Apply(*NormalizeOptions) {}
+
+// BottomUp causes Transform to visit the tree bottom-up: the children of a map
+// or slice are transformed first, then the map or slice itself is passed to the
+// transformer, with its transformed children.  This is useful for aggregations,
+// where a node's value is computed from its children.
+//
+// Because the children have already been visited, Transform does not recurse into
+// the value returned by the transformer, even if the transformer changed the type
+// of the node (e.g. replaced a map with a slice).
+//
+// If the transformer returns ErrStop, the process aborts immediately.  Any nodes which
+// were transformed already keep their new values, but their parents won't be passed
+// to the transformer.
+func BottomUp() NormalizeOption {
+	return TransformOptionFunc(func(options *TransformOptions) {
+		options.BottomUp = true
+	})
+}
+
+// CollectErrors causes Transform to continue when the transformer returns an error,
+// instead of aborting.  The value which caused the error is left unchanged, and Transform
+// still recurses into its children.  When the transform is complete, Transform returns the
+// transformed value, and a TransformErrors listing every error, and the path to the value
+// which caused it:
+//
+//	v, err := Transform(v, validate, CollectErrors())
+//	if errs, ok := err.(TransformErrors); ok {
+//	  for _, e := range errs {
+//	    fmt.Println(e.Path, e.Err)
+//	  }
+//	}
+//
+// ErrStop still aborts the transform.  Any errors collected before that are returned.
+func CollectErrors() NormalizeOption {
+	return TransformOptionFunc(func(options *TransformOptions) {
+		options.CollectErrors = true
+	})
+}
+
+// TransformError is a transformer error, and the path to the value which caused it.
+type TransformError struct {
+	Path Path
+	Err  error
+}
+
+// Error implements the error interface.
+func (e TransformError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Err.Error()
+	}
+	return e.Path.String() + ": " + e.Err.Error()
+}
+
+// TransformErrors is returned by Transform with the CollectErrors option.  Errors
+// are sorted by path, with slice indexes in numeric order.
+type TransformErrors []TransformError
+
+// Error implements the error interface.  It lists each error on its own line.
+func (e TransformErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// ErrStop can be returned by transform functions to end recursion early.  The Transform function will
+// not return an error.
+var ErrStop = errors.New("stop")
+
+func transform(v interface{}, transformer func(in interface{}) (interface{}, error), opts *TransformOptions, path Path, errs *TransformErrors) (interface{}, error) {
+	v, _ = normalize(v, &opts.NormalizeOptions)
+	var err error
+	if !opts.BottomUp {
+		v, err = applyTransformer(v, transformer, opts, path, errs)
+		if err != nil {
+			return v, err
+		}
+		// normalize again, in case the transformer function altered v
+		v, _ = normalize(v, &opts.NormalizeOptions)
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			var childPath Path
+			if opts.CollectErrors {
+				childPath = append(path[:len(path):len(path)], key)
+			}
+			t[key], err = transform(value, transformer, opts, childPath, errs)
+			if err != nil {
+				break
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			var childPath Path
+			if opts.CollectErrors {
+				childPath = append(path[:len(path):len(path)], i)
+			}
+			t[i], err = transform(value, transformer, opts, childPath, errs)
 			if err != nil {
 				break
 			}
 		}
 	}
+	if opts.BottomUp && err == nil {
+		v, err = applyTransformer(v, transformer, opts, path, errs)
+		if err != nil {
+			return v, err
+		}
+		v, _ = normalize(v, &opts.NormalizeOptions)
+	}
 
 	return v, err
 }
 
+// applyTransformer calls the transformer.  If collecting errors, errors other than ErrStop are
+// recorded, and v is returned unchanged.
+func applyTransformer(v interface{}, transformer func(in interface{}) (interface{}, error), opts *TransformOptions, path Path, errs *TransformErrors) (interface{}, error) {
+	out, err := transformer(v)
+	if err != nil && err != ErrStop && opts.CollectErrors {
+		*errs = append(*errs, TransformError{Path: path, Err: err})
+		return v, nil
+	}
+	return out, err
+}
+
+// KeyCollisionError indicates two keys in the same map were transformed into the same key,
+// by TransformKeys or the LowercaseKeys option, or when converting the keys of a *sync.Map
+// to strings.
+var KeyCollisionError = merry.New("Key collision")
+
+// TransformKeys returns a copy of the normalized value of v, with every map key replaced by
+// fn(key), at any depth, including maps inside slices.  For example:
+//
+//	TransformKeys({"first_name":"bob","address":{"zip_code":"12345"}}, snakeToCamel)
+//	// {"firstName":"bob","address":{"zipCode":"12345"}}
+//
+// If fn transforms two keys in the same map into the same key, TransformKeys returns
+// KeyCollisionError, with the path to the map.  opts may include NormalizeOptions, which
+// default to Copy, Marshal, and Deep.  v is not modified.
+func TransformKeys(v interface{}, fn func(key string) string, opts ...NormalizeOption) (interface{}, error) {
+	o := NormalizeOptions{
+		Copy:    true,
+		Marshal: true,
+		Deep:    true,
+	}
+	for _, opt := range opts {
+		opt.Apply(&o)
+	}
+	o.Deep = true
+	v, err := normalize(v, &o)
+	if err != nil {
+		return nil, err
+	}
+	return transformKeys(v, fn, nil)
+}
+
+func transformKeys(v interface{}, fn func(key string) string, path Path) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		from := make(map[string]string, len(t))
+		for _, key := range sortedKeys(t) {
+			newKey := fn(key)
+			if prev, ok := from[newKey]; ok {
+				msg := fmt.Sprintf("keys %q and %q both transform to %q", prev, key, newKey)
+				if len(path) > 0 {
+					msg = path.String() + ": " + msg
+				}
+				return nil, KeyCollisionError.Here().WithMessage(msg)
+			}
+			from[newKey] = key
+			value, err := transformKeys(t[key], fn, append(path[:len(path):len(path)], key))
+			if err != nil {
+				return nil, err
+			}
+			m[newKey] = value
+		}
+		return m, nil
+	case []interface{}:
+		for i, value := range t {
+			value, err := transformKeys(value, fn, append(path[:len(path):len(path)], i))
+			if err != nil {
+				return nil, err
+			}
+			t[i] = value
+		}
+	}
+	return v, nil
+}
+
 // ContainsOption is an option which modifies the behavior of the Contains() function
 type ContainsOption func(ctx *containsCtx)
 
@@ -204,13 +1049,27 @@ func EmptyValuesMatchAny() ContainsOption {
 //
 // When ParseTimes is specified, after the values are normalized to strings, the code will attempt
 // to parse any string values back into time.Time values.  This allows correct processing of
-// the time.Time zero values.
+// the time.Time zero values.  Strings are parsed with DefaultTimeLayouts.
 func ParseTimes() ContainsOption {
 	return func(o *containsCtx) {
 		o.NormalizeTime = true
 	}
 }
 
+// ParseTimesWithLayouts is like ParseTimes, but strings are parsed with layouts, instead of
+// DefaultTimeLayouts.  Each layout is tried in order.  See ParseTimeLayouts.
+//
+//	v1 := map[string]interface{}{"created": "2023-07-12 14:14:27"}
+//	v2 := map[string]interface{}{"created": time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC)}
+//	Contains(v1, v2, ParseTimes())                                  // false
+//	Contains(v1, v2, ParseTimesWithLayouts("2006-01-02 15:04:05")) // true
+func ParseTimesWithLayouts(layouts ...string) ContainsOption {
+	return func(o *containsCtx) {
+		o.NormalizeTime = true
+		o.TimeLayouts = layouts
+	}
+}
+
 // AllowTimeDelta configures the precision of time comparison.  Time values will be considered equal if the
 // difference between the two values is less than d.
 //
@@ -222,6 +1081,32 @@ func AllowTimeDelta(d time.Duration) ContainsOption {
 	}
 }
 
+// ParseDurations compares durations which are formatted differently.  When comparing a string
+// which can be parsed by time.ParseDuration, like "1h30m", to another duration string, or to a number,
+// both are converted to time.Duration values before comparing.  Numbers are treated as nanoseconds,
+// which is how time.Duration values are marshaled to JSON:
+//
+//	Contains(map[string]interface{}{"timeout":"1m30s"}, map[string]interface{}{"timeout":"90s"}, ParseDurations())     // true
+//	Contains(map[string]interface{}{"timeout":"1s"}, map[string]interface{}{"timeout":1000000000}, ParseDurations()) // true
+//
+// Two numbers are compared as usual.
+func ParseDurations() ContainsOption {
+	return func(o *containsCtx) {
+		o.parseDurations = true
+	}
+}
+
+// AllowDurationDelta configures the precision of duration comparison.  Duration values will be
+// considered equal if the difference between the two values is less than or equal to d.
+//
+// Implies ParseDurations
+func AllowDurationDelta(d time.Duration) ContainsOption {
+	return func(o *containsCtx) {
+		o.parseDurations = true
+		o.durationDelta = d
+	}
+}
+
 // TruncateTimes will truncate time values (see time.Time#Truncate)
 //
 // Implies ParseTimes
@@ -253,6 +1138,22 @@ func IgnoreTimeZones(b bool) ContainsOption {
 	}
 }
 
+// ProtoNames causes proto messages to be normalized with their original .proto
+// field names, instead of their lowerCamelCase JSON names.  The option applies to
+// both v1 and v2, so a message can be compared to a map with snake_case keys, or to
+// another message:
+//
+//	v1 := &Sample{IsEnabled: true}
+//	Contains(v1, map[string]interface{}{"is_enabled": true}, ProtoNames()) // true
+//	Contains(v1, map[string]interface{}{"isEnabled": true}, ProtoNames())  // false
+//
+// See UseProtoNames.
+func ProtoNames() ContainsOption {
+	return func(o *containsCtx) {
+		o.UseProtoNames = true
+	}
+}
+
 // StringContains is a ContainsOption which uses strings.Contains(v1, v2) to test
 // for string containment.
 //
@@ -266,6 +1167,272 @@ func StringContains() ContainsOption {
 	}
 }
 
+// NumberAsString extends StringContains to numbers: when v1 is a number and v2 is a string,
+// v1 is formatted as a decimal string, without an exponent, and matches if it contains v2.
+// It has no effect without StringContains.
+//
+//	Contains(5712345678, "5712", StringContains())                   // false
+//	Contains(5712345678, "5712", StringContains(), NumberAsString()) // true
+//
+// Numbers are normalized to float64 before they are compared, so integers are only
+// formatted exactly up to 2^53.
+func NumberAsString() ContainsOption {
+	return func(o *containsCtx) {
+		o.numberAsString = true
+	}
+}
+
+// CaseInsensitive is a ContainsOption which compares strings with strings.EqualFold,
+// rather than ==.  It applies to string values anywhere in v1 and v2, but not to
+// map keys.  Combined with StringContains, it makes the substring search case-insensitive
+// too.
+//
+//	Contains("Red", "red")                                            // false
+//	Contains("Red", "red", CaseInsensitive())                         // true
+//	Contains("Brown Fox", "fox", StringContains(), CaseInsensitive()) // true
+func CaseInsensitive() ContainsOption {
+	return func(o *containsCtx) {
+		o.caseInsensitive = true
+	}
+}
+
+// FloatDelta allows numbers to match as long as they differ by no more than delta.  This
+// is useful when values were computed, or came from floats of different widths:
+//
+//	Contains(float32(0.1), 0.1)                   // false
+//	Contains(float32(0.1), 0.1, FloatDelta(1e-6)) // true
+//
+// It applies to numbers anywhere in v1 and v2.  VectorSlices has its own delta.
+func FloatDelta(delta float64) ContainsOption {
+	return func(o *containsCtx) {
+		o.floatDelta = delta
+	}
+}
+
+// Comparator sets a custom comparison function.  fn is called with each pair of normalized
+// values compared, including maps and slices, before the default comparison.  path is the
+// path to the values, formatted like the paths in Trace messages, e.g. "resource.size".
+// The root path is "".  Slice indexes are only included when slices are compared
+// positionally, like with OrderedSlices.  If fn returns handled, matched is the result of
+// the comparison.  Otherwise, the values are compared the default way.
+//
+// For example, to compare prices to the cent:
+//
+//	Contains(v1, v2, Comparator(func(path string, v1, v2 interface{}) (matched, handled bool) {
+//	  f1, ok1 := v1.(float64)
+//	  f2, ok2 := v2.(float64)
+//	  if !ok1 || !ok2 || !strings.HasSuffix(path, "price") {
+//	    return false, false
+//	  }
+//	  return math.Round(f1*100) == math.Round(f2*100), true
+//	}))
+//
+// Values are normalized one level at a time, so the elements of maps and slices passed to
+// fn may not be normalized yet.  Unlike comparers registered with RegisterComparer, fn only
+// applies to this comparison, and isn't called with matchers.
+func Comparator(fn func(path string, v1, v2 interface{}) (matched, handled bool)) ContainsOption {
+	return func(o *containsCtx) {
+		o.comparator = fn
+	}
+}
+
+// OrderedSlices compares slices positionally, rather than as sets.  Element i of v2 is
+// compared only to element i of v1.  For Equivalent, the slices must be the same length.
+// For Contains, v2 may be shorter, and must match the start of v1:
+//
+//	Equivalent([]int{1, 2, 3}, []int{3, 2, 1})                  // true
+//	Equivalent([]int{1, 2, 3}, []int{3, 2, 1}, OrderedSlices()) // false
+//	Contains([]int{1, 2, 3}, []int{1, 2}, OrderedSlices())      // true
+//	Contains([]int{1, 2, 3}, []int{2, 3}, OrderedSlices())      // false
+//
+// The elements themselves are compared as usual, so maps in v1 elements may still
+// have extra keys in Contains.  When a match fails, the trace reports the first index
+// which doesn't match.
+func OrderedSlices() ContainsOption {
+	return func(o *containsCtx) {
+		o.orderedSlices = true
+	}
+}
+
+// VectorSlices compares slices as ordered vectors.  The slices must be the same
+// length, and element i of v1 is compared only to element i of v2.  Numeric
+// elements match if they differ by no more than delta.  Other elements are compared
+// as usual.
+//
+//	Contains([]float64{0.1, 0.2}, []float64{0.1001, 0.1999}, VectorSlices(0.001)) // true
+//	Contains([]float64{0.1, 0.2}, []float64{0.2, 0.1}, VectorSlices(0.001)) // false, order matters
+//	Contains([]float64{0.1, 0.2}, []float64{0.1}, VectorSlices(0.001)) // false, lengths differ
+//
+// This replaces the default set-like slice matching, for both Contains and Equivalent.
+func VectorSlices(delta float64) ContainsOption {
+	return func(o *containsCtx) {
+		o.vectorSlices = true
+		o.vectorDelta = delta
+	}
+}
+
+// DecodeBase64 compares base64 strings with byte arrays.  Byte slices are normalized
+// to slices of numbers, but protobuf bytes fields, and other encodings, represent
+// bytes as base64 strings.  With this option, when one value is a string and the other
+// is a slice of numbers, the string is decoded and the bytes are compared:
+//
+//	v1 := map[string]interface{}{"data": []byte("hello")}
+//	v2 := map[string]interface{}{"data": "aGVsbG8="}
+//	Contains(v1, v2) // false
+//	Contains(v1, v2, DecodeBase64()) // true
+//
+// Only string vs. byte array comparisons are affected: two strings are still compared
+// as strings, even if both are valid base64.  The slice must contain only integers
+// from 0 to 255, and the string must be strictly valid standard or URL base64, padded
+// or unpadded.  Otherwise, the slice is compared to the string as usual, so Contains
+// still finds the string in a slice of strings.  The decoded bytes must be equal, in
+// both Contains and Equivalent.
+func DecodeBase64() ContainsOption {
+	return func(o *containsCtx) {
+		o.decodeBase64 = true
+	}
+}
+
+// IgnoreKeys skips the named keys when comparing maps, at any depth.  The keys are
+// ignored on both sides: they don't need to match, and in Equivalent, they aren't
+// counted as extra keys.  This includes maps inside slices, so slices of objects can
+// be compared while ignoring volatile fields in each element:
+//
+//	v1 := []interface{}{map[string]interface{}{"id": 1, "name": "a"}}
+//	v2 := []interface{}{map[string]interface{}{"id": 2, "name": "a"}}
+//	Equivalent(v1, v2) // false
+//	Equivalent(v1, v2, IgnoreKeys("id")) // true
+//
+// Keys are matched by exact name.  IgnoreKeys may be passed more than once.
+func IgnoreKeys(keys ...string) ContainsOption {
+	return func(o *containsCtx) {
+		if o.ignoreKeys == nil {
+			o.ignoreKeys = make(map[string]bool, len(keys))
+		}
+		for _, key := range keys {
+			o.ignoreKeys[key] = true
+		}
+	}
+}
+
+// AllowExtraKeysUnder relaxes Equivalent, allowing v1 to have extra map keys
+// at or below the given paths.  Everywhere else, the keys must match exactly:
+//
+//	v1 := map[string]interface{}{"resource": map[string]interface{}{"name": "a", "meta": map[string]interface{}{"etag": "x"}}}
+//	v2 := map[string]interface{}{"resource": map[string]interface{}{"name": "a", "meta": map[string]interface{}{}}}
+//	Equivalent(v1, v2) // false
+//	Equivalent(v1, v2, AllowExtraKeysUnder("resource.meta")) // true
+//
+// Paths are in the syntax ParsePath supports.  Use "[]" to match elements of slices, like "items[].meta",
+// and "*" to match any key, like "resources.*.meta".
+// Has no effect on Contains, which always allows extra keys in v1, unless ExactKeys is set.
+func AllowExtraKeysUnder(paths ...string) ContainsOption {
+	return func(o *containsCtx) {
+		for _, path := range paths {
+			p, err := ParsePath(path)
+			if err != nil {
+				o.Error = merry.Prependf(err, "invalid AllowExtraKeysUnder path %q", path)
+				return
+			}
+			o.allowExtraKeysUnder = append(o.allowExtraKeysUnder, p)
+		}
+	}
+}
+
+// OnlyKeys limits the comparison to the values at the given paths.  Everything else in
+// v1 and v2 is ignored, as if both values were passed through Project first:
+//
+//	v1 := {"resource":{"state":"Active","name":"a"},"owner":"bob"}
+//	v2 := {"resource":{"state":"Active","name":"b"}}
+//	Equivalent(v1, v2)                             // false
+//	Equivalent(v1, v2, OnlyKeys("resource.state")) // true
+//
+// Paths are parsed with ParsePath, and may contain wildcards.  If a path is missing from
+// both values, it matches.  If it's only missing from v1, v1 doesn't contain v2.
+//
+// In Equivalent, extra keys are only detected within the paths: with OnlyKeys("resource"),
+// v1's resource may not have extra keys, but v1 may have other keys besides resource.
+// Passing OnlyKeys more than once adds to the paths.
+func OnlyKeys(paths ...string) ContainsOption {
+	return func(o *containsCtx) {
+		if o.onlyKeys == nil {
+			o.onlyKeys = &projection{}
+		}
+		for _, path := range paths {
+			p, err := ParsePath(path)
+			if err == nil {
+				err = o.onlyKeys.add(p)
+			}
+			if err != nil {
+				o.Error = merry.Prependf(err, "invalid OnlyKeys path %q", path)
+				return
+			}
+		}
+	}
+}
+
+// EmptyContainersMatchAbsent treats nil, empty slices, empty maps, and absent
+// map keys as the same.  Depending on whether a slice is nil, and on the omitempty
+// tag, structs may marshal an empty slice field as [], null, or omit it entirely.  This
+// option prevents spurious mismatches between those forms:
+//
+//	type Widget struct {
+//	  Name string   `json:"name"`
+//	  Tags []string `json:"tags"`
+//	}
+//	v2 := map[string]interface{}{"name": "a"}
+//	Equivalent(Widget{Name: "a"}, v2) // false, v1 has "tags": null
+//	Equivalent(Widget{Name: "a"}, v2, EmptyContainersMatchAbsent()) // true
+//	Equivalent(Widget{Name: "a", Tags: []string{}}, v2, EmptyContainersMatchAbsent()) // true
+//
+// It applies on both sides: a v2 key with an empty value matches an absent v1 key, and
+// in Equivalent, a v1 key with an empty value matches an absent v2 key.
+func EmptyContainersMatchAbsent() ContainsOption {
+	return func(o *containsCtx) {
+		o.emptyIsAbsent = true
+	}
+}
+
+// TemplateMode treats v2 as a template for v1.  Every key in v2 must be present
+// in v1, but v1 maps may have extra keys, as in Contains.  Unlike Contains, the
+// values at keys present in both must be equivalent, not just contained: slices must
+// have the same length and the same elements, in any order.
+//
+//	v1 := map[string]interface{}{"color":"red", "tags":[]string{"red","green"}}
+//	v2 := map[string]interface{}{"tags":[]string{"green"}}
+//	Contains(v1, v2) // true
+//	Contains(v1, v2, TemplateMode()) // false, tags don't match exactly
+//	v2 = map[string]interface{}{"tags":[]string{"green","red"}}
+//	Contains(v1, v2, TemplateMode()) // true, extra "color" key in v1 is allowed
+//
+// Equivalent with TemplateMode behaves the same as Contains with TemplateMode.
+func TemplateMode() ContainsOption {
+	return func(o *containsCtx) {
+		o.equiv = true
+		o.template = true
+	}
+}
+
+// ExactKeys requires v1 maps to have exactly the same keys as v2 maps, but only requires
+// their values to be contained, not equivalent.  It's the opposite of TemplateMode:
+//
+//	v1 := map[string]interface{}{"color":"red", "tags":[]string{"red","green"}}
+//	Contains(v1, map[string]interface{}{"tags":[]string{"green"}})              // true
+//	Contains(v1, map[string]interface{}{"tags":[]string{"green"}}, ExactKeys()) // false, v1 has an extra key
+//	v2 := map[string]interface{}{"color":"red", "tags":[]string{"green"}}
+//	Contains(v1, v2, ExactKeys()) // true, tags contains green
+//	Equivalent(v1, v2)            // false, tags has an extra element
+//
+// The keys of every map are checked, including nested maps and maps in slices, but slices
+// may still have extra elements, and options like StringContains still apply to values.
+// AllowExtraKeysUnder and IgnoreKeys exempt keys from the check, as in Equivalent.  ExactKeys
+// has no effect on Equivalent, which already requires the same keys.
+func ExactKeys() ContainsOption {
+	return func(o *containsCtx) {
+		o.exactKeys = true
+	}
+}
+
 // Trace sets `s` to a string describing the path to the values where containment was false.  Helps
 // debugging why one value doesn't contain another.  Sample output:
 //
@@ -282,6 +1449,126 @@ func Trace(s *string) ContainsOption {
 	}
 }
 
+// TraceInfo describes where and why containment was false.  See TraceStruct.
+type TraceInfo struct {
+	// Path to the values which didn't match, like "resource.tags[1]".
+	Path string
+	// Why the values didn't match, like "values are not equal".
+	Reason string
+	V1     interface{}
+	V2     interface{}
+}
+
+// TraceStruct is like Trace, but sets `info` to the parts of the trace, so they can be inspected
+// without parsing the trace string.  If containment was true, `info` is set to the zero value.
+//
+// If `info` is nil, it does nothing.
+func TraceStruct(info *TraceInfo) ContainsOption {
+	return func(o *containsCtx) {
+		o.traceInfo = info
+	}
+}
+
+// FlattenBeforeCompare flattens nested maps in both values into maps with dotted keys
+// (see Flatten) before comparing them.  This lets values with flat, dotted keys match
+// values with the equivalent nested maps:
+//
+//	v1 := map[string]interface{}{"foo.bar": 1, "foo.baz": 2}
+//	v2 := map[string]interface{}{"foo": map[string]interface{}{"bar": 1}}
+//	Contains(v1, v2) // false
+//	Contains(v1, v2, FlattenBeforeCompare()) // true
+//
+// Slices are not flattened, so they are still compared as slices, but maps inside slices
+// are flattened too.
+//
+// Keys which contain dots are indistinguishable from nested keys, which is the point.  But if
+// a value contains both, like {"a.b":1, "a":{"b":2}}, the flattened keys collide, and the values
+// are compared without flattening.
+func FlattenBeforeCompare() ContainsOption {
+	return func(o *containsCtx) {
+		o.flatten = true
+	}
+}
+
+// TraceClosestMatch adds more detail to the trace when a slice in v1 doesn't contain
+// a value in v2.  It finds the v1 element which was the closest match, by counting how
+// many of the v2 value's leaves it matches, and explains how that element differs:
+//
+//	v1 does not contain v2[0]: "map[name:bob role:admin]"
+//	closest match is v1[3], which differs:
+//	  values are not equal
+//	  v1.role -> "user"
+//	  v2.role -> "admin"
+//	v1.users -> ...
+//	v2.users -> ...
+//
+// The paths in the explanation are relative to the element.  Finding the closest element
+// requires another pass over the slice, so this is only done when tracing, and the match
+// fails.
+func TraceClosestMatch() ContainsOption {
+	return func(o *containsCtx) {
+		o.traceClosest = true
+	}
+}
+
+// Parallel searches slices with n goroutines, when comparing slices which aren't ordered.
+// Slice matching compares each element of one slice with the elements of the other, which
+// is slow for large slices of maps.  Parallel spreads the elements across goroutines, so the
+// comparison finishes sooner, but uses more CPU overall.  The result is the same as without
+// the option.
+//
+// Nested slices are searched sequentially.  Comparators passed with the Comparator option,
+// and registered with RegisterComparer, must be safe to call concurrently.  If n is less than
+// 2, slices are searched by the calling goroutine.
+func Parallel(n int) ContainsOption {
+	return func(o *containsCtx) {
+		o.parallel = n
+	}
+}
+
+// CollectAll makes ContainsMatch and EquivalentMatch keep comparing after a mismatch,
+// and report every mismatch in Match.Mismatches, sorted by path:
+//
+//	m := ContainsMatch(
+//	  map[string]interface{}{"color":"red", "size":1},
+//	  map[string]interface{}{"color":"blue", "size":2},
+//	  CollectAll(),
+//	)
+//	// m.Mismatches[0].Path == "color", m.Mismatches[1].Path == "size"
+//
+// Paths are sorted element by element, so slice indexes are in numeric order, like
+// "items[2]" before "items[10]".
+//
+// The first mismatch is also reported in Match's other fields, as usual.  Mismatches in
+// the keys of maps and the elements of ordered slices are collected separately.  Since unordered
+// slices don't compare elements pairwise, a slice which doesn't contain a value is a single mismatch.
+// Comparison stops at the first error.
+//
+// CollectAll has no effect on Contains and Equivalent, which always stop at the first mismatch.
+func CollectAll() ContainsOption {
+	return func(o *containsCtx) {
+		o.collectAll = true
+	}
+}
+
+// TracePointerPaths formats the path to the mismatch as an RFC 6901 JSON Pointer,
+// in both the trace message and Match.Path.  For example, instead of:
+//
+//	values are not equal
+//	v1.resource.tags -> ...
+//
+// the trace will contain:
+//
+//	values are not equal
+//	v1/resource/tags -> ...
+//
+// "~" and "/" in keys are escaped as "~0" and "~1".
+func TracePointerPaths() ContainsOption {
+	return func(o *containsCtx) {
+		o.pointerPaths = true
+	}
+}
+
 // Contains tests whether v1 "contains" v2.  The notion of containment
 // is based on postgres' JSONB containment operators.
 //
@@ -331,10 +1618,42 @@ type Match struct {
 	V2      interface{}
 	Error   error
 	Message string
+
+	// With the CollectAll option, all the mismatches, sorted by path.  The first is
+	// also reported in the fields above.
+	Mismatches []Mismatch
+}
+
+// mismatchesByPath sorts mismatches by their paths.  paths has the path of each mismatch,
+// as a Path, so slice indexes are compared as numbers.
+type mismatchesByPath struct {
+	mismatches []Mismatch
+	paths      []Path
+}
+
+func (m mismatchesByPath) Len() int { return len(m.mismatches) }
+
+func (m mismatchesByPath) Less(i, j int) bool { return pathLess(m.paths[i], m.paths[j]) }
+
+func (m mismatchesByPath) Swap(i, j int) {
+	m.mismatches[i], m.mismatches[j] = m.mismatches[j], m.mismatches[i]
+	m.paths[i], m.paths[j] = m.paths[j], m.paths[i]
+}
+
+// Mismatch is one of the places where a match failed.  See CollectAll.
+type Mismatch struct {
+	Path    string
+	V1      interface{}
+	V2      interface{}
+	Message string
+	Reason  string // Message, without the values.  See TraceInfo.
 }
 
 // ContainsMatch is the same as Contains, but returns the normalized versions of v1 and v2 used
 // in the comparison.
+//
+// If v1 and v2 both contain themselves at the same place, comparing them would never end, so
+// the comparison stops, and Error is a CycleDetectedError.
 func ContainsMatch(v1, v2 interface{}, options ...ContainsOption) Match {
 	ctx := newCtx()
 	ctx.explain = true
@@ -346,19 +1665,61 @@ func containsMatch(v1, v2 any, ctx *containsCtx, options ...ContainsOption) Matc
 		o(ctx)
 	}
 
-	if ctx.trace != nil {
+	if ctx.trace != nil || ctx.traceInfo != nil {
 		ctx.explain = true
 	}
 
 	ctx.Marshal = true
 
-	ctx.Matches = contains(v1, v2, ctx)
+	if ctx.Error != nil {
+		// an option was invalid
+		ctx.Message = ctx.Error.Error()
+		ctx.reason = ctx.Message
+		ctx.setTrace()
+		m := ctx.Match
+		ctx.release()
+		return m
+	}
 
-	if ctx.trace != nil {
-		*ctx.trace = ctx.Message
+	if ctx.onlyKeys != nil {
+		// if either value can't be projected, compare both as is.  Normalization
+		// errors will be reported by contains.
+		opts := ctx.NormalizeOptions
+		opts.Copy, opts.Deep = false, false
+		p1, _, err1 := project(v1, []*projection{ctx.onlyKeys}, &opts)
+		p2, _, err2 := project(v2, []*projection{ctx.onlyKeys}, &opts)
+		if err1 == nil && err2 == nil {
+			v1, v2 = p1, p2
+		}
 	}
 
-	m := ctx.Match
+	if ctx.flatten {
+		// if either value can't be flattened, compare both as is.  Normalization
+		// errors will be reported by contains.
+		f1, err1 := flattenForCompare(v1, ctx)
+		f2, err2 := flattenForCompare(v2, ctx)
+		if err1 == nil && err2 == nil {
+			v1, v2 = f1, f2
+		}
+	}
+
+	ctx.Matches = contains(v1, v2, ctx)
+
+	if ctx.cancelErr != nil {
+		// the comparison was abandoned, so any mismatches found so far aren't meaningful
+		ctx.Match = Match{Error: ctx.cancelErr, Message: ctx.cancelErr.Error()}
+	}
+
+	if len(ctx.Mismatches) > 0 {
+		// map keys are compared in random order
+		sort.Stable(mismatchesByPath{mismatches: ctx.Mismatches, paths: ctx.mismatchPaths})
+		first := ctx.Mismatches[0]
+		ctx.Path, ctx.V1, ctx.V2, ctx.Message, ctx.reason = first.Path, first.V1, first.V2, first.Message, first.Reason
+	}
+
+	ctx.setTrace()
+
+	m := ctx.Match
 
 	ctx.release()
 
@@ -382,6 +1743,36 @@ func Equivalent(v1, v2 interface{}, options ...ContainsOption) bool {
 	return containsMatch(v1, v2, ctx, options...).Matches
 }
 
+// ContainsJSON is the same as ContainsMatch, but takes v1 and v2 as JSON, like HTTP
+// response bodies.  Returns an error if either can't be unmarshaled.
+func ContainsJSON(v1, v2 []byte, options ...ContainsOption) (Match, error) {
+	var j1, j2 interface{}
+	if err := json.Unmarshal(v1, &j1); err != nil {
+		return Match{}, merry.Prepend(err, "error parsing v1")
+	}
+	if err := json.Unmarshal(v2, &j2); err != nil {
+		return Match{}, merry.Prepend(err, "error parsing v2")
+	}
+	return ContainsMatch(j1, j2, options...), nil
+}
+
+// ContainsContext is the same as ContainsMatch, but stops comparing if ctx is cancelled,
+// which is useful when comparing large values with a deadline.  If ctx is cancelled, the
+// Match fails, Match.Error is ctx.Err(), and the error is returned.  Otherwise, the error
+// is Match.Error.
+//
+// ctx is checked periodically, as the values are compared, rather than before each comparison.
+func ContainsContext(ctx context.Context, v1, v2 interface{}, options ...ContainsOption) (Match, error) {
+	if err := ctx.Err(); err != nil {
+		return Match{Error: err, Message: err.Error()}, err
+	}
+	c := newCtx()
+	c.explain = true
+	c.cancelCtx = ctx
+	m := containsMatch(v1, v2, c, options...)
+	return m, m.Error
+}
+
 // EquivalentMatch is the same as Equivalent, but returns the normalized versions of v1 and v2 used
 // in the comparison.
 func EquivalentMatch(v1, v2 interface{}, options ...ContainsOption) Match {
@@ -396,23 +1787,58 @@ type containsCtx struct {
 	currentPath []string // path to current location in tree
 	explain     bool     // if true, set mismatchMsg to string explaining reason for match failure
 	equiv       bool     // if true, check that v1 and v2 are equivalent, not just that v1 contains v2
+	template    bool     // if true (along with equiv), allow v1 maps to have keys which aren't in v2
+	exactKeys   bool     // if true, don't allow v1 maps to have keys which aren't in v2, even if not equiv
 
 	strBuf []string // re-usable scratch space
 
 	// options
-	stringContains   bool          // when comparing strings, allow a match when v1 contains v2
-	matchEmptyValues bool          // allow a match when v2 is either nil, or the zero value of the same type as v1
-	trace            *string       // when not-nil and when the match fails, assign the pointer to the value of containsCtx.Match.Message
-	roundTimes       time.Duration // round times to the nearest increment
-	truncateTimes    time.Duration // truncate times (round down) to the nearest increment
-	timeDelta        time.Duration // allow times to match as long as they are within this delta
-	ignoreTimeZone   bool          // allow times to match even if time zones are different
+	stringContains   bool            // when comparing strings, allow a match when v1 contains v2
+	numberAsString   bool            // with stringContains, allow a match when the string form of a v1 number contains v2
+	caseInsensitive  bool            // compare strings ignoring case
+	matchEmptyValues bool            // allow a match when v2 is either nil, or the zero value of the same type as v1
+	trace            *string         // when not-nil and when the match fails, assign the pointer to the value of containsCtx.Match.Message
+	traceInfo        *TraceInfo      // when not-nil, assign the pointer to the parts of containsCtx.Match.Message
+	reason           string          // the reason for the mismatch, without the values
+	roundTimes       time.Duration   // round times to the nearest increment
+	truncateTimes    time.Duration   // truncate times (round down) to the nearest increment
+	timeDelta        time.Duration   // allow times to match as long as they are within this delta
+	ignoreTimeZone   bool            // allow times to match even if time zones are different
+	parseDurations   bool            // compare duration strings to each other, and to numbers of nanoseconds
+	durationDelta    time.Duration   // allow durations to match as long as they are within this delta
+	vectorSlices     bool            // compare slices positionally, allowing numbers to differ by vectorDelta
+	vectorDelta      float64         // max difference between numeric elements when vectorSlices is set
+	floatDelta       float64         // allow numbers to match as long as they are within this delta
+	orderedSlices    bool            // compare slices positionally
+	decodeBase64     bool            // compare base64 strings to byte arrays by decoding the string
+	ignoreKeys       map[string]bool // map keys to skip on both sides, at any depth
+	pointerPaths     bool            // format trace paths as JSON Pointers
+	emptyIsAbsent    bool            // treat nil, empty slices, empty maps, and absent keys as the same
+	traceClosest     bool            // when a slice doesn't contain a value, trace the closest element
+	flatten          bool            // flatten nested maps into dotted keys before comparing
+	collectAll       bool            // when explaining, keep comparing after a mismatch, and collect all of them
+	mismatchPaths    []Path          // with collectAll, the path of each of the Mismatches, for sorting them
+
+	allowExtraKeysUnder []Path      // in Equivalent, paths where v1 may have extra keys
+	onlyKeys            *projection // only compare the values at these paths
+
+	comparator func(path string, v1, v2 interface{}) (matched, handled bool) // custom comparison, called before the defaults
+
+	parallel int // number of goroutines to search slices with
+
+	cancelCtx context.Context // when not-nil, stop comparing when it's cancelled
+	cancelErr error           // the error which stopped the comparison, from cancelCtx or a cycle
+	steps     int             // number of comparisons since cancelCtx was checked
+
+	containing []containsFrame   // the maps and slices being compared, from the root down
+	comparing  map[[2]visit]bool // pairs of maps and slices being compared, once nested more than startDetectingCyclesAfter deep
 
 	buf strings.Builder // scratch space for constructing trace messages
 	NormalizeOptions
 }
 
 func (c *containsCtx) release() {
+	c.Matches = false
 	c.V1 = nil
 	c.V2 = nil
 	c.Path = ""
@@ -421,18 +1847,45 @@ func (c *containsCtx) release() {
 	c.explain = false
 	c.Error = nil
 	c.equiv = false
+	c.template = false
+	c.exactKeys = false
 	c.strBuf = c.strBuf[:0]
 	c.stringContains = false
+	c.numberAsString = false
+	c.caseInsensitive = false
 	c.trace = nil
+	c.traceInfo = nil
+	c.reason = ""
 	c.matchEmptyValues = false
 	c.timeDelta = 0
 	c.roundTimes = 0
 	c.truncateTimes = 0
 	c.ignoreTimeZone = false
-	c.NormalizeOptions.NormalizeTime = false
-	c.NormalizeOptions.Copy = false
-	c.NormalizeOptions.Deep = false
-	c.NormalizeOptions.Marshal = false
+	c.parseDurations = false
+	c.durationDelta = 0
+	c.vectorSlices = false
+	c.decodeBase64 = false
+	c.ignoreKeys = nil
+	c.pointerPaths = false
+	c.emptyIsAbsent = false
+	c.traceClosest = false
+	c.flatten = false
+	c.allowExtraKeysUnder = nil
+	c.onlyKeys = nil
+	c.vectorDelta = 0
+	c.floatDelta = 0
+	c.orderedSlices = false
+	c.comparator = nil
+	c.parallel = 0
+	c.cancelCtx = nil
+	c.cancelErr = nil
+	c.steps = 0
+	c.containing = c.containing[:0]
+	c.comparing = nil
+	c.collectAll = false
+	c.Mismatches = nil
+	c.mismatchPaths = nil
+	c.NormalizeOptions = NormalizeOptions{}
 	c.buf.Reset()
 	ctxPool.Put(c)
 }
@@ -443,7 +1896,7 @@ func init() {
 	ctxPool.New = func() any {
 		return &containsCtx{
 			strBuf:      make([]string, 0, 20),
-			currentPath: make([]string, 10),
+			currentPath: make([]string, 0, 10),
 		}
 	}
 }
@@ -456,25 +1909,268 @@ func (c *containsCtx) strScratch() []string {
 }
 
 func (c *containsCtx) traceMsg(v1, v2 interface{}, msg string, msgArgs ...any) {
-	if !c.explain {
+	if !c.explain || c.cancelErr != nil {
+		// a cancelled comparison replaces the message with the error
 		return
 	}
 
-	c.Path = strings.TrimPrefix(strings.Join(c.currentPath, ""), ".")
+	var path string
+	if c.pointerPaths {
+		path = c.pointerPath()
+	} else {
+		path = strings.TrimPrefix(strings.Join(c.currentPath, ""), ".")
+	}
 
+	start := c.buf.Len()
 	_, _ = fmt.Fprintf(&c.buf, msg, msgArgs...)
-	if len(c.Path) > 0 {
-		_, _ = fmt.Fprintf(&c.buf, "\nv1.%s -> %#v\nv2.%s -> %#v", c.Path, v1, c.Path, v2)
-	} else {
-		_, _ = fmt.Fprintf(&c.buf, "\nv1 -> %#v\nv2 -> %#v", v1, v2)
+	reason := c.buf.String()[start:]
+	f1, f2 := printable(v1), printable(v2)
+	switch {
+	case c.pointerPaths:
+		_, _ = fmt.Fprintf(&c.buf, "\nv1%s -> %#v\nv2%s -> %#v", path, f1, path, f2)
+	case len(path) > 0:
+		_, _ = fmt.Fprintf(&c.buf, "\nv1.%s -> %#v\nv2.%s -> %#v", path, f1, path, f2)
+	default:
+		_, _ = fmt.Fprintf(&c.buf, "\nv1 -> %#v\nv2 -> %#v", f1, f2)
 	}
 
+	if c.collectAll {
+		// the Match fields are set from the first mismatch when the match is done
+		c.Mismatches = append(c.Mismatches, Mismatch{Path: path, V1: v1, V2: v2, Message: c.buf.String(), Reason: reason})
+		c.mismatchPaths = append(c.mismatchPaths, c.elemPath())
+		c.buf.Reset()
+		return
+	}
+
+	c.Path = path
 	c.Message = c.buf.String()
+	c.reason = reason
 
 	c.V1 = v1
 	c.V2 = v2
 }
 
+// cyclicValue stands in for a value which contains itself in trace messages, since
+// fmt would recurse forever printing it.
+type cyclicValue struct {
+	t reflect.Type
+}
+
+// GoString implements fmt.GoStringer.
+func (c cyclicValue) GoString() string {
+	return c.t.String() + "{<cycle>}"
+}
+
+// printable returns v, or a cyclicValue if v contains itself.
+func printable(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		// fmt only follows a pointer at the top level
+		rv = rv.Elem()
+	}
+	if hasCycle(rv, map[visit]bool{}) {
+		return cyclicValue{t: reflect.TypeOf(v)}
+	}
+	return v
+}
+
+// hasCycle returns true if rv contains a map or slice which contains itself.  Like
+// fmt, it doesn't follow pointers.
+func hasCycle(rv reflect.Value, visiting map[visit]bool) bool {
+	key, ok := visitOf(rv)
+	if ok {
+		if visiting[key] {
+			return true
+		}
+		visiting[key] = true
+		defer delete(visiting, key)
+	}
+	switch rv.Kind() {
+	case reflect.Interface:
+		return hasCycle(rv.Elem(), visiting)
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if hasCycle(iter.Key(), visiting) || hasCycle(iter.Value(), visiting) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if hasCycle(rv.Index(i), visiting) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if hasCycle(rv.Field(i), visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pointerPath formats currentPath as an RFC 6901 JSON Pointer.
+func (c *containsCtx) pointerPath() string {
+	var sb strings.Builder
+	for i := 0; i < len(c.currentPath); i++ {
+		sb.WriteString("/")
+		if elem := c.currentPath[i]; elem == "." {
+			// map keys are pushed as a "." followed by the key
+			i++
+			sb.WriteString(jsonPointerEscaper.Replace(c.currentPath[i]))
+		} else {
+			// slice indexes are pushed as "[i]"
+			sb.WriteString(strings.Trim(elem, "[]"))
+		}
+	}
+	return sb.String()
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// elemPath returns currentPath as a Path.
+func (c *containsCtx) elemPath() Path {
+	var p Path
+	for i := 0; i < len(c.currentPath); i++ {
+		if elem := c.currentPath[i]; elem == "." {
+			// map keys are pushed as a "." followed by the key
+			i++
+			p = append(p, c.currentPath[i])
+		} else {
+			idx, _ := strconv.Atoi(strings.Trim(elem, "[]"))
+			p = append(p, idx)
+		}
+	}
+	return p
+}
+
+// wrapNormalizeError adds the current path to an error from normalizing the
+// value at that path.
+func (c *containsCtx) wrapNormalizeError(err error) error {
+	if len(c.currentPath) == 0 {
+		return err
+	}
+	return prependNormalizePath(err, c.elemPath()...)
+}
+
+// setTrace sets the values of the Trace and TraceStruct options, if they were used.
+func (c *containsCtx) setTrace() {
+	if c.trace != nil {
+		*c.trace = c.Message
+	}
+	if c.traceInfo != nil {
+		*c.traceInfo = TraceInfo{Path: c.Path, Reason: c.reason, V1: c.V1, V2: c.V2}
+	}
+}
+
+// cancelCheckInterval is how many comparisons are made between checks of the context
+// passed to ContainsContext.
+const cancelCheckInterval = 256
+
+// cancelled returns true if the context passed to ContainsContext has been cancelled.
+func (c *containsCtx) cancelled() bool {
+	if c.cancelErr == nil {
+		c.steps++
+		if c.steps < cancelCheckInterval {
+			return false
+		}
+		c.steps = 0
+		if c.cancelErr = c.cancelCtx.Err(); c.cancelErr == nil {
+			return false
+		}
+	}
+	c.Error = c.cancelErr
+	return true
+}
+
+// containsFrame is a pair of maps or slices being compared.  v1 and v2 are the values
+// before they were normalized, since normalizing may make new maps and slices.
+type containsFrame struct {
+	v1, v2  interface{}
+	pathLen int // the length of currentPath when the frame was entered
+	key     [2]visit
+	tracked bool // true if key was added to comparing
+}
+
+// enter records that v1 and v2 are about to be compared, before descending into them.
+// Once they are nested more than startDetectingCyclesAfter deep, it also checks whether
+// the same pair is already being compared, which would recurse forever.  If it is,
+// enter stops the comparison with a CycleDetectedError and returns false.  Otherwise,
+// leave must be called when the comparison is done.
+func (c *containsCtx) enter(v1, v2 interface{}) bool {
+	f := containsFrame{v1: v1, v2: v2, pathLen: len(c.currentPath)}
+	if len(c.containing) >= startDetectingCyclesAfter {
+		k1, ok1 := visitOf(reflect.ValueOf(v1))
+		k2, ok2 := visitOf(reflect.ValueOf(v2))
+		if ok1 && ok2 {
+			f.key = [2]visit{k1, k2}
+			if c.comparing[f.key] {
+				c.stopAtCycle()
+				return false
+			}
+			if c.comparing == nil {
+				c.comparing = map[[2]visit]bool{}
+			}
+			c.comparing[f.key] = true
+			f.tracked = true
+		}
+	}
+	c.containing = append(c.containing, f)
+	return true
+}
+
+func (c *containsCtx) leave() {
+	last := len(c.containing) - 1
+	if f := c.containing[last]; f.tracked {
+		delete(c.comparing, f.key)
+	}
+	// don't hold on to the values
+	c.containing[last] = containsFrame{}
+	c.containing = c.containing[:last]
+}
+
+// stopAtCycle stops the comparison with a CycleDetectedError.  The error's path ends at
+// the first pair of maps or slices which repeats, rather than where the cycle was
+// detected.
+func (c *containsCtx) stopAtCycle() {
+	cut := len(c.currentPath)
+	seen := map[[2]visit]bool{}
+	for _, f := range c.containing {
+		k1, ok1 := visitOf(reflect.ValueOf(f.v1))
+		k2, ok2 := visitOf(reflect.ValueOf(f.v2))
+		if !ok1 || !ok2 {
+			continue
+		}
+		key := [2]visit{k1, k2}
+		if seen[key] {
+			cut = f.pathLen
+			break
+		}
+		seen[key] = true
+	}
+	path := c.currentPath
+	c.currentPath = c.currentPath[:cut]
+	c.cancelErr = c.wrapNormalizeError(CycleDetectedError.Here().WithMessage("encountered a cycle"))
+	c.currentPath = path
+	c.Error = c.cancelErr
+}
+
+// collecting returns true if comparison should continue after a mismatch.  See CollectAll.
+func (c *containsCtx) collecting() bool {
+	return c.collectAll && c.explain && c.Error == nil
+}
+
+// tracedSince returns true if a mismatch was traced since mark, which was the
+// number of collected mismatches at the time.
+func (c *containsCtx) tracedSince(mark int) bool {
+	if c.collectAll {
+		return len(c.Mismatches) > mark
+	}
+	return c.Message != ""
+}
+
 func (c *containsCtx) traceNotEqual(v1, v2 interface{}) {
 	c.traceMsg(v1, v2, "values are not equal")
 }
@@ -515,6 +2211,103 @@ func compareTimes(tm1, tm2 time.Time, ctx *containsCtx) bool {
 	return true
 }
 
+// asDurations converts v1 and v2 to durations, if one is a duration string, and the other is
+// a duration string or a number of nanoseconds.  See ParseDurations.
+func asDurations(v1, v2 interface{}) (d1, d2 time.Duration, ok bool) {
+	_, isStr1 := v1.(string)
+	_, isStr2 := v2.(string)
+	if !isStr1 && !isStr2 {
+		return 0, 0, false
+	}
+	var ok1, ok2 bool
+	d1, ok1 = asDuration(v1)
+	d2, ok2 = asDuration(v2)
+	return d1, d2, ok1 && ok2
+}
+
+func asDuration(v interface{}) (time.Duration, bool) {
+	if s, ok := v.(string); ok {
+		d, err := time.ParseDuration(s)
+		return d, err == nil
+	}
+	switch kind, i, u, f := asNumber(v); kind {
+	case signedNumber:
+		return time.Duration(i), true
+	case unsignedNumber:
+		return time.Duration(u), u <= math.MaxInt64
+	case floatNumber:
+		return time.Duration(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	}
+	return 0, false
+}
+
+func compareDurations(d1, d2 time.Duration, ctx *containsCtx) bool {
+	delta := d1 - d2
+	if delta < 0 {
+		delta *= -1
+	}
+	if delta > ctx.durationDelta {
+		if ctx.durationDelta > 0 {
+			ctx.traceMsg(d1.String(), d2.String(), `delta of %v exceeds %v`, delta, ctx.durationDelta)
+		} else {
+			ctx.traceNotEqual(d1.String(), d2.String())
+		}
+		return false
+	}
+	return true
+}
+
+// extraKeysAllowed returns true if the current path is at or below one of
+// the paths passed to AllowExtraKeysUnder.
+func (c *containsCtx) extraKeysAllowed() bool {
+	for _, p := range c.allowExtraKeysUnder {
+		if c.isUnder(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *containsCtx) isUnder(p Path) bool {
+	i := 0
+	for j := 0; j < len(c.currentPath) && i < len(p); j++ {
+		if _, ok := p[i].(EachElement); ok && c.currentPath[j] == "." {
+			// unordered slice matching doesn't record the index of
+			// slice elements in the current path
+			j--
+		} else if c.currentPath[j] == "." {
+			j++
+			switch t := p[i].(type) {
+			case Wildcard:
+			case string:
+				if t != c.currentPath[j] {
+					return false
+				}
+			default:
+				return false
+			}
+		} else {
+			switch t := p[i].(type) {
+			case EachElement, Wildcard:
+			case int:
+				if c.currentPath[j] != "["+strconv.Itoa(t)+"]" {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+		i++
+	}
+	for i < len(p) {
+		if _, ok := p[i].(EachElement); !ok {
+			break
+		}
+		i++
+	}
+	return i == len(p)
+}
+
 func dive(path string, v1, v2 interface{}, ctx *containsCtx) bool {
 	ctx.currentPath = append(ctx.currentPath, ".", path)
 	b1 := contains(v1, v2, ctx)
@@ -522,29 +2315,98 @@ func dive(path string, v1, v2 interface{}, ctx *containsCtx) bool {
 	return b1
 }
 
+func diveIndex(i int, v1, v2 interface{}, ctx *containsCtx) bool {
+	ctx.currentPath = append(ctx.currentPath, "["+strconv.Itoa(i)+"]")
+	b1 := contains(v1, v2, ctx)
+	ctx.currentPath = ctx.currentPath[:len(ctx.currentPath)-1]
+	return b1
+}
+
 func contains(v1, v2 interface{}, ctx *containsCtx) (b bool) {
+	if (ctx.cancelCtx != nil || ctx.cancelErr != nil) && ctx.cancelled() {
+		return false
+	}
+	mark := len(ctx.Mismatches)
+	if _, ok := v2.(matcher); !ok {
+		if match, handled := compareRegistered(v1, v2); handled {
+			if !match {
+				ctx.traceNotEqual(v1, v2)
+			}
+			return match
+		}
+	}
+	if !hasComparers() && ctx.comparator == nil {
+		// compare numbers without normalizing them to float64, so large integers
+		// are compared exactly
+		k1, _, _, _ := asNumber(v1)
+		k2, _, _, _ := asNumber(v2)
+		if k1 != notNumber && k2 != notNumber {
+			match := containsNormalized(v1, v2, ctx)
+			if !match && !ctx.tracedSince(mark) {
+				ctx.traceNotEqual(v1, v2)
+			}
+			return match
+		}
+	}
 	var nv1, nv2 interface{}
 	nv1, ctx.Error = normalize(v1, &ctx.NormalizeOptions)
 	if ctx.Error != nil {
+		ctx.Error = ctx.wrapNormalizeError(ctx.Error)
 		ctx.traceMsg(v1, v2, "err normalizing v1: %s", ctx.Error.Error())
 		return false
 	}
+	if m, ok := v2.(matcher); ok {
+		return m.match(nv1, ctx)
+	}
 	nv2, ctx.Error = normalize(v2, &ctx.NormalizeOptions)
 	if ctx.Error != nil {
+		ctx.Error = ctx.wrapNormalizeError(ctx.Error)
 		ctx.traceMsg(v1, v2, "err normalizing v2: %s", ctx.Error.Error())
 		return false
 	}
+	if hasComparers() && (reflect.TypeOf(nv1) != reflect.TypeOf(v1) || reflect.TypeOf(nv2) != reflect.TypeOf(v2)) {
+		if match, handled := compareRegistered(nv1, nv2); handled {
+			if !match {
+				ctx.traceNotEqual(v1, v2)
+			}
+			return match
+		}
+	}
+	descend := isContainer(nv1) && isContainer(nv2)
+	if descend && !ctx.enter(v1, v2) {
+		return false
+	}
 	match := containsNormalized(nv1, nv2, ctx)
-	if !match && ctx.Message == "" && ctx.Error == nil {
+	if descend {
+		ctx.leave()
+	}
+	if !match && !ctx.tracedSince(mark) && ctx.Error == nil {
 		ctx.traceNotEqual(v1, v2)
 	}
 	return match
 }
 
 func containsNormalized(v1, v2 interface{}, ctx *containsCtx) (b bool) {
+	if ctx.comparator != nil {
+		path := strings.TrimPrefix(strings.Join(ctx.currentPath, ""), ".")
+		if matched, handled := ctx.comparator(path, v1, v2); handled {
+			if !matched {
+				ctx.traceNotEqual(v1, v2)
+			}
+			return matched
+		}
+	}
 	if ctx.matchEmptyValues && v2 == nil {
 		return true
 	}
+	if ctx.emptyIsAbsent && isEmptyContainer(v1) && isEmptyContainer(v2) {
+		return true
+	}
+	if ctx.parseDurations {
+		if d1, d2, ok := asDurations(v1, v2); ok {
+			return compareDurations(d1, d2, ctx)
+		}
+	}
 
 	switch t1 := v1.(type) {
 	case time.Time:
@@ -562,23 +2424,61 @@ func containsNormalized(v1, v2 interface{}, ctx *containsCtx) (b bool) {
 
 		s2, ok := v2.(string)
 		if !ok {
+			if t2, isSlice := v2.([]interface{}); isSlice && ctx.decodeBase64 {
+				return base64Match(t1, t2, v1, v2, ctx)
+			}
 			return false
 		}
 
 		if ctx.stringContains {
+			if ctx.caseInsensitive {
+				if !strings.Contains(strings.ToLower(t1), strings.ToLower(s2)) {
+					ctx.traceMsg(v1, v2, `v1 does not contain v2, ignoring case`)
+					return false
+				}
+				return true
+			}
 			if !strings.Contains(t1, s2) {
 				ctx.traceMsg(v1, v2, `v1 does not contain v2`)
 				return false
 			}
 			return true
 		}
-		return false
+		return ctx.caseInsensitive && strings.EqualFold(t1, s2)
 	case bool:
 		return v1 == v2 || (ctx.matchEmptyValues && v2 == false)
 	case nil:
 		return v2 == nil
-	case float64:
-		return v1 == v2 || (ctx.matchEmptyValues && v2 == float64(0))
+	case float64, float32, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, json.Number:
+		if s2, ok := v2.(string); ok && ctx.numberAsString && ctx.stringContains {
+			if !strings.Contains(formatNumber(v1), s2) {
+				ctx.traceMsg(v1, v2, `v1 does not contain v2`)
+				return false
+			}
+			return true
+		}
+		cmp, ok := compareNumbers(v1, v2)
+		if !ok {
+			return false
+		}
+		if cmp == 0 {
+			return true
+		}
+		if ctx.matchEmptyValues {
+			// v2 is a number, so it's only empty if it equals zero
+			if zero, _ := compareNumbers(v2, 0); zero == 0 {
+				return true
+			}
+		}
+		if ctx.floatDelta > 0 {
+			// written so NaNs never match
+			if delta := math.Abs(asFloat(v1) - asFloat(v2)); !(delta <= ctx.floatDelta) {
+				ctx.traceMsg(v1, v2, `delta of %v exceeds %v`, delta, ctx.floatDelta)
+				return false
+			}
+			return true
+		}
+		return false
 	case map[string]interface{}:
 		t2, ok := v2.(map[string]interface{})
 		if !ok {
@@ -590,27 +2490,45 @@ func containsNormalized(v1, v2 interface{}, ctx *containsCtx) (b bool) {
 			return true
 		}
 
+		matched := true
 		extraKeys := ctx.strScratch()
 		for key, val2 := range t2 {
+			if ctx.ignoreKeys[key] {
+				continue
+			}
 			val1, present := t1[key]
 			if !present {
+				if ctx.emptyIsAbsent && isEmptyContainer(val2) {
+					continue
+				}
 				extraKeys = append(extraKeys, key)
 			} else {
 				if !dive(key, val1, val2, ctx) {
-					return false
+					if !ctx.collecting() {
+						return false
+					}
+					matched = false
 				}
 			}
 		}
 		if len(extraKeys) > 0 {
 			sort.Strings(extraKeys)
 			ctx.traceMsg(v1, v2, `v2 contains extra keys: %v`, extraKeys)
-			return false
+			if !ctx.collecting() {
+				return false
+			}
+			matched = false
+			extraKeys = extraKeys[:0]
 		}
-		if ctx.equiv && len(t1) > len(t2) {
+		// if keys are ignored, v1 may have extra keys even if it's not longer than v2
+		if (ctx.equiv && !ctx.template || ctx.exactKeys) && (len(t1) > len(t2) || len(ctx.ignoreKeys) > 0 || ctx.emptyIsAbsent) && !ctx.extraKeysAllowed() {
 			// v1 has extra keys.  collect them and register the mismatch
-			for key := range t1 {
+			for key, val1 := range t1 {
 				_, present := t2[key]
-				if !present {
+				if ctx.emptyIsAbsent && isEmptyContainer(val1) {
+					continue
+				}
+				if !present && !ctx.ignoreKeys[key] {
 					extraKeys = append(extraKeys, key)
 				}
 			}
@@ -620,8 +2538,17 @@ func containsNormalized(v1, v2 interface{}, ctx *containsCtx) (b bool) {
 				return false
 			}
 		}
-		return true
+		return matched
 	case []interface{}:
+		if s2, ok := v2.(string); ok && ctx.decodeBase64 {
+			// only byte arrays are compared to base64 strings.  Other slices may
+			// contain the string.
+			if raw, isBytes := bytesFromSlice(t1); isBytes {
+				if decoded, isBase64 := decodeBase64(s2); isBase64 {
+					return bytesMatch(raw, decoded, v1, v2, ctx)
+				}
+			}
+		}
 		return sliceMatch(t1, v2, ctx)
 	default:
 		// since we normalized both values, we should not hit this.
@@ -629,6 +2556,152 @@ func containsNormalized(v1, v2 interface{}, ctx *containsCtx) (b bool) {
 	}
 }
 
+type numberKind int
+
+const (
+	notNumber numberKind = iota
+	signedNumber
+	unsignedNumber
+	floatNumber
+)
+
+// asNumber classifies a numeric value.  Signed integers are returned in i,
+// unsigned integers in u, and floats in f.
+func asNumber(v interface{}) (kind numberKind, i int64, u uint64, f float64) {
+	switch t := v.(type) {
+	case float64:
+		return floatNumber, 0, 0, t
+	case float32:
+		return floatNumber, 0, 0, float64(t)
+	case int:
+		return signedNumber, int64(t), 0, 0
+	case int8:
+		return signedNumber, int64(t), 0, 0
+	case int16:
+		return signedNumber, int64(t), 0, 0
+	case int32:
+		return signedNumber, int64(t), 0, 0
+	case int64:
+		return signedNumber, t, 0, 0
+	case uint:
+		return unsignedNumber, 0, uint64(t), 0
+	case uint8:
+		return unsignedNumber, 0, uint64(t), 0
+	case uint16:
+		return unsignedNumber, 0, uint64(t), 0
+	case uint32:
+		return unsignedNumber, 0, uint64(t), 0
+	case uint64:
+		return unsignedNumber, 0, t, 0
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return signedNumber, i, 0, 0
+		}
+		if u, err := strconv.ParseUint(string(t), 10, 64); err == nil {
+			return unsignedNumber, 0, u, 0
+		}
+		if f, err := t.Float64(); err == nil {
+			return floatNumber, 0, 0, f
+		}
+	}
+	return notNumber, 0, 0, 0
+}
+
+// formatNumber formats a numeric value of any kind in decimal, without an exponent.
+func formatNumber(v interface{}) string {
+	switch kind, i, u, f := asNumber(v); kind {
+	case signedNumber:
+		return strconv.FormatInt(i, 10)
+	case unsignedNumber:
+		return strconv.FormatUint(u, 10)
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
+
+// asFloat converts a numeric value of any kind to a float64.  Returns 0 if
+// v is not a number.
+func asFloat(v interface{}) float64 {
+	switch kind, i, u, f := asNumber(v); kind {
+	case signedNumber:
+		return float64(i)
+	case unsignedNumber:
+		return float64(u)
+	default:
+		return f
+	}
+}
+
+// compareNumbers compares two numeric values of any kind by value.  It returns
+// -1, 0, or 1 if v1 is less than, equal to, or greater than v2.  ok is false
+// if either value is not a number, or if the values can't be ordered (NaN).
+//
+// Integers are compared as integers, so large int64 and uint64 values don't
+// lose precision.  If either value is a float, both are compared as float64.
+func compareNumbers(v1, v2 interface{}) (cmp int, ok bool) {
+	k1, i1, u1, f1 := asNumber(v1)
+	k2, i2, u2, f2 := asNumber(v2)
+	if k1 == notNumber || k2 == notNumber {
+		return 0, false
+	}
+
+	if k1 == floatNumber || k2 == floatNumber {
+		switch k1 {
+		case signedNumber:
+			f1 = float64(i1)
+		case unsignedNumber:
+			f1 = float64(u1)
+		}
+		switch k2 {
+		case signedNumber:
+			f2 = float64(i2)
+		case unsignedNumber:
+			f2 = float64(u2)
+		}
+		switch {
+		case f1 < f2:
+			return -1, true
+		case f1 > f2:
+			return 1, true
+		case f1 == f2:
+			return 0, true
+		}
+		// at least one is NaN
+		return 0, false
+	}
+
+	// both are integers.  If one is signed and negative, it is less than any
+	// unsigned value.  Otherwise, it can safely be compared as a uint64, which
+	// handles unsigned values larger than math.MaxInt64.
+	switch {
+	case k1 == signedNumber && k2 == signedNumber:
+		switch {
+		case i1 < i2:
+			return -1, true
+		case i1 > i2:
+			return 1, true
+		}
+		return 0, true
+	case k1 == signedNumber:
+		if i1 < 0 {
+			return -1, true
+		}
+		u1 = uint64(i1)
+	case k2 == signedNumber:
+		if i2 < 0 {
+			return 1, true
+		}
+		u2 = uint64(i2)
+	}
+	switch {
+	case u1 < u2:
+		return -1, true
+	case u1 > u2:
+		return 1, true
+	}
+	return 0, true
+}
+
 func sliceMatch(t1 []any, v2 any, ctx *containsCtx) bool {
 	// temporarily turn off explain while searching for matching elements
 	// since the results will be thrown out anyway
@@ -650,12 +2723,23 @@ func sliceMatch(t1 []any, v2 any, ctx *containsCtx) bool {
 				return true
 			}
 		}
+		closest := closestMatch(t1, v2, explain, ctx)
 		ctx.explain = explain
-		ctx.traceMsg(t1, v2, `v1 does not contain v2`)
+		ctx.traceMsg(t1, v2, `v1 does not contain v2%s`, closest)
 		return false
 	case []interface{}:
-		if ctx.equiv && len(t1) != len(t2) {
-			// if equiv, both slices should be the same length
+		if ctx.vectorSlices {
+			ctx.explain = explain
+			return vectorMatch(t1, t2, ctx)
+		}
+
+		if ctx.orderedSlices {
+			ctx.explain = explain
+			return orderedMatch(t1, t2, ctx)
+		}
+
+		if ctx.equiv && len(t1) != len(t2) {
+			// if equiv, both slices should be the same length
 			ctx.explain = explain
 			ctx.traceMsg(t1, v2, `v1 len %v is not the same as v2 len %v`, len(t1), len(t2))
 			return false
@@ -665,6 +2749,13 @@ func sliceMatch(t1 []any, v2 any, ctx *containsCtx) bool {
 			return true
 		}
 
+		if len(t1) >= hashMatchMinLen && ctx.canHashMatch() {
+			if matched, ok := hashMatch(t1, t2, ctx.equiv); ok && (matched || !explain) {
+				return matched
+			}
+			// fall back to searching, to explain the mismatch
+		}
+
 		// in equiv mode, keep track of which members of v1 were already matched
 		// to v2 values.  We can skip those when we scan v1.
 		var bits uint64
@@ -672,22 +2763,45 @@ func sliceMatch(t1 []any, v2 any, ctx *containsCtx) bool {
 		if len(t1) > 64 && ctx.equiv {
 			bitmap = make(map[int]bool)
 		}
+
+		// in equiv mode, when explaining, collect all the unmatched elements
+		// from both sides, and report the mismatch as a set difference.
+		collect := ctx.equiv && explain
+		var notInV1, notInV2 []interface{}
+
+		// with the Parallel option, search for all the v2 elements up front
+		var found []int
+		if ctx.parallel > 1 && len(t2) > 1 {
+			found = parallelSearch(t1, t2, ctx)
+		}
 	Searchv2:
 		for i, val2 := range t2 {
-			for i1, value := range t1 {
-				if contains(value, val2, ctx) {
-					if ctx.equiv {
-						if bitmap != nil {
-							bitmap[i1] = true
-						} else {
-							bits |= 1 << i1
-						}
+			var i1 int
+			if found != nil {
+				i1 = found[i]
+			} else {
+				i1 = searchSlice(t1, val2, ctx)
+			}
+			if i1 >= 0 {
+				if ctx.equiv {
+					if bitmap != nil {
+						bitmap[i1] = true
+					} else {
+						bits |= 1 << i1
 					}
-					continue Searchv2
 				}
+				continue Searchv2
 			}
+			if ctx.cancelErr != nil {
+				return false
+			}
+			if collect {
+				notInV1 = append(notInV1, val2)
+				continue Searchv2
+			}
+			closest := closestMatch(t1, val2, explain, ctx)
 			ctx.explain = explain
-			ctx.traceMsg(t1, v2, `v1 does not contain v2[%v]: "%+v"`, i, val2)
+			ctx.traceMsg(t1, v2, `v1 does not contain v2[%v]: "%+v"%s`, i, val2, closest)
 			return false
 		}
 
@@ -711,13 +2825,409 @@ func sliceMatch(t1 []any, v2 any, ctx *containsCtx) bool {
 						continue Searchv1
 					}
 				}
+				if collect {
+					notInV2 = append(notInV2, val1)
+					continue Searchv1
+				}
 				ctx.explain = explain
 				ctx.traceMsg(t1, v2, `v2 does not contain v1[%v]:"%+v"`, i, val1)
 				return false
 			}
 		}
+
+		if len(notInV1) > 0 || len(notInV2) > 0 {
+			ctx.explain = explain
+			var diffs []string
+			if len(notInV1) > 0 {
+				diffs = append(diffs, fmt.Sprintf(`v2 has elements not in v1: %+v`, notInV1))
+			}
+			if len(notInV2) > 0 {
+				diffs = append(diffs, fmt.Sprintf(`v1 has elements not in v2: %+v`, notInV2))
+			}
+			ctx.traceMsg(t1, v2, "%s", strings.Join(diffs, "\n"))
+			return false
+		}
+		return true
+	}
+}
+
+// hashMatchMinLen is the length of v1 slices at which hashMatch is faster than searching.
+const hashMatchMinLen = 16
+
+// canHashMatch returns true if the options are compatible with hashMatch, i.e., if
+// primitive values only match when they are equal.
+func (c *containsCtx) canHashMatch() bool {
+	return !c.stringContains && !c.caseInsensitive && !c.matchEmptyValues && c.floatDelta == 0 &&
+		!c.decodeBase64 && c.comparator == nil && !c.NormalizeTime && !c.parseDurations && !hasComparers()
+}
+
+// hashMatch compares slices of strings, float64s, bools, and nils by building sets of
+// their elements, rather than comparing each pair of elements.  The result is the same
+// as sliceMatch: slices with the same elements match, regardless of order or how many times
+// each element occurs.  ok is false if either slice has elements of other types.
+func hashMatch(t1, t2 []interface{}, equiv bool) (matched, ok bool) {
+	set1 := make(map[interface{}]struct{}, len(t1))
+	for _, v := range t1 {
+		if !isHashable(v) {
+			return false, false
+		}
+		set1[v] = struct{}{}
+	}
+	var set2 map[interface{}]struct{}
+	if equiv {
+		set2 = make(map[interface{}]struct{}, len(t2))
+	}
+	matched = true
+	for _, v := range t2 {
+		if !isHashable(v) {
+			return false, false
+		}
+		if _, found := set1[v]; !found {
+			// keep going, in case a later element isn't hashable
+			matched = false
+		}
+		if equiv {
+			set2[v] = struct{}{}
+		}
+	}
+	if matched && equiv {
+		// each element of v2 is in v1, and both have the same number of distinct elements
+		matched = len(set1) == len(set2)
+	}
+	return matched, true
+}
+
+func isHashable(v interface{}) bool {
+	switch v.(type) {
+	case string, float64, bool, nil:
+		return true
+	}
+	return false
+}
+
+// searchSlice returns the index of the first element of t1 which contains v2, or -1.
+func searchSlice(t1 []interface{}, v2 interface{}, ctx *containsCtx) int {
+	for i1, value := range t1 {
+		if contains(value, v2, ctx) {
+			return i1
+		}
+	}
+	return -1
+}
+
+// parallelSearch calls searchSlice for each element of t2, spread across ctx.parallel
+// goroutines.  Returns the result for each element.  Each goroutine uses its own copy of
+// ctx.  If any are cancelled, ctx is too.  If an element isn't found, ctx.Error is set to
+// the error, if any, from searching for it.
+func parallelSearch(t1, t2 []interface{}, ctx *containsCtx) []int {
+	found := make([]int, len(t2))
+	errs := make([]error, len(t2))
+	workers := ctx.parallel
+	if workers > len(t2) {
+		workers = len(t2)
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	subs := make([]*containsCtx, workers)
+	for w := range subs {
+		subs[w] = ctx.fork()
+		wg.Add(1)
+		go func(sub *containsCtx) {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(t2) {
+					return
+				}
+				sub.Error = nil
+				found[i] = searchSlice(t1, t2[i], sub)
+				errs[i] = sub.Error
+			}
+		}(subs[w])
+	}
+	wg.Wait()
+
+	for _, sub := range subs {
+		if sub.cancelErr != nil {
+			ctx.cancelErr = sub.cancelErr
+			ctx.Error = sub.cancelErr
+		}
+		sub.release()
+	}
+	for i, i1 := range found {
+		if i1 < 0 {
+			ctx.Error = errs[i]
+			break
+		}
+	}
+	return found
+}
+
+// fork returns a copy of ctx's options, for comparing values concurrently with ctx.  The
+// copy doesn't explain mismatches, and should be released when done.
+func (c *containsCtx) fork() *containsCtx {
+	sub := newCtx()
+	strBuf, currentPath := sub.strBuf, sub.currentPath
+	*sub = containsCtx{
+		equiv:               c.equiv,
+		template:            c.template,
+		exactKeys:           c.exactKeys,
+		stringContains:      c.stringContains,
+		numberAsString:      c.numberAsString,
+		caseInsensitive:     c.caseInsensitive,
+		matchEmptyValues:    c.matchEmptyValues,
+		roundTimes:          c.roundTimes,
+		truncateTimes:       c.truncateTimes,
+		timeDelta:           c.timeDelta,
+		ignoreTimeZone:      c.ignoreTimeZone,
+		parseDurations:      c.parseDurations,
+		durationDelta:       c.durationDelta,
+		vectorSlices:        c.vectorSlices,
+		vectorDelta:         c.vectorDelta,
+		floatDelta:          c.floatDelta,
+		orderedSlices:       c.orderedSlices,
+		decodeBase64:        c.decodeBase64,
+		ignoreKeys:          c.ignoreKeys,
+		emptyIsAbsent:       c.emptyIsAbsent,
+		allowExtraKeysUnder: c.allowExtraKeysUnder,
+		comparator:          c.comparator,
+		cancelCtx:           c.cancelCtx,
+		NormalizeOptions:    c.NormalizeOptions,
+	}
+	sub.strBuf = strBuf
+	sub.currentPath = append(currentPath, c.currentPath...)
+	// the frames are copied so cycle errors can be cut at the first repeat, but the
+	// fork only checks for repeats of the pairs it compares itself
+	sub.containing = append(sub.containing, c.containing...)
+	// the depth and cycle tracking in NormalizeOptions are per goroutine
+	sub.visiting = nil
+	return sub
+}
+
+// base64Match compares the base64 string s to the byte array b.  v1
+// and v2 are the original values, for tracing.
+func base64Match(s string, b []interface{}, v1, v2 interface{}, ctx *containsCtx) bool {
+	raw, ok := bytesFromSlice(b)
+	if !ok {
+		ctx.traceMsg(v1, v2, `slice is not a byte array`)
+		return false
+	}
+	decoded, ok := decodeBase64(s)
+	if !ok {
+		ctx.traceMsg(v1, v2, `string is not valid base64`)
+		return false
+	}
+	return bytesMatch(raw, decoded, v1, v2, ctx)
+}
+
+// bytesMatch compares raw, from a byte array, to the decoded bytes of a base64 string.
+func bytesMatch(raw, decoded []byte, v1, v2 interface{}, ctx *containsCtx) bool {
+	if !bytes.Equal(raw, decoded) {
+		ctx.traceMsg(v1, v2, `decoded base64 bytes are not equal`)
+		return false
+	}
+	return true
+}
+
+// bytesFromSlice converts a normalized slice of numbers into bytes.  Returns
+// false if any element is not an integer between 0 and 255.
+func bytesFromSlice(s []interface{}) ([]byte, bool) {
+	b := make([]byte, len(s))
+	for i, el := range s {
+		f := asFloat(el)
+		if kind, _, _, _ := asNumber(el); kind == notNumber || f < 0 || f > 255 || f != math.Trunc(f) {
+			return nil, false
+		}
+		b[i] = byte(f)
+	}
+	return b, true
+}
+
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding.Strict(),
+	base64.RawStdEncoding.Strict(),
+	base64.URLEncoding.Strict(),
+	base64.RawURLEncoding.Strict(),
+}
+
+func decodeBase64(s string) ([]byte, bool) {
+	for _, enc := range base64Encodings {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+func flattenForCompare(v interface{}, ctx *containsCtx) (interface{}, error) {
+	opts := FlattenOptions{NormalizeOptions: ctx.NormalizeOptions, Separator: "."}
+	opts.Copy, opts.Deep = false, false
+	f := flattener{opts: &opts, compare: true, out: map[string]interface{}{}}
+	if err := f.flatten(v, nil); err != nil {
+		return nil, err
+	}
+	if leaf, ok := f.out[""]; ok && len(f.out) == 1 {
+		// v was a leaf
+		return leaf, nil
+	}
+	return f.out, nil
+}
+
+// closestMatch finds the element of t1 which matches the most leaves of v2, and
+// returns a description of how it differs from v2, for the trace.  Returns "" unless
+// explaining with the TraceClosestMatch option.
+func closestMatch(t1 []interface{}, v2 interface{}, explain bool, ctx *containsCtx) string {
+	if !explain || !ctx.traceClosest || len(t1) == 0 {
+		return ""
+	}
+
+	best, bestScore := 0, -1
+	for i, el1 := range t1 {
+		if score := matchScore(el1, v2, ctx); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	// explain the mismatch with the closest element, with paths relative to the element.
+	// The trace hasn't been written yet, so it's safe to use the ctx's trace buffer.
+	path, collectAll := ctx.currentPath, ctx.collectAll
+	ctx.currentPath = nil
+	ctx.explain = true
+	ctx.collectAll = false
+	contains(t1[best], v2, ctx)
+	msg := ctx.Message
+	ctx.currentPath = path
+	ctx.explain = false
+	ctx.collectAll = collectAll
+	ctx.Message, ctx.Path, ctx.V1, ctx.V2, ctx.Error = "", "", nil, nil, nil
+	ctx.buf.Reset()
+
+	return fmt.Sprintf("\nclosest match is v1[%v], which differs:\n  %s", best, strings.ReplaceAll(msg, "\n", "\n  "))
+}
+
+// matchScore counts the leaves of v2 which match the corresponding values in v1.
+func matchScore(v1, v2 interface{}, ctx *containsCtx) int {
+	nv1, err := normalize(v1, &ctx.NormalizeOptions)
+	if err != nil {
+		return 0
+	}
+	nv2, err := normalize(v2, &ctx.NormalizeOptions)
+	if err != nil {
+		return 0
+	}
+	switch t2 := nv2.(type) {
+	case map[string]interface{}:
+		t1, ok := nv1.(map[string]interface{})
+		if !ok {
+			return 0
+		}
+		score := 0
+		for key, val2 := range t2 {
+			if val1, present := t1[key]; present {
+				score += matchScore(val1, val2, ctx)
+			}
+		}
+		return score
+	case []interface{}:
+		score := 0
+		for _, val2 := range t2 {
+			if contains(nv1, val2, ctx) {
+				score++
+			}
+		}
+		return score
+	}
+	if contains(nv1, nv2, ctx) {
+		return 1
+	}
+	return 0
+}
+
+// isContainer returns true if v is a normalized map or slice.
+func isContainer(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+// isEmptyContainer returns true if v is nil, or an empty slice or map.  Map values
+// aren't normalized until they are compared, so v may be any type.
+func isEmptyContainer(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
 		return true
+	case []interface{}:
+		return len(t) == 0
+	case map[string]interface{}:
+		return len(t) == 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice:
+		return rv.Len() == 0
+	case reflect.Ptr:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// orderedMatch compares slices positionally.  In equiv mode, the slices must be the
+// same length.  Otherwise, t2 may be shorter, and is compared to the start of t1.
+func orderedMatch(t1, t2 []interface{}, ctx *containsCtx) bool {
+	if ctx.equiv && len(t1) != len(t2) {
+		ctx.traceMsg(t1, t2, `v1 len %v is not the same as v2 len %v`, len(t1), len(t2))
+		return false
+	}
+	if len(t2) > len(t1) {
+		ctx.traceMsg(t1, t2, `v1 len %v is shorter than v2 len %v`, len(t1), len(t2))
+		return false
+	}
+	matched := true
+	for i := range t2 {
+		if !diveIndex(i, t1[i], t2[i], ctx) {
+			if !ctx.collecting() {
+				return false
+			}
+			matched = false
+		}
+	}
+	return matched
+}
+
+// vectorMatch compares t1 and t2 positionally.  See VectorSlices.
+func vectorMatch(t1, t2 []interface{}, ctx *containsCtx) bool {
+	if len(t1) != len(t2) {
+		ctx.traceMsg(t1, t2, `v1 len %v is not the same as v2 len %v`, len(t1), len(t2))
+		return false
+	}
+	matched := true
+	for i := range t1 {
+		k1, _, _, _ := asNumber(t1[i])
+		k2, _, _, _ := asNumber(t2[i])
+		if k1 == notNumber || k2 == notNumber {
+			if !diveIndex(i, t1[i], t2[i], ctx) {
+				if !ctx.collecting() {
+					return false
+				}
+				matched = false
+			}
+			continue
+		}
+		f1, f2 := asFloat(t1[i]), asFloat(t2[i])
+		// written so NaNs never match
+		if delta := math.Abs(f1 - f2); !(delta <= ctx.vectorDelta) {
+			ctx.currentPath = append(ctx.currentPath, "["+strconv.Itoa(i)+"]")
+			ctx.traceMsg(t1[i], t2[i], `delta of %v at index %v exceeds %v`, delta, i, ctx.vectorDelta)
+			ctx.currentPath = ctx.currentPath[:len(ctx.currentPath)-1]
+			if !ctx.collecting() {
+				return false
+			}
+			matched = false
+		}
 	}
+	return matched
 }
 
 // Conflicts returns true if trees share common key paths, but the values
@@ -744,11 +3254,155 @@ type NormalizeOptions struct {
 
 	// Treat time.Time values as an additional normalized type.  If false, time values are converted
 	// to json's standard string formatted time.  If true, time values are preserved as time.Time, and
-	// string values are coerced to time if they are in the JSON RFC3339 format.
+	// string values are coerced to time if they match one of TimeLayouts.
 	NormalizeTime bool
+
+	// Layouts tried, in order, when coercing strings to time with NormalizeTime.  If empty,
+	// DefaultTimeLayouts is used.  See ParseTimeLayouts.
+	TimeLayouts []string
+
+	// When marshaling proto messages, use the original field names from the .proto file as
+	// map keys, instead of the lowerCamelCase JSON names.
+	UseProtoNames bool
+
+	// If set, used to marshal proto messages, instead of the default options.  See
+	// ProtoMarshalOptions.
+	ProtoMarshalOptions *protojson.MarshalOptions
+
+	// Convert numbers to json.Number instead of float64, so large integers don't lose
+	// precision.  When unmarshaling, the json decoder's UseNumber option is used.
+	NumbersAsJSONNumber bool
+
+	// Leave integer types, like int and uint64, unchanged, instead of converting them to float64.
+	PreserveInts bool
+
+	// Maximum nesting depth of maps and slices, when Deep is set.  See MaxDepth.
+	MaxDepth int
+
+	// Convert map keys to lower case.  See LowercaseKeys.
+	LowercaseKeys bool
+
+	// Convert values which can't be marshaled to their String() value.  See StringerFallback.
+	StringerFallback bool
+
+	// Convert database/sql Null types to their underlying values.  See SQLNullTypes.
+	SQLNullTypes bool
+
+	// Keep the order of JSON object keys, by normalizing objects to *OrderedMap.  See
+	// PreserveOrder.
+	PreserveOrder bool
+
+	depth    int            // current depth, when Deep is set
+	visiting map[visit]bool // maps and slices being normalized, once depth exceeds startDetectingCyclesAfter
+}
+
+// MaxDepthExceededError indicates a value was nested more deeply than the MaxDepth option allows.
+var MaxDepthExceededError = merry.New("Max depth exceeded")
+
+// CycleDetectedError indicates a value contains itself, like a map which contains itself, or a struct
+// with a pointer to itself, so it can't be normalized.
+var CycleDetectedError = merry.New("Cycle detected")
+
+// startDetectingCyclesAfter is the depth at which normalize starts tracking the maps and slices it
+// is normalizing, to detect cycles.  Like encoding/json, checking is deferred until values are
+// nested this deeply, so normal values don't pay for it.
+const startDetectingCyclesAfter = 100
+
+// visit identifies a map or slice.  Slices which share an array but have different lengths
+// are different values.
+type visit struct {
+	ptr uintptr
+	len int
+}
+
+// enter records that v is being normalized.  Returns CycleDetectedError if it already is.
+// ok is true if v is a map or slice, and leave should be called when it's done.
+func (o *NormalizeOptions) enter(v interface{}) (key visit, ok bool, err error) {
+	key, ok = visitOf(reflect.ValueOf(v))
+	if !ok {
+		return key, false, nil
+	}
+	if o.visiting[key] {
+		return key, false, CycleDetectedError.Here().WithMessagef("encountered a cycle via %T", v)
+	}
+	if o.visiting == nil {
+		o.visiting = map[visit]bool{}
+	}
+	o.visiting[key] = true
+	return key, true, nil
+}
+
+func (o *NormalizeOptions) leave(key visit) {
+	delete(o.visiting, key)
+}
+
+// visitOf returns the visit key of rv.  ok is false if rv isn't a map or a non-empty slice,
+// which are the only values which can contain themselves.
+func visitOf(rv reflect.Value) (key visit, ok bool) {
+	switch rv.Kind() {
+	case reflect.Map:
+		return visit{ptr: rv.Pointer()}, true
+	case reflect.Slice:
+		if rv.Len() == 0 {
+			return key, false
+		}
+		return visit{ptr: rv.Pointer(), len: rv.Len()}, true
+	}
+	return key, false
+}
+
+// trimCyclePath cuts the path of an error caused by a cycle at the first map or slice
+// which repeats.  normalize doesn't check for cycles until it's startDetectingCyclesAfter
+// levels deep, so the path it reports goes around the cycle many times.  v is the value
+// passed to normalize.
+func trimCyclePath(v interface{}, err error) error {
+	path := NormalizeErrorPath(err)
+	if len(path) == 0 || !merry.Is(err, CycleDetectedError) {
+		return err
+	}
+	seen := map[visit]bool{}
+	rv := reflect.ValueOf(v)
+	for i := 0; ; i++ {
+		for rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr {
+			rv = rv.Elem()
+		}
+		if key, ok := visitOf(rv); ok {
+			if seen[key] {
+				return withNormalizePath(err, path[:i])
+			}
+			seen[key] = true
+		}
+		if i == len(path) {
+			return err
+		}
+		switch elem := path[i].(type) {
+		case string:
+			if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+				return err
+			}
+			rv = rv.MapIndex(reflect.ValueOf(elem).Convert(rv.Type().Key()))
+		case int:
+			if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || elem >= rv.Len() {
+				return err
+			}
+			rv = rv.Index(elem)
+		default:
+			return err
+		}
+		if !rv.IsValid() {
+			return err
+		}
+	}
 }
 
 // NormalizeOption is an option function for the Normalize operation.
+//
+// Functions which take NormalizeOptions, like Merge, Transform, Get, Flatten, Prune, and
+// Canonicalize, also accept their own options through this interface, like SliceReplace
+// or KeepZeros.  Each function only looks for its own option types, and the Apply methods
+// of those types do nothing, so an option passed to a function it doesn't belong to is
+// silently ignored: SliceReplace has no effect on Normalize, and KeepZeros has no effect
+// on Merge.
 type NormalizeOption interface {
 	Apply(*NormalizeOptions)
 }
@@ -791,12 +3445,162 @@ func NormalizeTime(b bool) NormalizeOption {
 	})
 }
 
+// DefaultTimeLayouts are the layouts NormalizeTime tries when parsing strings as times, if
+// no other layouts are set with ParseTimeLayouts.
+var DefaultTimeLayouts = []string{time.RFC3339Nano, time.RFC3339, "2006-01-02"}
+
+// ParseTimeLayouts sets the layouts NormalizeTime tries when parsing strings as times.  Each
+// layout is tried in order, and strings which don't match any are left as strings.  Implies
+// NormalizeTime.  For Contains and Equivalent, use ParseTimesWithLayouts.
+//
+//	Normalize(v, ParseTimeLayouts(time.RFC3339, "2006-01-02 15:04:05"))
+func ParseTimeLayouts(layouts ...string) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.NormalizeTime = true
+		options.TimeLayouts = layouts
+	})
+}
+
+// UseProtoNames causes normalization to use the original .proto field names for
+// proto messages, instead of the lowerCamelCase JSON names.  See protojson.MarshalOptions.
+func UseProtoNames(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.UseProtoNames = b
+	})
+}
+
+// ProtoMarshalOptions sets the options used to marshal proto messages, like EmitUnpopulated
+// or UseEnumNumbers:
+//
+//	Normalize(msg, ProtoMarshalOptions(protojson.MarshalOptions{EmitUnpopulated: true}))
+//
+// UseProtoNames(true) still causes the proto field names to be used, whatever
+// opts.UseProtoNames is set to.
+func ProtoMarshalOptions(opts protojson.MarshalOptions) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.ProtoMarshalOptions = &opts
+	})
+}
+
+// NumbersAsJSONNumber causes normalization to convert numbers to json.Number, rather
+// than float64.  float64 only represents integers exactly up to 2^53, so large integers,
+// like database IDs, can be corrupted by normalization:
+//
+//	Normalize(int64(1234567890123456789))                            // float64(1234567890123456768)
+//	Normalize(int64(1234567890123456789), NumbersAsJSONNumber(true)) // json.Number("1234567890123456789")
+//
+// Integers are formatted exactly, and floats are formatted the way json.Marshal formats them.
+// NaN and infinite floats, which have no JSON representation, are left as float64.
+//
+// The tradeoff is that json.Number is a string, so the result is awkward to do arithmetic
+// with, and code which expects float64 values won't recognize the numbers.  Contains and
+// Equivalent compare json.Numbers with other numbers by value, so large integers are
+// compared exactly.
+func NumbersAsJSONNumber(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.NumbersAsJSONNumber = b
+	})
+}
+
+// PreserveInts causes normalization to leave integer values, like int and int64, as
+// they are, rather than converting them to float64:
+//
+//	Normalize(map[string]int{"size": 5})                     // {"size": float64(5)}
+//	Normalize(map[string]int{"size": 5}, PreserveInts(true)) // {"size": 5}
+//
+// Only values normalized directly are preserved.  Values which have to be marshaled
+// to JSON, like structs, are unmarshaled with float64 numbers.  NumbersAsJSONNumber
+// takes precedence.  Contains and Equivalent compare integers and floats by value, so
+// int(5) matches float64(5).
+func PreserveInts(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.PreserveInts = b
+	})
+}
+
+// MaxDepth limits how deeply maps and slices may be nested in a value normalized with the
+// Deep option.  For example, {"a":[1]} has a depth of 2.  If the limit is exceeded,
+// normalization stops, and returns MaxDepthExceededError.  n <= 0 means no limit, which is
+// the default.
+//
+// This protects against untrusted documents, like request bodies, nested deeply enough
+// to exhaust the stack.  Normalize them with this option before passing them to other
+// functions, like Contains.
+func MaxDepth(n int) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.MaxDepth = n
+	})
+}
+
+// LowercaseKeys causes normalization to convert map keys to lower case, with strings.ToLower.
+// Normalizing both values this way makes comparing them with Contains and Equivalent, and
+// looking up values with Get, insensitive to the case of keys:
+//
+//	v, _ := Normalize(doc, LowercaseKeys(true))
+//	Get(v, "resource.createdat")
+//
+// If two keys in the same map have the same lower case form, like "ID" and "id",
+// normalization returns KeyCollisionError.  Only values are normalized, so only the
+// keys of nested maps are converted if the Deep option is set.
+func LowercaseKeys(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.LowercaseKeys = b
+	})
+}
+
+// StringerFallback converts values which implement fmt.Stringer to the result of their String()
+// method, if they can't be marshaled to JSON, instead of returning the marshaling error.  This is
+// useful when a readable form of values like channels or funcs is good enough, like when
+// comparing values for logging.
+//
+// Values which can be marshaled are marshaled as usual, even if they implement fmt.Stringer.
+func StringerFallback(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.StringerFallback = b
+	})
+}
+
+// SQLNullTypes converts the database/sql Null types, like sql.NullString and sql.NullTime,
+// to their underlying values, or to nil if they aren't valid.  Without this option, they
+// are marshaled like other structs, like {"String":"x","Valid":true}.
+func SQLNullTypes(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.SQLNullTypes = b
+	})
+}
+
+// PreserveOrder keeps the order of the keys in JSON objects.  Objects are normalized to
+// *OrderedMap, instead of map[string]interface{}, when the order is known: *OrderedMap and
+// OrderedMap values are kept, and values which are marshaled to JSON, like structs, keep
+// the order of the keys in the JSON, so struct fields stay in the order they were
+// declared.  Other maps don't have an order, so they're still normalized to
+// map[string]interface{}.
+//
+//	Merge(ordered1, ordered2, PreserveOrder(true)) // *OrderedMap, with ordered2's new keys at the end
+//
+// Merge adds new keys after the existing ones, in the order of the other map, or sorted, if
+// it's a map[string]interface{}.  Contains, Equivalent, and Get don't need the order, so
+// they normalize an *OrderedMap like any other json.Marshaler.
+func PreserveOrder(b bool) NormalizeOption {
+	return NormalizeOptionFunc(func(options *NormalizeOptions) {
+		options.PreserveOrder = b
+	})
+}
+
 // NormalizeWithOptions does the same as Normalize, but with options.
 func NormalizeWithOptions(v interface{}, opt NormalizeOptions) (interface{}, error) {
 	return normalize(v, &opt)
 }
 
 func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err error) {
+	if n, ok := v.(Normalized); ok {
+		if options.Copy {
+			// the wrapped tree only contains normalized types, so this is
+			// a plain deep copy, without reflection or marshaling
+			return normalize(n.v, &NormalizeOptions{Copy: true, Deep: true})
+		}
+		return n.v, nil
+	}
 	v2 = v
 	copied := false
 	if options.NormalizeTime {
@@ -810,13 +3614,24 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 			v2 = *t
 			return
 		case string:
-			tm, err := time.Parse(time.RFC3339Nano, t)
+			tm, err := parseTime(t, options.TimeLayouts)
 			if err == nil {
 				v2 = tm
 				return v2, nil
 			}
 		}
 	}
+	if options.NumbersAsJSONNumber {
+		if n, ok := toJSONNumber(v); ok {
+			return n, nil
+		}
+	}
+	if options.PreserveInts {
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return
+		}
+	}
 	switch t := v.(type) {
 	case bool, string, nil, float64:
 		return
@@ -842,11 +3657,35 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 		return float64(t), nil
 	case uint64:
 		return float64(t), nil
-	case map[string]interface{}, []interface{}:
+	case map[string]interface{}:
+		if !options.Copy && !options.Deep && !options.LowercaseKeys {
+			return
+		}
+	case []interface{}:
 		if !options.Copy && !options.Deep {
 			return
 		}
 	default:
+		if options.PreserveOrder {
+			if m, ok := asOrderedMap(v); ok {
+				if !options.Copy && !options.Deep {
+					return m, nil
+				}
+				v2 = m
+				break
+			}
+		}
+		if n, handled, err := normalizeRegistered(v); handled {
+			if err != nil {
+				return nil, err
+			}
+			return normalize(n, options)
+		}
+		if options.SQLNullTypes {
+			if n, ok := sqlNullValue(v); ok {
+				return normalize(n, options)
+			}
+		}
 		// if v explicitly supports json marshalling, just skip to that.
 		if options.Marshal {
 			switch m := v.(type) {
@@ -862,6 +3701,20 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 				return slowNormalize(&m, options)
 			}
 		}
+		if sm, ok := v.(*sync.Map); ok && sm != nil {
+			m, err := syncMapToMap(sm)
+			if err != nil {
+				return nil, err
+			}
+			copied = true
+			v2 = m
+			break
+		}
+		if c, ok := convertCommonType(v); ok {
+			copied = true
+			v2 = c
+			break
+		}
 		rv := reflect.ValueOf(v)
 		switch {
 		case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
@@ -887,7 +3740,44 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 			return
 		}
 	}
+	if options.LowercaseKeys {
+		if m, ok := v2.(map[string]interface{}); ok {
+			if v2, err = lowercaseKeys(m); err != nil {
+				return nil, err
+			}
+			// lowercaseKeys made a new map
+			copied = true
+		}
+	}
 	if options.Deep || (options.Copy && !copied) {
+		if options.Deep {
+			if options.MaxDepth > 0 && options.depth >= options.MaxDepth {
+				return nil, MaxDepthExceededError.Here().WithMessagef("exceeded max depth of %v", options.MaxDepth)
+			}
+			options.depth++
+			defer func() {
+				options.depth--
+				if options.depth == 0 && err != nil {
+					err = trimCyclePath(v, err)
+				}
+			}()
+			if options.depth > startDetectingCyclesAfter {
+				// v is the original value, before it was converted.  Converting
+				// creates new maps and slices, which are never revisited.
+				cv := v
+				if m, isOrdered := v2.(*OrderedMap); isOrdered {
+					// OrderedMap values share their map with the original
+					cv = m.values
+				}
+				key, ok, err := options.enter(cv)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					defer options.leave(key)
+				}
+			}
+		}
 		switch t := v2.(type) {
 		case map[string]interface{}:
 			var m map[string]interface{}
@@ -901,7 +3791,7 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 			for key, value := range t {
 				if options.Deep {
 					if value, err = normalize(value, options); err != nil {
-						return
+						return nil, prependNormalizePath(err, key)
 					}
 				}
 				m[key] = value
@@ -914,229 +3804,1724 @@ func normalize(v interface{}, options *NormalizeOptions) (v2 interface{}, err er
 				// modify in place
 				s = t
 			}
-			v2 = s
-			for i := 0; i < len(t); i++ {
-				if options.Deep {
-					if s[i], err = normalize(t[i], options); err != nil {
-						return
-					}
-				} else {
-					s[i] = t[i]
-				}
+			v2 = s
+			for i := 0; i < len(t); i++ {
+				if options.Deep {
+					if s[i], err = normalize(t[i], options); err != nil {
+						return nil, prependNormalizePath(err, i)
+					}
+				} else {
+					s[i] = t[i]
+				}
+			}
+		case *OrderedMap:
+			m := t
+			if options.Copy && !copied {
+				m = &OrderedMap{keys: make([]string, 0, len(t.keys)), values: make(map[string]interface{}, len(t.keys))}
+			}
+			v2 = m
+			for _, key := range t.keys {
+				value := t.values[key]
+				if options.Deep {
+					if value, err = normalize(value, options); err != nil {
+						return nil, prependNormalizePath(err, key)
+					}
+				}
+				// setting an existing key keeps its position
+				m.Set(key, value)
+			}
+		default:
+			panic("Should be either a map or slice by now")
+		}
+	}
+
+	return
+}
+
+// merry value keys for errors from normalizing nested values.
+type (
+	normalizePathKey  struct{}
+	normalizeCauseKey struct{}
+)
+
+// NormalizeErrorPath returns the path to the value which couldn't be normalized, if err is
+// from normalizing a value nested in a map or slice.  The path is also in the message:
+//
+//	error normalizing at resource.meta.events: json: unsupported type: chan string
+//
+// Returns nil for other errors.
+func NormalizeErrorPath(err error) Path {
+	p, _ := merry.Value(err, normalizePathKey{}).(Path)
+	return p
+}
+
+// prependNormalizePath adds elems to the start of the path of err.  It's only called on
+// the error path, so normalize doesn't need to track the path as it descends.
+func prependNormalizePath(err error, elems ...interface{}) error {
+	return withNormalizePath(err, append(Path(elems), NormalizeErrorPath(err)...))
+}
+
+// withNormalizePath sets the path of err to p, and prefixes the original message with it.
+func withNormalizePath(err error, p Path) error {
+	cause, ok := merry.Value(err, normalizeCauseKey{}).(string)
+	if !ok {
+		cause = err.Error()
+	}
+	return merry.WithValue(err, normalizeCauseKey{}, cause).
+		WithValue(normalizePathKey{}, p).
+		WithMessage("error normalizing at " + p.String() + ": " + cause)
+}
+
+// convertCommonType converts common map and slice types to map[string]interface{}
+// and []interface{}, like the reflection in normalize does, but faster.  ok is false
+// for other types.
+func convertCommonType(v interface{}) (c interface{}, ok bool) {
+	switch t := v.(type) {
+	case map[string]string:
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			m[key] = value
+		}
+		return m, true
+	case map[string]int:
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			m[key] = value
+		}
+		return m, true
+	case []string:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = value
+		}
+		return s, true
+	case []int:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = value
+		}
+		return s, true
+	case []float64:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = value
+		}
+		return s, true
+	case []bool:
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			s[i] = value
+		}
+		return s, true
+	}
+	return nil, false
+}
+
+// syncMapToMap converts a *sync.Map to a map[string]interface{}.  Its keys are converted
+// to strings with fmt.Sprint.  Returns KeyCollisionError if two keys convert to the same
+// string, like 1 and "1".
+func syncMapToMap(sm *sync.Map) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	var err error
+	sm.Range(func(key, value interface{}) bool {
+		s, ok := key.(string)
+		if !ok {
+			s = fmt.Sprint(key)
+		}
+		if _, ok := m[s]; ok {
+			// report the keys in the same order, whatever order Range visits them in
+			var keys []interface{}
+			sm.Range(func(k, _ interface{}) bool {
+				if fmt.Sprint(k) == s {
+					keys = append(keys, k)
+				}
+				return true
+			})
+			sort.Slice(keys, func(i, j int) bool {
+				return fmt.Sprintf("%T", keys[i]) < fmt.Sprintf("%T", keys[j])
+			})
+			err = KeyCollisionError.Here().WithMessagef("keys %#v and %#v both convert to %q", keys[0], keys[1], s)
+			return false
+		}
+		m[s] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// sqlNullValue returns the underlying value of the database/sql Null types, or
+// nil if the value isn't valid.  ok is false for other types.
+func sqlNullValue(v interface{}) (n interface{}, ok bool) {
+	switch t := v.(type) {
+	case sql.NullString:
+		n, ok = t.String, t.Valid
+	case sql.NullInt64:
+		n, ok = t.Int64, t.Valid
+	case sql.NullInt32:
+		n, ok = t.Int32, t.Valid
+	case sql.NullBool:
+		n, ok = t.Bool, t.Valid
+	case sql.NullFloat64:
+		n, ok = t.Float64, t.Valid
+	case sql.NullTime:
+		n, ok = t.Time, t.Valid
+	default:
+		return nil, false
+	}
+	if !ok {
+		return nil, true
+	}
+	return n, true
+}
+
+// lowercaseKeys returns a copy of m, with its keys converted to lower case.
+func lowercaseKeys(m map[string]interface{}) (map[string]interface{}, error) {
+	lm := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		lower := strings.ToLower(key)
+		if _, ok := lm[lower]; ok {
+			var keys []string
+			for k := range m {
+				if strings.ToLower(k) == lower {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			return nil, KeyCollisionError.Here().WithMessagef("keys %q and %q both lowercase to %q", keys[0], keys[1], lower)
+		}
+		lm[lower] = value
+	}
+	return lm, nil
+}
+
+// toJSONNumber converts numbers to json.Number.  ok is false if v isn't a number, or
+// is a float with no JSON representation.
+func toJSONNumber(v interface{}) (n json.Number, ok bool) {
+	switch t := v.(type) {
+	case json.Number:
+		return t, true
+	case float64, float32:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return "", false
+		}
+		return json.Number(b), true
+	}
+	switch kind, i, u, _ := asNumber(v); kind {
+	case signedNumber:
+		return json.Number(strconv.FormatInt(i, 10)), true
+	case unsignedNumber:
+		return json.Number(strconv.FormatUint(u, 10)), true
+	}
+	return "", false
+}
+
+// parseTime parses s with the first of layouts which matches, or DefaultTimeLayouts if
+// layouts is empty.  Returns the error from the first layout if none match.
+func parseTime(s string, layouts []string) (time.Time, error) {
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+	var firstErr error
+	for _, layout := range layouts {
+		tm, err := time.Parse(layout, s)
+		if err == nil {
+			return tm, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+func marshal(v interface{}, options *NormalizeOptions) ([]byte, error) {
+	if msg, ok := v.(proto.Message); ok {
+		var mo protojson.MarshalOptions
+		if options.ProtoMarshalOptions != nil {
+			mo = *options.ProtoMarshalOptions
+		}
+		if options.UseProtoNames {
+			mo.UseProtoNames = true
+		}
+		return mo.Marshal(msg)
+	}
+	return json.Marshal(v)
+}
+
+func slowNormalize(v interface{}, options *NormalizeOptions) (interface{}, error) {
+	b, err := marshal(v, options)
+	if err != nil {
+		var uve *json.UnsupportedValueError
+		if errors.As(err, &uve) && strings.HasPrefix(uve.Str, "encountered a cycle") {
+			return nil, CycleDetectedError.Here().WithMessage(uve.Str)
+		}
+		if s, ok := v.(fmt.Stringer); ok && options.StringerFallback {
+			return s.String(), nil
+		}
+		return nil, err
+	}
+
+	var v2 interface{}
+	switch {
+	case options.PreserveOrder:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		if options.NumbersAsJSONNumber {
+			dec.UseNumber()
+		}
+		v2, err = decodeOrdered(dec)
+	case options.NumbersAsJSONNumber:
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		err = dec.Decode(&v2)
+	default:
+		err = json.Unmarshal(b, &v2)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// if we're normalizing times, we need to run the result back through the normalize function
+	// to convert the string times to time.Time values.  The same goes for checking the depth,
+	// and lower casing keys.
+	if options.NormalizeTime || options.LowercaseKeys || (options.Deep && options.MaxDepth > 0) {
+		return normalize(v2, options)
+	}
+
+	return v2, nil
+}
+
+// Normalize recursively converts v1 into a tree of maps, slices, and primitives.
+// The types in the result will be the types the json package uses for unmarshalling
+// into interface{}.  The rules are:
+//
+// 1. All maps with string keys will be converted into map[string]interface{}
+// 2. All slices will be converted to []interface{}
+// 3. All primitive numeric types will be converted into float64
+// 4. string, bool, and nil are unmodified
+// 5. All other values will be converted into the above types by doing a json.Marshal and Unmarshal
+//
+// Values in v1 will be modified in place if possible.
+//
+// If a value nested in v1 can't be normalized, the error message includes the path to
+// the value, which NormalizeErrorPath returns.  If v1 contains itself, like a map which
+// contains itself, the error is CycleDetectedError.
+func Normalize(v1 interface{}, opts ...NormalizeOption) (interface{}, error) {
+	opt := NormalizeOptions{
+		Copy:    true,
+		Marshal: true,
+		Deep:    true,
+	}
+	for _, option := range opts {
+		option.Apply(&opt)
+	}
+	return normalize(v1, &opt)
+}
+
+// NormalizeReader decodes a single JSON value from r, and normalizes it, like Normalize.
+// The value is decoded directly from the stream, so large payloads don't need to be read
+// into memory first.  With the NumbersAsJSONNumber option, numbers are decoded as json.Number,
+// so large integers don't lose precision.
+//
+// An empty stream returns nil.  It's an error if anything other than whitespace follows the
+// JSON value.
+func NormalizeReader(r io.Reader, opts ...NormalizeOption) (interface{}, error) {
+	opt := NormalizeOptions{
+		Marshal: true,
+		Deep:    true,
+	}
+	for _, option := range opts {
+		option.Apply(&opt)
+	}
+	// decoded values are not shared with anything else, so there's no need to copy them
+	opt.Copy = false
+
+	dec := json.NewDecoder(r)
+	if opt.NumbersAsJSONNumber {
+		dec.UseNumber()
+	}
+	var v interface{}
+	var err error
+	if opt.PreserveOrder {
+		v, err = decodeOrdered(dec)
+	} else {
+		err = dec.Decode(&v)
+	}
+	if err != nil {
+		if merry.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, merry.Prepend(err, "error decoding JSON")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, merry.New("unexpected data after JSON value")
+	}
+	return normalize(v, &opt)
+}
+
+// Normalized wraps a value which has already been normalized.  See AsNormalized.
+type Normalized struct {
+	v interface{}
+}
+
+// AsNormalized normalizes v, and wraps the result in a Normalized.  Contains,
+// Equivalent, Get, Merge, and the other functions in this package recognize Normalized
+// arguments, and use the wrapped value directly instead of normalizing it again.  This
+// is useful when the same value will be compared or queried many times:
+//
+//	n, err := AsNormalized(bigStruct)
+//	for _, v2 := range patterns {
+//	  if Contains(n, v2) { ... }
+//	}
+//
+// The options are the same as for Normalize, and default to Copy, Marshal, and Deep.
+// Options passed to later calls don't affect the wrapped value.  For example,
+// to compare times with ParseTimes, normalize with NormalizeTime(true) here.
+//
+// Functions which return copies, like Merge, still copy the wrapped value, so they
+// won't modify it.  But the value returned by Value() is the wrapped value itself:
+// mutating it bypasses that copy safety, and affects all later uses of the Normalized.
+func AsNormalized(v interface{}, opts ...NormalizeOption) (Normalized, error) {
+	if n, ok := v.(Normalized); ok {
+		return n, nil
+	}
+	nv, err := Normalize(v, opts...)
+	if err != nil {
+		return Normalized{}, err
+	}
+	return Normalized{v: nv}, nil
+}
+
+// Value returns the wrapped, normalized value.
+func (n Normalized) Value() interface{} {
+	return n.v
+}
+
+// DeepCopy returns a deep copy of v.  Maps, slices, and arrays are copied recursively,
+// so the result shares no maps or slices with v.  Unlike Normalize, DeepCopy doesn't convert
+// anything: the copies have the same types as the originals, numbers aren't converted to
+// float64, and structs aren't marshaled.  Other values, like primitives, time.Time values,
+// structs, and pointers, are returned as is.
+//
+// DeepCopy is useful before modifying a tree which may be shared with other code.  If v
+// contains itself, like a map which contains itself, the error is CycleDetectedError.
+func DeepCopy(v interface{}) (interface{}, error) {
+	// only the depth and cycle tracking of the options are used
+	return deepCopy(v, &NormalizeOptions{})
+}
+
+func deepCopy(v interface{}, o *NormalizeOptions) (interface{}, error) {
+	switch v.(type) {
+	case nil, bool, string, float64, int, time.Time:
+		return v, nil
+	}
+	o.depth++
+	defer func() {
+		o.depth--
+	}()
+	if o.depth > startDetectingCyclesAfter {
+		key, ok, err := o.enter(v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			defer o.leave(key)
+		}
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if t == nil {
+			return t, nil
+		}
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			c, err := deepCopy(value, o)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = c
+		}
+		return m, nil
+	case []interface{}:
+		if t == nil {
+			return t, nil
+		}
+		s := make([]interface{}, len(t))
+		for i, value := range t {
+			c, err := deepCopy(value, o)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = c
+		}
+		return s, nil
+	case Normalized:
+		c, err := deepCopy(t.v, o)
+		if err != nil {
+			return nil, err
+		}
+		return Normalized{v: c}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.IsNil() {
+			return v, nil
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			c, err := deepCopyValue(iter.Value(), rv.Type().Elem(), o)
+			if err != nil {
+				return nil, err
+			}
+			m.SetMapIndex(iter.Key(), c)
+		}
+		return m.Interface(), nil
+	case reflect.Slice:
+		if rv.IsNil() {
+			return v, nil
+		}
+		s := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			c, err := deepCopyValue(rv.Index(i), rv.Type().Elem(), o)
+			if err != nil {
+				return nil, err
+			}
+			s.Index(i).Set(c)
+		}
+		return s.Interface(), nil
+	case reflect.Array:
+		a := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			c, err := deepCopyValue(rv.Index(i), rv.Type().Elem(), o)
+			if err != nil {
+				return nil, err
+			}
+			a.Index(i).Set(c)
+		}
+		return a.Interface(), nil
+	}
+	return v, nil
+}
+
+// deepCopyValue copies v, which is an element of a map, slice, or array with
+// element type t.
+func deepCopyValue(v reflect.Value, t reflect.Type, o *NormalizeOptions) (reflect.Value, error) {
+	if v.Kind() == reflect.Interface && v.IsNil() {
+		return reflect.Zero(t), nil
+	}
+	c, err := deepCopy(v.Interface(), o)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return reflect.ValueOf(c), nil
+}
+
+// PathNotFoundError indicates the requested path was not present in the value.
+var PathNotFoundError = merry.New("Path not found")
+
+// PathNotMapError indicates the value at the path is not a map.
+var PathNotMapError = merry.New("Path not map")
+
+// PathNotSliceError indicates the value at the path is not a slice.
+var PathNotSliceError = merry.New("Path not slice")
+
+// IndexOutOfBoundsError indicates the index doesn't exist in the slice.
+var IndexOutOfBoundsError = merry.New("Index out of bounds")
+
+// PathNotTimeError indicates the value at the path is not a time, or a string which
+// can be parsed as a time.
+var PathNotTimeError = merry.New("Path not time")
+
+// PathNotStringError indicates the value at the path is not a string.
+var PathNotStringError = merry.New("Path not string")
+
+// PathNotNumberError indicates the value at the path is not a number, or for GetInt, not
+// a whole number which fits in an int.
+var PathNotNumberError = merry.New("Path not number")
+
+// PathNotBoolError indicates the value at the path is not a bool.
+var PathNotBoolError = merry.New("Path not bool")
+
+// Path is a slice of map keys (strings), slice indexes (ints), and the special elements
+// EachElement, Wildcard, and RecursiveDescent.
+type Path []interface{}
+
+// EachElement is a Path element which stands for each element of a slice.
+// In a string path, it is written as empty brackets, like "items[].name".
+// See Get.  In Set, it stands for a new element appended to the slice.
+type EachElement struct{}
+
+// Wildcard is a Path element which matches every value of a map, or every element
+// of a slice.  In a string path, it is written as "*", or "[*]", like "items[*].name"
+// or "tags.*.color".  See GetAll.
+type Wildcard struct{}
+
+// RecursiveDescent is a Path element which matches the rest of the path at any depth,
+// including zero levels.  In a string path, it is written as "..", like "..color"
+// or "resource..id".  See GetAll.
+type RecursiveDescent struct{}
+
+// pathLess returns true if p1 sorts before p2.  Paths are compared element by element, so
+// slice indexes are compared as numbers, and "items[2]" sorts before "items[10]".  A path
+// sorts before the paths it's a prefix of.
+func pathLess(p1, p2 Path) bool {
+	for i := 0; i < len(p1) && i < len(p2); i++ {
+		e1, e2 := p1[i], p2[i]
+		if e1 == e2 {
+			continue
+		}
+		i1, isInt1 := e1.(int)
+		i2, isInt2 := e2.(int)
+		if isInt1 && isInt2 {
+			return i1 < i2
+		}
+		s1, isString1 := e1.(string)
+		s2, isString2 := e2.(string)
+		if isString1 && isString2 {
+			return s1 < s2
+		}
+		return pathElemRank(e1) < pathElemRank(e2)
+	}
+	return len(p1) < len(p2)
+}
+
+// pathElemRank orders the different kinds of path elements, for pathLess.
+func pathElemRank(elem interface{}) int {
+	switch elem.(type) {
+	case int:
+		return 0
+	case string:
+		return 1
+	case EachElement:
+		return 2
+	case Wildcard:
+		return 3
+	case RecursiveDescent:
+		return 4
+	}
+	return 5
+}
+
+// ParsePath parses a string path into a Path slice.  String paths look
+// like:
+//
+//	user.name.first
+//	user.addresses[3].street
+//
+// Paths may also contain the special elements EachElement ("[]"), Wildcard ("*" or "[*]"),
+// and RecursiveDescent (".." or "**"), which are supported by some functions, like GetAll.
+// Escape them to use them as literal keys, like `\*` or `\*\*`.
+//
+// Keys which contain dots or brackets can be escaped with backslashes, or quoted in
+// brackets:
+//
+//	labels.app\.kubernetes\.io/name
+//	labels["app.kubernetes.io/name"]
+//
+// Inside quotes, '"' and '\' must be escaped with backslashes.  Outside quotes, brackets
+// which don't form an index, "[]", "[*]", or a quoted key are kept as part of the key, so
+// "a[b]" is the key "a[b]".
+//
+// Empty keys must be quoted, like `a[""].b`.  Since ".." is RecursiveDescent, other empty
+// segments, like a trailing dot, are ignored.  See ParsePathStrict.  Path.String quotes empty
+// keys, so paths with empty keys round trip.
+func ParsePath(path string) (Path, error) {
+	return parsePath(path, false)
+}
+
+// ParsePathStrict is like ParsePath, but empty segments between dots are parsed as empty
+// keys, instead of RecursiveDescent or being ignored, so "a..c" is Path{"a", "", "c"}, and
+// "a." is Path{"a", ""}.  RecursiveDescent must be written as "**".
+//
+// Path.String quotes empty keys, so ParsePathStrict(p.String()) returns p, unless p
+// contains RecursiveDescent, which Path.String writes as "..".
+func ParsePathStrict(path string) (Path, error) {
+	return parsePath(path, true)
+}
+
+// parsePath parses path.  If strict is true, empty segments are empty keys.
+func parsePath(path string, strict bool) (Path, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	segments := splitPath(path)
+	parsedPath := make(Path, 0, len(segments)+strings.Count(path, "["))
+	for i, segment := range segments {
+		if segment == "" && strict {
+			parsedPath = append(parsedPath, "")
+			continue
+		}
+		if segment == "" && i > 0 && i < len(segments)-1 {
+			// two dots in a row, like a..b
+			if len(parsedPath) == 0 || parsedPath[len(parsedPath)-1] != (RecursiveDescent{}) {
+				parsedPath = append(parsedPath, RecursiveDescent{})
+			}
+			continue
+		}
+		parsedPath = parseSegment(segment, parsedPath)
+	}
+	return parsedPath, nil
+}
+
+// splitPath splits path on dots, except escaped dots, and dots in quoted keys.
+// Escapes are left in the segments.
+func splitPath(path string) []string {
+	var segments []string
+	start := 0
+	openBracket := -1
+	inQuote := false
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\':
+			// skip the escaped character
+			i++
+		case inQuote:
+			inQuote = c != '"'
+		case c == '[':
+			openBracket = i
+		case c == '"' && openBracket >= 0 && openBracket == i-1:
+			inQuote = true
+		case c == '.':
+			segments = append(segments, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// parseSegment parses a segment of a path between dots, like "tags[2]", and
+// appends the elements to parsedPath.
+func parseSegment(segment string, parsedPath Path) Path {
+	var key []byte
+	escaped := false
+	flush := func() {
+		if escaped {
+			// escaped keys are taken literally
+			parsedPath = append(parsedPath, string(key))
+		} else if k := strings.TrimSpace(string(key)); k == "*" {
+			parsedPath = append(parsedPath, Wildcard{})
+		} else if k == "**" {
+			// an alias for "..", so consecutive ones are collapsed the same way
+			if len(parsedPath) == 0 || parsedPath[len(parsedPath)-1] != (RecursiveDescent{}) {
+				parsedPath = append(parsedPath, RecursiveDescent{})
+			}
+		} else if len(k) > 0 {
+			parsedPath = append(parsedPath, k)
+		}
+		key = key[:0]
+		escaped = false
+	}
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case c == '\\' && i+1 < len(segment):
+			i++
+			key = append(key, segment[i])
+			escaped = true
+		case c == '[':
+			if elem, n, ok := parseBracket(segment[i:]); ok {
+				flush()
+				parsedPath = append(parsedPath, elem)
+				i += n - 1
+				continue
+			}
+			key = append(key, c)
+		default:
+			key = append(key, c)
+		}
+	}
+	flush()
+	return parsedPath
+}
+
+// parseBracket parses the bracket expression at the start of s, like "[2]",
+// "[]", "[*]", or a quoted key.  Returns the path element, and the length of
+// the expression.  ok is false if s doesn't start with a bracket expression.
+func parseBracket(s string) (elem interface{}, n int, ok bool) {
+	if strings.HasPrefix(s, `["`) {
+		var key []byte
+		for i := 2; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && i+1 < len(s):
+				i++
+				key = append(key, s[i])
+			case c == '"':
+				if i+1 < len(s) && s[i+1] == ']' {
+					return string(key), i + 2, true
+				}
+				return nil, 0, false
+			default:
+				key = append(key, c)
+			}
+		}
+		return nil, 0, false
+	}
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return nil, 0, false
+	}
+	switch content := s[1:end]; content {
+	case "":
+		// empty brackets, like tags[]
+		return EachElement{}, end + 1, true
+	case "*":
+		return Wildcard{}, end + 1, true
+	default:
+		// negative indexes count back from the end of the slice
+		if idx, err := strconv.Atoi(content); err == nil {
+			return idx, end + 1, true
+		}
+	}
+	return nil, 0, false
+}
+
+// String implements the Stringer interface.  It returns the string
+// representation of a Path.  Path.String() and ParsePath() are inversions
+// of each other.  Keys are escaped or quoted as needed.
+//
+// Elements following an index are separated by dots, like "a[1].[3]".  ParsePath
+// also accepts "a[1][3]", but String always returns the dotted form.
+func (p Path) String() string {
+	buf := bytes.NewBuffer(nil)
+
+	for _, elem := range p {
+		switch t := elem.(type) {
+		case string:
+			if t == "" || t != strings.TrimSpace(t) {
+				// keys which would be trimmed or dropped must be quoted
+				if strings.HasSuffix(buf.String(), "]") {
+					buf.WriteString(".")
+				}
+				buf.WriteString(`["`)
+				buf.WriteString(quotedKeyEscaper.Replace(t))
+				buf.WriteString(`"]`)
+				continue
+			}
+			if buf.Len() > 0 && !strings.HasSuffix(buf.String(), "..") {
+				buf.WriteString(".")
+			}
+			writeEscapedKey(buf, t)
+		case RecursiveDescent:
+			buf.WriteString("..")
+		case int:
+			if strings.HasSuffix(buf.String(), "]") {
+				buf.WriteString(".")
+			}
+			fmt.Fprintf(buf, "[%d]", t)
+		case EachElement:
+			if strings.HasSuffix(buf.String(), "]") {
+				buf.WriteString(".")
+			}
+			buf.WriteString("[]")
+		case Wildcard:
+			if buf.Len() > 0 && !strings.HasSuffix(buf.String(), "..") {
+				buf.WriteString(".")
+			}
+			buf.WriteString("*")
+		default:
+			panic(merry.Errorf("Path element was not a string or int! elem: %#v", elem))
+		}
+	}
+	return buf.String()
+}
+
+var quotedKeyEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// writeEscapedKey writes key to buf, escaping the characters ParsePath
+// would otherwise interpret.
+func writeEscapedKey(buf *bytes.Buffer, key string) {
+	switch key {
+	case "*":
+		buf.WriteString(`\*`)
+		return
+	case "**":
+		buf.WriteString(`\*\*`)
+		return
+	}
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '\\', '.':
+			buf.WriteByte('\\')
+		case '[':
+			// only escape brackets which might start a bracket expression
+			if i+1 < len(key) && strings.IndexByte(`"]*+-0123456789`, key[i+1]) >= 0 {
+				buf.WriteByte('\\')
+			}
+		}
+		buf.WriteByte(key[i])
+	}
+}
+
+// Get extracts the value at path from v.
+// Path is in the form:
+//
+//	response.things[2].color.red
+//
+// You can use `merry` to test the types of return errors:
+//
+//	_, err := maps.Get("","")
+//	if merry.Is(err, maps.PathNotFoundError) {
+//	  ...
+//
+// Returns PathNotFoundError if the next key in the path is not found.
+//
+// Returns PathNotMapError if evaluating a key against a value which is not
+// a map (e.g. a slice or a primitive value, against
+// which we can't evaluate a key name).
+//
+// Negative slice indexes count back from the end of the slice, so "tags[-1]" is
+// the last element of tags.
+//
+// Returns IndexOutOfBoundsError if evaluating a slice index against a
+// slice value, and the index is out of bounds.
+//
+// Returns PathNotSliceError if evaluating a slice index against a value which
+// isn't a slice.
+//
+// Empty brackets project the rest of the path over each element of a slice, and
+// return a slice of the results:
+//
+//	Get(v, "items[].name") // the name of each item, in order
+//
+// Elements which don't have the rest of the path are skipped, rather than returning
+// nil or an error, so the result may be shorter than the slice.  If the projection
+// is nested, like "items[].parts[].id", the result is a slice of slices.
+//
+// Get returns an error if the path contains wildcards.  Use GetAll instead.
+//
+// opts may include NormalizeOptions, and GetOptions, like CaseInsensitiveKeys.
+func Get(v interface{}, path string, opts ...NormalizeOption) (interface{}, error) {
+	parsedPath, err := ParsePath(path)
+	if err != nil {
+		return nil, merry.Prepend(err, "Couldn't parse the path")
+	}
+	return GetPath(v, parsedPath, opts...)
+}
+
+// Compile parses path, so it can be used with GetPath.  It's the same as ParsePath.
+func Compile(path string) (Path, error) {
+	return ParsePath(path)
+}
+
+// GetPath is like Get, but takes a parsed path.  When the same path is used for many
+// lookups, parsing it once with Compile saves parsing it again on each call:
+//
+//	p, err := Compile("resource.tags[0]")
+//	for _, v := range docs {
+//	  tag, err := GetPath(v, p)
+//	}
+func GetPath(v interface{}, p Path, opts ...NormalizeOption) (interface{}, error) {
+	opt := GetOptions{
+		NormalizeOptions: NormalizeOptions{
+			Marshal:       true,
+			NormalizeTime: true,
+		},
+	}
+	for _, option := range opts {
+		if g, ok := option.(GetOptionFunc); ok {
+			g(&opt)
+		} else {
+			option.Apply(&opt.NormalizeOptions)
+		}
+	}
+	opt.Deep = false
+	opt.Copy = false
+
+	if n, ok := v.(Normalized); ok {
+		v = n.v
+	}
+	return get(v, p, 0, &opt)
+}
+
+// GetOptions are options for the Get function.
+type GetOptions struct {
+	NormalizeOptions
+
+	// Match map keys regardless of case.  See CaseInsensitiveKeys.
+	CaseInsensitiveKeys bool
+}
+
+// GetOptionFunc is a function which modifies GetOptions.  It
+// implements NormalizeOption, so it can be passed to Get along with
+// other NormalizeOptions.
+type GetOptionFunc func(*GetOptions)
+
+// Apply implements NormalizeOption.  It does nothing: GetOptionFuncs only
+// apply to Get.
+func (f GetOptionFunc) Apply(*NormalizeOptions) {}
+
+// AmbiguousKeyError indicates a key in a path matched more than one key in a map,
+// with the CaseInsensitiveKeys option.
+var AmbiguousKeyError = merry.New("Ambiguous key")
+
+// CaseInsensitiveKeys causes Get to match map keys regardless of case, with strings.EqualFold:
+//
+//	Get({"resource":{"state":"Active"}}, "Resource.State", CaseInsensitiveKeys()) // "Active"
+//
+// A key which matches exactly is always used.  Otherwise, if more than one key in the map
+// matches, like "State" and "STATE", Get returns AmbiguousKeyError.
+func CaseInsensitiveKeys() NormalizeOption {
+	return GetOptionFunc(func(options *GetOptions) {
+		options.CaseInsensitiveKeys = true
+	})
+}
+
+// Has returns true if path resolves to a value in v, i.e. if Get would return the value
+// without an error.  The value may be nil, if v has an explicit nil at that path, like
+// the JSON {"color":null}.  An empty path returns true if v is not nil.
+//
+// Has returns false if any part of the path doesn't resolve, or if v can't be normalized.
+func Has(v interface{}, path string) bool {
+	if path == "" {
+		return v != nil
+	}
+	_, err := Get(v, path)
+	return err == nil
+}
+
+// GetOr is like Get, but returns fallback instead of an error if the path can't be
+// resolved, like when a key is missing, or an index is out of bounds:
+//
+//	GetOr(v, "resource.region", "us-east-1")
+//
+// GetOr also returns fallback if v, or a value along the path, can't be normalized, or
+// if the path is invalid.  Use Get to tell these errors apart.
+func GetOr(v interface{}, path string, fallback interface{}) interface{} {
+	out, err := Get(v, path)
+	if err != nil {
+		return fallback
+	}
+	return out
+}
+
+// GetString is like Get, but returns the value at the path as a string.  Returns
+// PathNotStringError if the value isn't a string.  Otherwise, returns the same errors as Get.
+func GetString(v interface{}, path string) (string, error) {
+	out, err := getLeaf(v, path)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := out.(string); ok {
+		return s, nil
+	}
+	return "", PathNotStringError.Here().WithMessagef("%v is not a string (value type: %T)", path, out)
+}
+
+// GetFloat is like Get, but returns the value at the path as a float64.  Returns
+// PathNotNumberError if the value isn't a number.  Otherwise, returns the same errors as Get.
+func GetFloat(v interface{}, path string) (float64, error) {
+	out, err := getLeaf(v, path)
+	if err != nil {
+		return 0, err
+	}
+	if kind, _, _, _ := asNumber(out); kind == notNumber {
+		return 0, PathNotNumberError.Here().WithMessagef("%v is not a number (value type: %T)", path, out)
+	}
+	return asFloat(out), nil
+}
+
+// GetInt is like Get, but returns the value at the path as an int.  Since normalized
+// numbers are float64s, floats are accepted if they have no fractional part, like 5.0.
+// Returns PathNotNumberError if the value isn't a number, has a fractional part, or
+// doesn't fit in an int.  Otherwise, returns the same errors as Get.
+func GetInt(v interface{}, path string) (int, error) {
+	out, err := getLeaf(v, path)
+	if err != nil {
+		return 0, err
+	}
+	switch kind, i, u, f := asNumber(out); kind {
+	case signedNumber:
+		if i >= math.MinInt && i <= math.MaxInt {
+			return int(i), nil
+		}
+	case unsignedNumber:
+		if u <= math.MaxInt {
+			return int(u), nil
+		}
+	case floatNumber:
+		// -math.MinInt can't be represented as an int, but can be as a float
+		if f == math.Trunc(f) && f >= math.MinInt && f < -math.MinInt {
+			return int(f), nil
+		}
+		return 0, PathNotNumberError.Here().WithMessagef("%v is not an int (value: %v)", path, f)
+	default:
+		return 0, PathNotNumberError.Here().WithMessagef("%v is not a number (value type: %T)", path, out)
+	}
+	return 0, PathNotNumberError.Here().WithMessagef("%v is not an int (value: %v)", path, out)
+}
+
+// GetBool is like Get, but returns the value at the path as a bool.  Returns
+// PathNotBoolError if the value isn't a bool.  Otherwise, returns the same errors as Get.
+func GetBool(v interface{}, path string) (bool, error) {
+	out, err := getLeaf(v, path)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := out.(bool); ok {
+		return b, nil
+	}
+	return false, PathNotBoolError.Here().WithMessagef("%v is not a bool (value type: %T)", path, out)
+}
+
+// getLeaf gets the value at path, and normalizes it, so types like named
+// strings and ints are converted to the plain JSON types.
+func getLeaf(v interface{}, path string) (interface{}, error) {
+	out, err := Get(v, path)
+	if err != nil {
+		return nil, err
+	}
+	return normalize(out, &NormalizeOptions{Marshal: true})
+}
+
+// GetTime is like Get, but returns the value at the path as a time.Time.  The value
+// may be a time.Time, or a string in the RFC3339 format time.Time values are marshaled
+// to, so times come back the same whether v holds time.Time values or was decoded
+// from JSON.  Other formats can be parsed with ParseTimeLayouts.
+//
+// Returns PathNotTimeError if the value is neither.  Otherwise, returns the same errors as Get.
+func GetTime(v interface{}, path string, opts ...NormalizeOption) (time.Time, error) {
+	out, err := Get(v, path, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch t := out.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		var o NormalizeOptions
+		for _, opt := range opts {
+			opt.Apply(&o)
+		}
+		tm, err := parseTime(t, o.TimeLayouts)
+		if err != nil {
+			return time.Time{}, PathNotTimeError.Here().WithCause(err).WithMessagef("%v is not a time", path)
+		}
+		return tm, nil
+	}
+	return time.Time{}, PathNotTimeError.Here().WithMessagef("%v is not a time", path)
+}
+
+// get resolves parsedPath[start:] against v.  parsedPath[:start] is the path
+// to v, and is only used in error messages.
+func get(v interface{}, parsedPath Path, start int, opt *GetOptions) (interface{}, error) {
+	var err error
+	out := v
+	for i := start; i < len(parsedPath); i++ {
+		switch t := parsedPath[i].(type) {
+		case string:
+			out, err = normalize(out, &opt.NormalizeOptions)
+			if err != nil {
+				return nil, err
+			}
+			if m, ok := out.(map[string]interface{}); ok {
+				var present bool
+				if out, present = m[t]; !present && opt.CaseInsensitiveKeys {
+					out, present, err = getFold(m, t, parsedPath[0:i+1])
+					if err != nil {
+						return nil, err
+					}
+				}
+				if !present {
+					return nil, PathNotFoundError.Here().WithMessagef("%v not found", parsedPath[0:i+1])
+				}
+			} else {
+				if i > 0 {
+					return nil, PathNotMapError.Here().WithMessagef("%v is not a map", parsedPath[0:i])
+				}
+				return nil, PathNotMapError.Here().WithMessage("v is not a map")
+			}
+		case int:
+			// slice index
+			out, err = normalize(out, &opt.NormalizeOptions)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := out.([]interface{}); ok {
+				idx, ok := sliceIndex(t, len(s))
+				if !ok {
+					return nil, IndexOutOfBoundsError.Here().WithMessagef("Index out of bounds at %v (len = %v)", parsedPath[0:i+1], len(s))
+				}
+				out = s[idx]
+			} else {
+				if i > 0 {
+					return nil, PathNotSliceError.Here().WithMessagef("%v is not a slice", parsedPath[0:i])
+				}
+				return nil, PathNotSliceError.Here().WithMessage("v is not a slice")
+			}
+		case EachElement:
+			out, err = normalize(out, &opt.NormalizeOptions)
+			if err != nil {
+				return nil, err
+			}
+			s, ok := out.([]interface{})
+			if !ok {
+				if i > 0 {
+					return nil, PathNotSliceError.Here().WithMessagef("%v is not a slice", parsedPath[0:i])
+				}
+				return nil, PathNotSliceError.Here().WithMessage("v is not a slice")
+			}
+			results := make([]interface{}, 0, len(s))
+			for _, el := range s {
+				r, err := get(el, parsedPath, i+1, opt)
+				switch {
+				case err == nil:
+					results = append(results, r)
+				case merry.Is(err, PathNotFoundError, PathNotMapError, PathNotSliceError, IndexOutOfBoundsError):
+					// elements which don't have the rest of the path are skipped
+				default:
+					return nil, err
+				}
+			}
+			return results, nil
+		case Wildcard, RecursiveDescent:
+			return nil, merry.Errorf("%v: Get doesn't support wildcards; use GetAll", parsedPath[0:i+1])
+		default:
+			panic(merry.Errorf("Unexpected type for parsed path element: %#v", t))
+		}
+	}
+	return out, nil
+}
+
+// getFold looks up key in m, ignoring case.  Returns AmbiguousKeyError if more than
+// one key matches.
+func getFold(m map[string]interface{}, key string, path Path) (v interface{}, found bool, err error) {
+	var match string
+	for k, value := range m {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		if found {
+			keys := []string{match, k}
+			sort.Strings(keys)
+			return nil, false, AmbiguousKeyError.Here().WithMessagef("%v is ambiguous: matches keys %q and %q", path, keys[0], keys[1])
+		}
+		v, found, match = value, true, k
+	}
+	return v, found, nil
+}
+
+// GetAll returns all the values in v which match path.  In addition to the
+// normal path syntax, path may contain wildcards, written as "*" or "[*]", which
+// match every value of a map, or every element of a slice:
+//
+//	GetAll(v, "resource.tags[*].color") // the color of each tag
+//	GetAll(v, "items[*].prices[0]")     // the first price of each item
+//	GetAll(v, "regions.*.name")         // the name of each region, in key order
+//
+// ".." matches the rest of the path at any depth, in maps and slices, so "..color" returns
+// the value of every "color" key, and "resource..tags[0]" returns the first tag of every
+// "tags" slice under resource:
+//
+//	GetAll(v, "..color")
+//
+// Slice elements are matched in index order, and map values in order of their keys, so
+// the results are deterministic.  With "..", each value comes before its descendants.
+//
+// Empty brackets, like "tags[]", are the same as "[*]", except they only match slices.
+// Unlike Get, the results of wildcards are not nested, so GetAll(v, "a[*].b[*]") returns
+// a flat list.
+//
+// Parts of v which don't match the path are skipped, so if nothing matches, the result is
+// empty.  Only normalization errors are returned.
+func GetAll(v interface{}, path string) ([]interface{}, error) {
+	opt := NormalizeOptions{
+		Marshal:       true,
+		NormalizeTime: true,
+	}
+	parsedPath, err := ParsePath(path)
+	if err != nil {
+		return nil, merry.Prepend(err, "Couldn't parse the path")
+	}
+	if n, ok := v.(Normalized); ok {
+		v = n.v
+	}
+	return getAll(v, parsedPath, &opt, []interface{}{})
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// getAll appends the values in v matching path to results.
+func getAll(v interface{}, path Path, opt *NormalizeOptions, results []interface{}) ([]interface{}, error) {
+	if len(path) == 0 {
+		return append(results, v), nil
+	}
+	v, err := normalize(v, opt)
+	if err != nil {
+		return nil, err
+	}
+	switch t := path[0].(type) {
+	case RecursiveDescent:
+		// match the rest of the path here, then at every descendant
+		if results, err = getAll(v, path[1:], opt, results); err != nil {
+			return nil, err
+		}
+		switch c := v.(type) {
+		case []interface{}:
+			for _, value := range c {
+				if results, err = getAll(value, path, opt, results); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]interface{}:
+			for _, key := range sortedKeys(c) {
+				if results, err = getAll(c[key], path, opt, results); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case string:
+		if m, ok := v.(map[string]interface{}); ok {
+			if value, present := m[t]; present {
+				return getAll(value, path[1:], opt, results)
+			}
+		}
+	case int:
+		if s, ok := v.([]interface{}); ok {
+			if idx, ok := sliceIndex(t, len(s)); ok {
+				return getAll(s[idx], path[1:], opt, results)
+			}
+		}
+	case Wildcard, EachElement:
+		switch c := v.(type) {
+		case []interface{}:
+			for _, value := range c {
+				if results, err = getAll(value, path[1:], opt, results); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]interface{}:
+			if _, each := t.(EachElement); each {
+				break
+			}
+			for _, key := range sortedKeys(c) {
+				if results, err = getAll(c[key], path[1:], opt, results); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		panic(merry.Errorf("Unexpected type for parsed path element: %#v", t))
+	}
+	return results, nil
+}
+
+// PathsEqual tests whether the values at two paths in v are equivalent.  Both
+// values are extracted with Get, then compared with Equivalent, using the options.
+// This is useful for checking consistency between two parts of the same document:
+//
+//	PathsEqual(v, "resource.account", "environment.account")
+//
+// If either path can't be resolved, the error from Get is returned, prefixed
+// with the path which failed.
+func PathsEqual(v interface{}, pathA, pathB string, opts ...ContainsOption) (bool, error) {
+	a, err := Get(v, pathA)
+	if err != nil {
+		return false, merry.Prependf(err, "error getting %s", pathA)
+	}
+	b, err := Get(v, pathB)
+	if err != nil {
+		return false, merry.Prependf(err, "error getting %s", pathB)
+	}
+	return Equivalent(a, b, opts...), nil
+}
+
+// Set returns a copy of v, with value set at path.  value is normalized.  Maps along the
+// path which don't exist are created.  If v is nil, a new map or slice is returned:
+//
+//	Set(nil, "user.name.first", "bob") // {"user":{"name":{"first":"bob"}}}
+//
+// Empty brackets append to a slice, creating the slice if it doesn't exist, so a
+// slice can be built up one element at a time:
+//
+//	v, _ = Set(v, "tags[]", "red")
+//	v, _ = Set(v, "tags[]", "green")   // {"tags":["red","green"]}
+//	v, _ = Set(v, "items[].name", "a") // {"items":[{"name":"a"}]}
+//
+// Slice indexes must be in bounds, or IndexOutOfBoundsError is returned.  If a key
+// or index is applied to a value which isn't a map or slice, PathNotMapError or
+// PathNotSliceError is returned.  Wildcards aren't supported.
+//
+// If path is empty, the normalized value is returned.  v is not modified.
+func Set(v interface{}, path string, value interface{}) (interface{}, error) {
+	parsedPath, err := ParsePath(path)
+	if err != nil {
+		return nil, merry.Prepend(err, "Couldn't parse the path")
+	}
+	value, err = Normalize(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsedPath) == 0 {
+		return value, nil
+	}
+	v, err = Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return setPath(v, parsedPath, 0, value)
+}
+
+// setPath sets parsedPath[i:] in the normalized value v to value, and returns
+// the modified value.  parsedPath[:i] is the path to v.  v may be nil, in which
+// case a new container is created.
+func setPath(v interface{}, parsedPath Path, i int, value interface{}) (interface{}, error) {
+	if i == len(parsedPath) {
+		return value, nil
+	}
+	switch t := parsedPath[i].(type) {
+	case string:
+		if v == nil {
+			v = map[string]interface{}{}
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if i > 0 {
+				return nil, PathNotMapError.Here().WithMessagef("%v is not a map", parsedPath[0:i])
+			}
+			return nil, PathNotMapError.Here().WithMessage("v is not a map")
+		}
+		child, err := setPath(m[t], parsedPath, i+1, value)
+		if err != nil {
+			return nil, err
+		}
+		m[t] = child
+		return m, nil
+	case int, EachElement:
+		if v == nil {
+			v = []interface{}{}
+		}
+		s, ok := v.([]interface{})
+		if !ok {
+			if i > 0 {
+				return nil, PathNotSliceError.Here().WithMessagef("%v is not a slice", parsedPath[0:i])
 			}
-		default:
-			panic("Should be either a map or slice by now")
+			return nil, PathNotSliceError.Here().WithMessage("v is not a slice")
+		}
+		idx, ok := len(s), true
+		if n, isIdx := t.(int); isIdx {
+			idx, ok = sliceIndex(n, len(s))
+		} else {
+			// append
+			s = append(s, nil)
+		}
+		if !ok {
+			return nil, IndexOutOfBoundsError.Here().WithMessagef("Index out of bounds at %v (len = %v)", parsedPath[0:i+1], len(s))
+		}
+		child, err := setPath(s[idx], parsedPath, i+1, value)
+		if err != nil {
+			return nil, err
 		}
+		s[idx] = child
+		return s, nil
+	default:
+		return nil, merry.Errorf("Set doesn't support path element %v", parsedPath[0:i+1])
 	}
-
-	return
 }
 
-func marshal(v interface{}) ([]byte, error) {
-	if msg, ok := v.(proto.Message); ok {
-		return protojson.Marshal(msg)
+// Delete returns a copy of v, with the value at path removed.  If the last element
+// of the path is a map key, the key is deleted.  If it's a slice index, the element
+// is removed, and the remaining elements are shifted down:
+//
+//	Delete(v, "response.things[2]")
+//
+// Deleting a map key which isn't present does nothing.  Otherwise, Delete returns the
+// same errors as Get: PathNotFoundError, PathNotMapError, PathNotSliceError, or
+// IndexOutOfBoundsError, if the path doesn't resolve.  Use DeleteAll to delete
+// paths with wildcards or empty brackets.
+//
+// If path is empty, v is returned.  v is not modified.
+func Delete(v interface{}, path string) (interface{}, error) {
+	parsedPath, err := ParsePath(path)
+	if err != nil {
+		return nil, merry.Prepend(err, "Couldn't parse the path")
 	}
-	return json.Marshal(v)
-}
-
-func slowNormalize(v interface{}, options *NormalizeOptions) (interface{}, error) {
-	b, err := marshal(v)
+	v, err = Normalize(v)
 	if err != nil {
 		return nil, err
 	}
-
-	var v2 interface{}
-	err = json.Unmarshal(b, &v2)
-
-	// if we're normalizing times, we need to run the result back through the normalize function
-	// to convert the string times to time.Time values
-	if options.NormalizeTime {
-		return normalize(v2, options)
+	if len(parsedPath) == 0 {
+		return v, nil
 	}
+	return deletePath(v, parsedPath, 0)
+}
 
-	return v2, err
+// deletePath deletes parsedPath[i:] from the normalized value v, and returns
+// the modified value.  parsedPath[:i] is the path to v.
+func deletePath(v interface{}, parsedPath Path, i int) (interface{}, error) {
+	last := i == len(parsedPath)-1
+	switch t := parsedPath[i].(type) {
+	case string:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if i > 0 {
+				return nil, PathNotMapError.Here().WithMessagef("%v is not a map", parsedPath[0:i])
+			}
+			return nil, PathNotMapError.Here().WithMessage("v is not a map")
+		}
+		if last {
+			delete(m, t)
+			return m, nil
+		}
+		child, present := m[t]
+		if !present {
+			return nil, PathNotFoundError.Here().WithMessagef("%v not found", parsedPath[0:i+1])
+		}
+		child, err := deletePath(child, parsedPath, i+1)
+		if err != nil {
+			return nil, err
+		}
+		m[t] = child
+		return m, nil
+	case int:
+		s, ok := v.([]interface{})
+		if !ok {
+			if i > 0 {
+				return nil, PathNotSliceError.Here().WithMessagef("%v is not a slice", parsedPath[0:i])
+			}
+			return nil, PathNotSliceError.Here().WithMessage("v is not a slice")
+		}
+		idx, ok := sliceIndex(t, len(s))
+		if !ok {
+			return nil, IndexOutOfBoundsError.Here().WithMessagef("Index out of bounds at %v (len = %v)", parsedPath[0:i+1], len(s))
+		}
+		if last {
+			return append(s[:idx], s[idx+1:]...), nil
+		}
+		child, err := deletePath(s[idx], parsedPath, i+1)
+		if err != nil {
+			return nil, err
+		}
+		s[idx] = child
+		return s, nil
+	default:
+		return nil, merry.Errorf("Delete doesn't support path element %v; use DeleteAll", parsedPath[0:i+1])
+	}
 }
 
-// Normalize recursively converts v1 into a tree of maps, slices, and primitives.
-// The types in the result will be the types the json package uses for unmarshalling
-// into interface{}.  The rules are:
+// DeleteAll returns a copy of v, with all the values matching path removed.
+// In addition to the normal path syntax, path may contain wildcard segments:
 //
-// 1. All maps with string keys will be converted into map[string]interface{}
-// 2. All slices will be converted to []interface{}
-// 3. All primitive numeric types will be converted into float64
-// 4. string, bool, and nil are unmodified
-// 5. All other values will be converted into the above types by doing a json.Marshal and Unmarshal
+//   - "*" matches any key of a map, or any element of a slice
+//   - empty brackets, like "items[]", match any element of a slice
+//   - "**", or "..", matches any number of nested levels, including zero
 //
-// Values in v1 will be modified in place if possible
-func Normalize(v1 interface{}, opts ...NormalizeOption) (interface{}, error) {
-	opt := NormalizeOptions{
-		Copy:    true,
-		Marshal: true,
-		Deep:    true,
+// For example:
+//
+//	DeleteAll(v, "**.sha256Fingerprint") // removes every sha256Fingerprint key, at any depth
+//	DeleteAll(v, "items.*.id")           // removes the id key from each element of items
+//	DeleteAll(v, "tags[0]")              // removes the first element of tags
+//
+// Map keys are deleted, and slice elements are removed, shifting the remaining
+// elements down.  When several elements of the same slice match, they are all
+// removed from the original slice, so earlier matches don't shift the indexes of
+// later ones.
+//
+// Paths which don't match anything are ignored.  v is not modified.
+func DeleteAll(v interface{}, path string) (interface{}, error) {
+	parsedPath, err := ParsePath(path)
+	if err != nil {
+		return nil, merry.Prepend(err, "Couldn't parse the path")
 	}
-	for _, option := range opts {
-		option.Apply(&opt)
+	v, err = Normalize(v)
+	if err != nil {
+		return nil, err
 	}
-	return normalize(v1, &opt)
+	if len(parsedPath) == 0 {
+		return v, nil
+	}
+	return deleteAll(v, parsedPath), nil
 }
 
-// PathNotFoundError indicates the requested path was not present in the value.
-var PathNotFoundError = merry.New("Path not found")
-
-// PathNotMapError indicates the value at the path is not a map.
-var PathNotMapError = merry.New("Path not map")
-
-// PathNotSliceError indicates the value at the path is not a slice.
-var PathNotSliceError = merry.New("Path not slice")
-
-// IndexOutOfBoundsError indicates the index doesn't exist in the slice.
-var IndexOutOfBoundsError = merry.New("Index out of bounds")
-
-// Path is a slice of either strings or slice indexes (ints).
-type Path []interface{}
-
-// ParsePath parses a string path into a Path slice.  String paths look
-// like:
-//
-//	user.name.first
-//	user.addresses[3].street
-func ParsePath(path string) (Path, error) {
+// deleteAll removes the values matching path from the normalized value v,
+// and returns the modified value.  Maps are modified in place.
+func deleteAll(v interface{}, path Path) interface{} {
 	if len(path) == 0 {
-		return nil, nil
+		return v
 	}
 
-	parts := strings.Split(path, ".")
-	parsedPath := make(Path, 0, len(parts)+strings.Count(path, "["))
-	for i := 0; i < len(parts); i++ {
-		part := parts[i]
-
-		arrayIdx := -1
-		// first check of the path part ends in an array index, like
-		//
-		//     tags[2]
-		//
-		// Extract the "2", and truncate the part to "tags"
-		if bracketIdx := strings.Index(part, "["); bracketIdx > -1 && strings.HasSuffix(part, "]") {
-			if idx, err := strconv.Atoi(part[bracketIdx+1 : len(part)-1]); err == nil {
-				arrayIdx = idx
-				part = part[0:bracketIdx]
+	if path[0] == (RecursiveDescent{}) {
+		// match zero levels first, then recurse into each of the remaining children
+		// with the same path.
+		v = deleteAll(v, path[1:])
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for key, value := range t {
+				t[key] = deleteAll(value, path)
+			}
+		case []interface{}:
+			for i, value := range t {
+				t[i] = deleteAll(value, path)
 			}
 		}
+		return v
+	}
 
-		part = strings.TrimSpace(part)
-		if len(part) > 0 {
-			parsedPath = append(parsedPath, part)
+	last := len(path) == 1
+	switch t := v.(type) {
+	case map[string]interface{}:
+		key, ok := path[0].(string)
+		_, wildcard := path[0].(Wildcard)
+		if !ok && !wildcard {
+			return v
 		}
-		if arrayIdx > -1 {
-			parsedPath = append(parsedPath, arrayIdx)
+		for k, value := range t {
+			if !wildcard && key != k {
+				continue
+			}
+			if last {
+				delete(t, k)
+			} else {
+				t[k] = deleteAll(value, path[1:])
+			}
 		}
-	}
-	return parsedPath, nil
-}
-
-// String implements the Stringer interface.  It returns the string
-// representation of a Path.  Path.String() and ParsePath() are inversions
-// of each other.
-func (p Path) String() string {
-	buf := bytes.NewBuffer(nil)
-
-	for _, elem := range p {
-		switch t := elem.(type) {
-		case string:
-			if buf.Len() > 0 {
-				buf.WriteString(".")
+	case []interface{}:
+		idx, ok := path[0].(int)
+		if !ok && path[0] != (Wildcard{}) && path[0] != (EachElement{}) {
+			return v
+		}
+		if ok {
+			if idx, ok = sliceIndex(idx, len(t)); !ok {
+				return v
 			}
-			buf.WriteString(t)
-		case int:
-			if strings.HasSuffix(buf.String(), "]") {
-				buf.WriteString(".")
+		}
+		if !last {
+			for i, value := range t {
+				if !ok || i == idx {
+					t[i] = deleteAll(value, path[1:])
+				}
 			}
-			fmt.Fprintf(buf, "[%d]", t)
-		default:
-			panic(merry.Errorf("Path element was not a string or int! elem: %#v", elem))
+			return v
+		}
+		if !ok {
+			// wildcard deletes every element
+			return t[:0]
 		}
+		return append(t[:idx], t[idx+1:]...)
 	}
-	return buf.String()
+	return v
 }
 
-// Get extracts the value at path from v.
-// Path is in the form:
-//
-//	response.things[2].color.red
-//
-// You can use `merry` to test the types of return errors:
+// Prune returns a copy of the normalized value of v, with empty values removed.  Map entries
+// and slice elements are removed if their values are empty, according to Empty, after
+// their own empty values are removed.  So containers which only contained empty values
+// are removed too:
 //
-//	_, err := maps.Get("","")
-//	if merry.Is(err, maps.PathNotFoundError) {
-//	  ...
-//
-// Returns PathNotFoundError if the next key in the path is not found.
-//
-// Returns PathNotMapError if evaluating a key against a value which is not
-// a map (e.g. a slice or a primitive value, against
-// which we can't evaluate a key name).
+//	Prune({"a":{"b":null,"c":[""]},"d":0,"e":1}) // {"e":1}
 //
-// Returns IndexOutOfBoundsError if evaluating a slice index against a
-// slice value, and the index is out of bounds.
+// If v itself is empty after pruning, Prune returns nil.
 //
-// Returns PathNotSliceError if evaluating a slice index against a value which
-// isn't a slice.
-func Get(v interface{}, path string, opts ...NormalizeOption) (interface{}, error) {
-	opt := NormalizeOptions{
-		Marshal:       true,
-		NormalizeTime: true,
+// By default, numeric zeros and false are empty, like with Empty.  The KeepZeros option
+// keeps them, and only removes nils, blank strings, and empty maps and slices.  opts may
+// also include NormalizeOptions, which default to Copy, Marshal, and Deep.  If v can't be
+// normalized, Prune returns nil.  v is not modified.
+func Prune(v interface{}, opts ...NormalizeOption) interface{} {
+	o := PruneOptions{
+		NormalizeOptions: NormalizeOptions{
+			Copy:    true,
+			Marshal: true,
+			Deep:    true,
+		},
 	}
-	for _, option := range opts {
-		option.Apply(&opt)
+	for _, opt := range opts {
+		if po, ok := opt.(PruneOptionFunc); ok {
+			po(&o)
+		} else {
+			opt.Apply(&o.NormalizeOptions)
+		}
 	}
-	opt.Deep = false
-	opt.Copy = false
-
-	parsedPath, err := ParsePath(path)
+	o.Deep = true
+	v, err := normalize(v, &o.NormalizeOptions)
 	if err != nil {
-		return nil, merry.Prepend(err, "Couldn't parse the path")
+		return nil
 	}
-	out := v
-	for i, part := range parsedPath {
-		switch t := part.(type) {
-		case string:
-			out, err = normalize(out, &opt)
-			if err != nil {
-				return nil, err
-			}
-			if m, ok := out.(map[string]interface{}); ok {
-				var present bool
-				if out, present = m[t]; !present {
-					return nil, PathNotFoundError.Here().WithMessagef("%v not found", parsedPath[0:i+1])
-				}
+	eo := emptyOptions{zeroIsNotEmpty: o.KeepZeros}
+	v = prune(v, &eo)
+	if empty(v, &eo) {
+		return nil
+	}
+	return v
+}
+
+// PruneOptions are options for the Prune function.
+type PruneOptions struct {
+	NormalizeOptions
+
+	// Don't prune numeric zeros and false.  See KeepZeros.
+	KeepZeros bool
+}
+
+// PruneOptionFunc is a function which modifies PruneOptions.  It
+// implements NormalizeOption, so it can be passed to Prune along with
+// other NormalizeOptions.
+type PruneOptionFunc func(*PruneOptions)
+
+// Apply implements NormalizeOption.  It does nothing: PruneOptionFuncs only
+// apply to Prune.
+func (f PruneOptionFunc) Apply(*NormalizeOptions) {}
+
+// KeepZeros causes Prune to keep numeric zeros, false, and zero times, which are
+// meaningful values in many documents, like counts and flags:
+//
+//	Prune({"count":0,"name":""})              // nil
+//	Prune({"count":0,"name":""}, KeepZeros()) // {"count":0}
+func KeepZeros() NormalizeOption {
+	return PruneOptionFunc(func(options *PruneOptions) {
+		options.KeepZeros = true
+	})
+}
+
+// prune removes empty values from the normalized value v, in place.
+func prune(v interface{}, o *emptyOptions) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			value = prune(value, o)
+			if empty(value, o) {
+				delete(t, key)
 			} else {
-				if i > 0 {
-					return nil, PathNotMapError.Here().WithMessagef("%v is not a map", parsedPath[0:i])
-				}
-				return nil, PathNotMapError.Here().WithMessage("v is not a map")
+				t[key] = value
 			}
-		case int:
-			// slice index
-			out, err = normalize(out, &opt)
-			if err != nil {
-				return nil, err
-			}
-			if s, ok := out.([]interface{}); ok {
-				if l := len(s); l <= t {
-					return nil, IndexOutOfBoundsError.Here().WithMessagef("Index out of bounds at %v (len = %v)", parsedPath[0:i+1], l)
-				}
-				out = s[t]
-			} else {
-				if i > 0 {
-					return nil, PathNotSliceError.Here().WithMessagef("%v is not a slice", parsedPath[0:i])
-				}
-				return nil, PathNotSliceError.Here().WithMessage("v is not a slice")
+		}
+	case []interface{}:
+		s := t[:0]
+		for _, value := range t {
+			value = prune(value, o)
+			if !empty(value, o) {
+				s = append(s, value)
 			}
-		default:
-			panic(merry.Errorf("Unexpected type for parsed path element: %#v", part))
 		}
+		for i := len(s); i < len(t); i++ {
+			t[i] = nil
+		}
+		return s
 	}
-	return out, nil
+	return v
+}
+
+// sliceIndex resolves a path index against a slice of length l.  Negative
+// indexes count back from the end, so -1 is the last element.  Returns false
+// if the index is out of bounds.
+func sliceIndex(i, l int) (int, bool) {
+	if i < 0 {
+		i += l
+		return i, i >= 0
+	}
+	return i, i < l
 }
 
 // Empty returns true if v is nil, empty, or a zero value.
@@ -1155,6 +5540,73 @@ func Get(v interface{}, path string, opts ...NormalizeOption) (interface{}, erro
 //
 // Strings are empty if they contain nothing but whitespace.
 func Empty(v interface{}) bool {
+	return empty(v, &defaultEmptyOptions)
+}
+
+var defaultEmptyOptions emptyOptions
+
+// EmptyOption is an option which modifies the behavior of EmptyWithOptions.
+type EmptyOption func(*emptyOptions)
+
+type emptyOptions struct {
+	fieldwise      bool // structs are empty if all their exported fields are empty
+	zeroIsNotEmpty bool // numeric zeros, false, and the zero time are not empty
+}
+
+// EmptyFieldwise considers a struct empty if each of its exported fields is
+// empty, recursively.  By default, a struct is only empty if it is equal to its zero
+// value.  With this option, a struct whose only non-zero field is an empty, non-nil slice
+// is empty too:
+//
+//	type Widget struct {
+//	  Tags []string
+//	  seen int
+//	}
+//	Empty(Widget{Tags: []string{}})                                // false
+//	EmptyWithOptions(Widget{Tags: []string{}}, EmptyFieldwise())   // true
+//	EmptyWithOptions(Widget{seen: 1}, EmptyFieldwise())            // true
+//
+// Unexported fields are ignored, since they aren't part of the value's
+// normalized form.  Embedded structs are fields like any other: if exported, they
+// must be empty too.
+func EmptyFieldwise() EmptyOption {
+	return func(o *emptyOptions) {
+		o.fieldwise = true
+	}
+}
+
+// ZeroIsNotEmpty considers numeric zeros, false, and the zero time.Time to be non-empty,
+// for when zero is a meaningful value, like a count.  nil, blank strings, and empty maps,
+// slices, and arrays are still empty:
+//
+//	Empty(0)                                    // true
+//	EmptyWithOptions(0, ZeroIsNotEmpty())       // false
+//	EmptyWithOptions("", ZeroIsNotEmpty())      // true
+//
+// This is the same treatment Prune gives zeros with the KeepZeros option.
+func ZeroIsNotEmpty() EmptyOption {
+	return func(o *emptyOptions) {
+		o.zeroIsNotEmpty = true
+	}
+}
+
+// EmptyWithOptions is like Empty, but with options.
+func EmptyWithOptions(v interface{}, opts ...EmptyOption) bool {
+	var o emptyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return empty(v, &o)
+}
+
+func empty(v interface{}, o *emptyOptions) bool {
+	if o.zeroIsNotEmpty {
+		switch v.(type) {
+		case bool, int, int8, int16, int32, int64, float32, float64, uint, uint8, uint16, uint32, uint64,
+			complex64, complex128, uintptr, time.Time:
+			return false
+		}
+	}
 	switch t := v.(type) {
 	case nil:
 		return true
@@ -1208,13 +5660,29 @@ func Empty(v interface{}) bool {
 		case reflect.Func:
 			return false
 		case reflect.Struct:
+			if o.fieldwise {
+				for i := 0; i < rv.NumField(); i++ {
+					if rv.Type().Field(i).IsExported() && !empty(rv.Field(i).Interface(), o) {
+						return false
+					}
+				}
+				return true
+			}
 			return reflect.DeepEqual(rv.Interface(), reflect.Zero(rv.Type()).Interface())
 		case reflect.UnsafePointer:
 			return false
 		case reflect.Ptr:
 			return !rv.IsValid() || rv.IsNil()
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+			// named types, like time.Duration
+			return !o.zeroIsNotEmpty && rv.IsZero()
+		case reflect.String:
+			// blank, like string
+			return strings.TrimSpace(rv.String()) == ""
 		default:
-			panic(fmt.Sprintf("kind %v should have been handled before this", rv.Kind().String()))
+			return false
 		}
 	}
 }
@@ -1,6 +1,8 @@
 package maps
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,9 +12,14 @@ import (
 	"github.com/k0kubun/pp"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"math"
 	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -60,6 +67,501 @@ func TestMerge(t *testing.T) {
 	assert.Equal(t, dict{"color": "blue"}, m1)
 }
 
+func TestMergeWithError(t *testing.T) {
+	v, err := MergeWithError(dict{"color": "red"}, dict{"size": 1})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"color": "red", "size": 1.0}, v)
+
+	// unmarshalable values
+	_, err = MergeWithError(dict{"color": "red"}, dict{"events": make(chan int)})
+	assert.Error(t, err)
+	_, err = MergeWithError(make(chan int), dict{"size": 1})
+	assert.Error(t, err)
+	assert.Nil(t, Merge(dict{"color": "red"}, dict{"events": make(chan int)}))
+
+	_, err = MergeWithError(dict{"tags": []string{"red"}}, dict{"tags": []string{"green", "blue"}}, MaxMergeNodes(3))
+	assert.True(t, merry.Is(err, MergeTooLargeError), "got %v", err)
+}
+
+func TestMerge_sliceDedup(t *testing.T) {
+	var v1, v2 interface{}
+	require.NoError(t, json.Unmarshal([]byte(`[{"id":1}]`), &v1))
+	require.NoError(t, json.Unmarshal([]byte(`[{"id":1}]`), &v2))
+	assert.Equal(t, []interface{}{dict{"id": 1.0}}, Merge(v1, v2))
+
+	// elements are compared by their normalized values, not their types
+	tests := []struct {
+		name   string
+		v1, v2 interface{}
+		opts   []NormalizeOption
+	}{
+		{"ints", []interface{}{dict{"id": 1}}, []interface{}{dict{"id": 1.0}}, []NormalizeOption{PreserveInts(true)}},
+		{"json numbers", []interface{}{dict{"id": json.Number("1")}}, []interface{}{dict{"id": 1}}, []NormalizeOption{NumbersAsJSONNumber(true)}},
+		{"numbers", []interface{}{1.0, 2}, []interface{}{2.0, 1}, []NormalizeOption{PreserveInts(true)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := Merge(test.v1, test.v2, test.opts...)
+			assert.Len(t, merged, len(test.v1.([]interface{})), "%v", merged)
+		})
+	}
+
+	assert.Len(t, Merge([]interface{}{dict{"id": 1}}, []interface{}{dict{"id": 2}}), 2)
+	assert.Len(t, Merge([]interface{}{dict{"id": 1}}, []interface{}{dict{"id": 1, "color": "red"}}), 2)
+
+	// nested slices are only equal if their elements are in the same order
+	assert.Equal(t, []interface{}{[]interface{}{1.0, 2.0}, []interface{}{2.0, 1.0}},
+		Merge([]interface{}{[]interface{}{1, 2}}, []interface{}{[]interface{}{2, 1}}))
+	assert.Equal(t, []interface{}{[]interface{}{1.0, 1.0, 2.0}, []interface{}{1.0, 2.0, 2.0}},
+		Merge([]interface{}{[]interface{}{1, 1, 2}}, []interface{}{[]interface{}{1, 2, 2}}))
+	assert.Equal(t, []interface{}{dict{"pt": []interface{}{0.0, 1.0}}, dict{"pt": []interface{}{1.0, 0.0}}},
+		Merge([]interface{}{dict{"pt": []interface{}{0, 1}}}, []interface{}{dict{"pt": []interface{}{1, 0}}}))
+	assert.Len(t, Merge([]interface{}{[]interface{}{1, 2}}, []interface{}{[]interface{}{1.0, 2.0}}, PreserveInts(true)), 1)
+}
+
+func TestMerge_sliceIdentity(t *testing.T) {
+	byNameAndZone := SliceIdentity(func(elem interface{}) interface{} {
+		m, ok := elem.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		return [2]interface{}{m["name"], m["zone"]}
+	})
+
+	v1 := dict{
+		"servers": []interface{}{
+			dict{"name": "web", "zone": "east", "size": 1},
+			dict{"name": "web", "zone": "west", "size": 1},
+			"legacy",
+		},
+	}
+	v2 := dict{
+		"servers": []interface{}{
+			dict{"name": "web", "zone": "west", "size": 2, "tags": []string{"new"}},
+			dict{"name": "db", "zone": "east", "size": 4},
+			"legacy",
+			"other",
+		},
+	}
+
+	expected := dict{
+		"servers": []interface{}{
+			dict{"name": "web", "zone": "east", "size": float64(1)},
+			dict{"name": "web", "zone": "west", "size": float64(2), "tags": []interface{}{"new"}},
+			"legacy",
+			dict{"name": "db", "zone": "east", "size": float64(4)},
+			"other",
+		},
+	}
+	assert.Equal(t, expected, Merge(v1, v2, byNameAndZone))
+
+	// without the option, maps which aren't equal are just appended
+	assert.Len(t, Merge(v1, v2).(dict)["servers"], 6)
+
+	// nested slices are merged by identity too
+	byID := SliceIdentity(func(elem interface{}) interface{} {
+		if m, ok := elem.(map[string]interface{}); ok {
+			return m["id"]
+		}
+		return nil
+	})
+	assert.Equal(t,
+		dict{"items": []interface{}{dict{"id": "a", "children": []interface{}{dict{"id": "b", "color": "red", "size": float64(1)}}}}},
+		Merge(
+			dict{"items": []interface{}{dict{"id": "a", "children": []interface{}{dict{"id": "b", "size": 1}}}}},
+			dict{"items": []interface{}{dict{"id": "a", "children": []interface{}{dict{"id": "b", "color": "red"}}}}},
+			byID,
+		),
+	)
+
+	// v1 should not be modified
+	assert.Len(t, v1["servers"], 3)
+	assert.Equal(t, dict{"name": "web", "zone": "west", "size": 1}, v1["servers"].([]interface{})[1])
+}
+
+func TestIntersect(t *testing.T) {
+	tests := []struct {
+		name           string
+		v1, v2, expect interface{}
+	}{
+		{
+			name:   "maps",
+			v1:     dict{"region": "east", "size": 2, "tags": []string{"red", "blue"}, "labels": dict{"env": "prod"}},
+			v2:     dict{"region": "east", "size": 3, "tags": []string{"blue", "green"}, "labels": dict{"env": "dev"}},
+			expect: dict{"region": "east", "tags": []interface{}{"blue"}},
+		},
+		{
+			name: "nested",
+			v1: dict{"resource": dict{
+				"id":     1,
+				"labels": dict{"env": "prod", "tier": "web", "team": "a"},
+				"owner":  dict{"name": "bob"},
+			}},
+			v2: dict{"resource": dict{
+				"id":     2,
+				"labels": dict{"env": "prod", "tier": "web", "team": "b"},
+				"owner":  dict{"name": "alice"},
+			}},
+			expect: dict{"resource": dict{"labels": dict{"env": "prod", "tier": "web"}}},
+		},
+		{
+			name:   "slices of maps match whole elements",
+			v1:     []interface{}{dict{"a": 1, "b": 2}, dict{"a": 3}},
+			v2:     []interface{}{dict{"a": 3}, dict{"a": 1}},
+			expect: []interface{}{dict{"a": float64(3)}},
+		},
+		{
+			name:   "duplicates",
+			v1:     []string{"a", "a", "a", "b"},
+			v2:     []string{"a", "b", "a"},
+			expect: []interface{}{"a", "a", "b"},
+		},
+		{
+			name:   "empty containers",
+			v1:     dict{"tags": []string{}, "labels": dict{}, "color": "red"},
+			v2:     dict{"tags": []string{}, "labels": dict{}, "color": "blue"},
+			expect: dict{"tags": []interface{}{}, "labels": dict{}},
+		},
+		{name: "equal scalars", v1: 5, v2: 5.0, expect: float64(5)},
+		{name: "different scalars", v1: "red", v2: "blue"},
+		{name: "different types", v1: dict{"a": 1}, v2: []int{1}},
+		{name: "nothing in common", v1: dict{"a": 1}, v2: dict{"a": 2, "b": 3}},
+		{name: "struct", v1: Widget{Size: 1, Color: "red"}, v2: dict{"color": "red"}, expect: dict{"color": "red"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := Intersect(test.v1, test.v2)
+			require.NoError(t, err)
+			assert.Equal(t, test.expect, out)
+		})
+	}
+
+	// inputs should not be modified
+	v1 := dict{"color": "red", "size": 1}
+	_, err := Intersect(v1, dict{"color": "red"})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"color": "red", "size": 1}, v1)
+
+	_, err = Intersect(dict{"color": make(chan string)}, dict{})
+	assert.Error(t, err)
+	_, err = Intersect(dict{}, dict{"color": make(chan string)})
+	assert.Error(t, err)
+}
+
+func TestMerge_mergeByKey(t *testing.T) {
+	v1 := dict{
+		"items": []interface{}{
+			dict{"id": 1, "size": 1, "tags": []interface{}{"red"}},
+			dict{"id": 2, "size": 1},
+			dict{"name": "no id"},
+			"scalar",
+		},
+	}
+	v2 := dict{
+		"items": []interface{}{
+			dict{"id": 3, "size": 3},
+			dict{"id": 1, "size": 2, "tags": []interface{}{"blue"}},
+			dict{"name": "no id"},
+			dict{"name": "other"},
+			"scalar",
+		},
+	}
+	expected := dict{
+		"items": []interface{}{
+			dict{"id": 1.0, "size": 2.0, "tags": []interface{}{"red", "blue"}},
+			dict{"id": 2.0, "size": 1.0},
+			dict{"name": "no id"},
+			"scalar",
+			dict{"id": 3.0, "size": 3.0},
+			dict{"name": "other"},
+		},
+	}
+	assert.Equal(t, expected, Merge(v1, v2, MergeByKey("id")))
+
+	// v1 is not modified
+	assert.Equal(t, dict{"id": 1, "size": 1, "tags": []interface{}{"red"}}, v1["items"].([]interface{})[0])
+}
+
+func TestMerge_sliceReplace(t *testing.T) {
+	v1 := dict{"a": dict{"b": []interface{}{5, 6, 7}}, "c": []interface{}{1}}
+	v2 := dict{"a": dict{"b": []interface{}{5, 5, 5, 4}}}
+
+	// the default is still the union
+	assert.Equal(t, dict{"a": dict{"b": []interface{}{5.0, 6.0, 7.0, 4.0}}, "c": []interface{}{1.0}}, Merge(v1, v2))
+
+	assert.Equal(t, dict{"a": dict{"b": []interface{}{5.0, 5.0, 5.0, 4.0}}, "c": []interface{}{1.0}}, Merge(v1, v2, SliceReplace()))
+
+	// slices of maps are replaced, not merged
+	v1 = dict{"a": []interface{}{dict{"id": 1, "size": 1}, dict{"id": 2}}}
+	v2 = dict{"a": []interface{}{dict{"id": 1, "color": "red"}}}
+	byID := SliceIdentity(func(elem interface{}) interface{} {
+		return elem.(map[string]interface{})["id"]
+	})
+	assert.Equal(t, dict{"a": []interface{}{dict{"id": 1.0, "size": 1.0, "color": "red"}, dict{"id": 2.0}}}, Merge(v1, v2, byID))
+	assert.Equal(t, dict{"a": []interface{}{dict{"id": 1.0, "color": "red"}}}, Merge(v1, v2, byID, SliceReplace()))
+
+	// v1 is not modified
+	assert.Equal(t, dict{"a": []interface{}{dict{"id": 1, "size": 1}, dict{"id": 2}}}, v1)
+}
+
+func TestMerge_conflictResolver(t *testing.T) {
+	type call struct {
+		path   string
+		v1, v2 interface{}
+	}
+	var calls []call
+	larger := ConflictResolver(func(path string, a, b interface{}) interface{} {
+		calls = append(calls, call{path, a, b})
+		if fa, ok := a.(float64); ok {
+			if fb, ok := b.(float64); ok && fa > fb {
+				return a
+			}
+		}
+		if sa, ok := a.(string); ok {
+			if sb, ok := b.(string); ok {
+				return sa + sb
+			}
+		}
+		return b
+	})
+
+	v1 := dict{"size": 5, "count": 1, "name": "a", "only1": 1, "tags": []interface{}{"red"}, "nested": dict{"size": 1}}
+	v2 := dict{"size": 3, "count": 2, "name": "b", "only2": 2, "tags": []interface{}{"blue"}, "nested": dict{"size": 2}}
+	expected := dict{
+		"size":   5.0,
+		"count":  2.0,
+		"name":   "ab",
+		"only1":  1.0,
+		"only2":  2.0,
+		"tags":   []interface{}{"red", "blue"},
+		"nested": dict{"size": 2.0},
+	}
+	assert.Equal(t, expected, Merge(v1, v2, larger))
+
+	// only called for keys in both, and not for mergeable maps and slices
+	sort.Slice(calls, func(i, j int) bool { return calls[i].path < calls[j].path })
+	assert.Equal(t, []call{
+		{"count", 1.0, 2.0},
+		{"name", "a", "b"},
+		{"nested.size", 1.0, 2.0},
+		{"size", 5.0, 3.0},
+	}, calls)
+
+	// paths into slices merged by identity, and root values
+	calls = nil
+	byID := SliceIdentity(func(elem interface{}) interface{} {
+		return elem.(map[string]interface{})["id"]
+	})
+	v1 = dict{"servers": []interface{}{dict{"id": 1}, dict{"id": 2, "size": 1}}}
+	v2 = dict{"servers": []interface{}{dict{"id": 2, "size": 4}}}
+	Merge(v1, v2, byID, larger)
+	sort.Slice(calls, func(i, j int) bool { return calls[i].path < calls[j].path })
+	assert.Equal(t, []call{{"servers[1].id", 2.0, 2.0}, {"servers[1].size", 1.0, 4.0}}, calls)
+
+	calls = nil
+	assert.Equal(t, 2.0, Merge(2, 1, larger))
+	assert.Equal(t, []call{{"", 2.0, 1.0}}, calls)
+}
+
+func TestMergeAll(t *testing.T) {
+	defaults := dict{"color": "red", "size": 1, "tags": []string{"a"}, "nested": dict{"x": 1, "y": 1}}
+	site := dict{"size": 2, "tags": []string{"b"}, "nested": dict{"y": 2}}
+	user := dict{"size": 3, "nested": dict{"z": 3}}
+
+	expected := dict{
+		"color":  "red",
+		"size":   3.0,
+		"tags":   []interface{}{"a", "b"},
+		"nested": dict{"x": 1.0, "y": 2.0, "z": 3.0},
+	}
+	assert.Equal(t, expected, MergeAll(defaults, site, user))
+	assert.Equal(t, Merge(Merge(defaults, site), user), MergeAll(defaults, site, user))
+
+	// order matters
+	assert.Equal(t, 1.0, MergeAll(user, site, defaults).(dict)["size"])
+
+	assert.Nil(t, MergeAll())
+	assert.Equal(t, dict{"size": 3.0, "nested": dict{"z": 3.0}}, MergeAll(user))
+
+	// inputs are not modified
+	assert.Equal(t, dict{"size": 3, "nested": dict{"z": 3}}, user)
+	assert.Equal(t, dict{"color": "red", "size": 1, "tags": []string{"a"}, "nested": dict{"x": 1, "y": 1}}, defaults)
+
+	// options
+	assert.Equal(t, []interface{}{"b"}, MergeAllWithOptions([]interface{}{defaults, site, user}, SliceReplace()).(dict)["tags"])
+	assert.Nil(t, MergeAllWithOptions([]interface{}{defaults, site, user}, MaxMergeNodes(5)))
+}
+
+func TestMergeJSONStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected interface{}
+	}{
+		{name: "concatenated", in: `{"color":"red","size":1}{"size":2}`, expected: dict{"color": "red", "size": float64(2)}},
+		{
+			name:     "newline delimited",
+			in:       "{\"labels\":{\"a\":1}}\n{\"labels\":{\"b\":2}}\n{\"tags\":[\"red\"]}\n{\"tags\":[\"blue\"]}\n",
+			expected: dict{"labels": dict{"a": float64(1), "b": float64(2)}, "tags": []interface{}{"red", "blue"}},
+		},
+		{name: "single", in: `{"color":"red"}`, expected: dict{"color": "red"}},
+		{name: "scalars", in: `1 2 "three"`, expected: "three"},
+		{name: "empty", in: ``, expected: nil},
+		{name: "whitespace", in: "  \n ", expected: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := MergeJSONStream(strings.NewReader(test.in))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	// merge options work
+	byID := SliceIdentity(func(elem interface{}) interface{} {
+		return elem.(map[string]interface{})["id"]
+	})
+	out, err := MergeJSONStream(strings.NewReader(`{"items":[{"id":1,"a":1}]} {"items":[{"id":1,"b":2}]}`), byID)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"items": []interface{}{dict{"id": float64(1), "a": float64(1), "b": float64(2)}}}, out)
+
+	// normalize options work
+	out, err = MergeJSONStream(strings.NewReader(`{"createdAt":"2017-03-03T00:00:00Z"}`), NormalizeTime(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"createdAt": time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC)}, out)
+
+	_, err = MergeJSONStream(strings.NewReader(`{"color":"red"} {"size":2} {"size":`))
+	assert.EqualError(t, err, "error decoding document 2: unexpected EOF")
+	_, err = MergeJSONStream(strings.NewReader(`{"color":"red"} blue`))
+	assert.EqualError(t, err, "error decoding document 1: invalid character 'b' looking for beginning of value")
+}
+
+func TestMaxMergeNodes(t *testing.T) {
+	v1 := dict{"a": 1, "b": dict{"c": []interface{}{1, 2}}} // 6 nodes
+	v2 := dict{"b": dict{"c": []interface{}{3}, "d": "x"}, "e": true}
+
+	expected := dict{"a": 1.0, "b": dict{"c": []interface{}{1.0, 2.0, 3.0}, "d": "x"}, "e": true}
+	assert.Equal(t, expected, Merge(v1, v2))
+	// 9 nodes
+	assert.Equal(t, expected, Merge(v1, v2, MaxMergeNodes(9)))
+	assert.Nil(t, Merge(v1, v2, MaxMergeNodes(8)))
+	// v1 alone is too large
+	assert.Nil(t, Merge(v1, dict{}, MaxMergeNodes(5)))
+
+	// replacing a subtree removes its nodes
+	assert.Equal(t, dict{"a": 1.0, "b": 2.0}, Merge(v1, dict{"b": 2}, MaxMergeNodes(3)))
+
+	// slice identity
+	byID := SliceIdentity(func(elem interface{}) interface{} {
+		if m, ok := elem.(map[string]interface{}); ok {
+			return m["id"]
+		}
+		return nil
+	})
+	s1 := []interface{}{dict{"id": 1}} // 3 nodes
+	s2 := []interface{}{dict{"id": 1, "x": 1}, dict{"id": 2}}
+	assert.Len(t, Merge(s1, s2, byID, MaxMergeNodes(6)), 2)
+	assert.Nil(t, Merge(s1, s2, byID, MaxMergeNodes(5)))
+
+	t.Run("stream", func(t *testing.T) {
+		stream := `{"a":1} {"b":2} {"c":[1,2,3]}`
+		v, err := MergeJSONStream(strings.NewReader(stream), MaxMergeNodes(7))
+		require.NoError(t, err)
+		assert.Equal(t, dict{"a": 1.0, "b": 2.0, "c": []interface{}{1.0, 2.0, 3.0}}, v)
+
+		v, err = MergeJSONStream(strings.NewReader(stream), MaxMergeNodes(6))
+		assert.Nil(t, v)
+		assert.True(t, merry.Is(err, MergeTooLargeError), "got %v", err)
+		assert.EqualError(t, err, "merging document 2 exceeded 6 nodes")
+	})
+}
+
+func TestMergeDefaults(t *testing.T) {
+	type Limits struct {
+		Max int `json:"max"`
+	}
+	type Config struct {
+		Host   string   `json:"host"`
+		Port   int      `json:"port"`
+		Debug  bool     `json:"debug"`
+		Tags   []string `json:"tags"`
+		Limits Limits   `json:"limits"`
+	}
+
+	defaults := dict{
+		"host":   "localhost",
+		"port":   80,
+		"tags":   []string{"default"},
+		"limits": dict{"max": 10, "min": 1},
+	}
+
+	tests := []struct {
+		name     string
+		v        interface{}
+		expected dict
+	}{
+		{
+			name: "zero struct",
+			v:    Config{},
+			expected: dict{
+				"host":   "localhost",
+				"port":   float64(80),
+				"tags":   []interface{}{"default"},
+				"limits": dict{"max": float64(10), "min": float64(1)},
+			},
+		},
+		{
+			name: "set fields win",
+			v:    Config{Port: 8080, Debug: true, Limits: Limits{Max: 20}},
+			expected: dict{
+				"host":   "localhost",
+				"port":   float64(8080),
+				"debug":  true,
+				"tags":   []interface{}{"default"},
+				"limits": dict{"max": float64(20), "min": float64(1)},
+			},
+		},
+		{
+			name: "map",
+			v:    dict{"host": " ", "port": 0, "tags": []string{"other"}},
+			expected: dict{
+				"host":   "localhost",
+				"port":   float64(80),
+				"tags":   []interface{}{"default", "other"},
+				"limits": dict{"max": float64(10), "min": float64(1)},
+			},
+		},
+		{
+			name: "nil",
+			v:    nil,
+			expected: dict{
+				"host":   "localhost",
+				"port":   float64(80),
+				"tags":   []interface{}{"default"},
+				"limits": dict{"max": float64(10), "min": float64(1)},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := MergeDefaults(defaults, test.v)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	// defaults should not be modified
+	assert.Equal(t, dict{
+		"host":   "localhost",
+		"port":   80,
+		"tags":   []string{"default"},
+		"limits": dict{"max": 10, "min": 1},
+	}, defaults)
+
+	_, err := MergeDefaults(defaults, dict{"color": make(chan string)})
+	assert.Error(t, err)
+}
+
 func TestKeys(t *testing.T) {
 	tests := []struct {
 		m dict
@@ -75,6 +577,26 @@ func TestKeys(t *testing.T) {
 	}
 }
 
+func TestKeysSorted(t *testing.T) {
+	assert.Equal(t, []string{"color", "price", "weight"}, KeysSorted(dict{"weight": 2, "color": "blue", "price": "high"}))
+	assert.Empty(t, KeysSorted(dict{}))
+	assert.Empty(t, KeysSorted(nil))
+}
+
+func TestValues(t *testing.T) {
+	out := Values(dict{"color": "blue", "price": "high", "weight": 2})
+	assert.ElementsMatch(t, []interface{}{"blue", "high", 2}, out)
+	assert.Empty(t, Values(nil))
+}
+
+func TestEntries(t *testing.T) {
+	m := dict{"weight": 2, "color": "blue", "price": "high"}
+	assert.ElementsMatch(t, []Entry{{"color", "blue"}, {"price", "high"}, {"weight", 2}}, Entries(m))
+	assert.Equal(t, []Entry{{"color", "blue"}, {"price", "high"}, {"weight", 2}}, EntriesSorted(m))
+	assert.Empty(t, Entries(nil))
+	assert.Empty(t, EntriesSorted(dict{}))
+}
+
 func bigNestedMaps(prefix string, nesting int) dict {
 	r := dict{}
 	for i := 0; i < 2; i++ {
@@ -288,6 +810,47 @@ func TestContains(t *testing.T) {
 			options:  []ContainsOption{StringContains()},
 			expected: false,
 		},
+		{
+			v1:       "Red",
+			v2:       "red",
+			expected: false,
+		},
+		{
+			v1:       "Red",
+			v2:       "red",
+			options:  []ContainsOption{CaseInsensitive()},
+			expected: true,
+		},
+		{
+			v1:       dict{"colors": []interface{}{"Red", "BLUE"}},
+			v2:       dict{"colors": []interface{}{"blue"}},
+			options:  []ContainsOption{CaseInsensitive()},
+			expected: true,
+		},
+		{
+			v1:       "The Quick Brown Fox",
+			v2:       "quick brown",
+			options:  []ContainsOption{CaseInsensitive()},
+			expected: false,
+		},
+		{
+			v1:       "The Quick Brown Fox",
+			v2:       "quick brown",
+			options:  []ContainsOption{StringContains()},
+			expected: false,
+		},
+		{
+			v1:       dict{"story": "The Quick Brown Fox"},
+			v2:       dict{"story": "quick BROWN"},
+			options:  []ContainsOption{StringContains(), CaseInsensitive()},
+			expected: true,
+		},
+		{
+			v1:       "red",
+			v2:       "green",
+			options:  []ContainsOption{StringContains(), CaseInsensitive()},
+			expected: false,
+		},
 		{
 			v1:       dict{"color": "blue"},
 			v2:       dict{"color": ""},
@@ -429,6 +992,40 @@ func TestContains(t *testing.T) {
 			options:  []ContainsOption{AllowTimeDelta(time.Microsecond / 2)},
 			expected: false,
 		},
+		{
+			name:     "floatdelta",
+			v1:       float32(0.1),
+			v2:       0.1,
+			expected: false,
+		},
+		{
+			name:     "floatdelta",
+			v1:       float32(0.1),
+			v2:       0.1,
+			options:  []ContainsOption{FloatDelta(1e-6)},
+			expected: true,
+		},
+		{
+			name:     "floatdelta",
+			v1:       dict{"values": []interface{}{1.0, 2.5}},
+			v2:       dict{"values": []interface{}{2.45}},
+			options:  []ContainsOption{FloatDelta(0.1)},
+			expected: true,
+		},
+		{
+			name:     "floatdelta",
+			v1:       5,
+			v2:       5,
+			options:  []ContainsOption{FloatDelta(0.1)},
+			expected: true,
+		},
+		{
+			name:     "floatdelta",
+			v1:       1.0,
+			v2:       1.2,
+			options:  []ContainsOption{FloatDelta(0.1)},
+			expected: false,
+		},
 	}
 
 	spewConf := spew.NewDefaultConfig()
@@ -505,6 +1102,14 @@ v2 -> 2`},
 v1 does not contain v2
 v1 -> "red"
 v2 -> "blue"`},
+			{v1: "Red", v2: "Blue", opts: []ContainsOption{StringContains(), CaseInsensitive()}, expectedTrace: `
+v1 does not contain v2, ignoring case
+v1 -> "Red"
+v2 -> "Blue"`},
+			{v1: dict{"color": "Red"}, v2: dict{"color": "Blue"}, opts: []ContainsOption{CaseInsensitive()}, expectedTrace: `
+values are not equal
+v1.color -> "Red"
+v2.color -> "Blue"`},
 			{v1: dict{"color": "red"}, v2: 1, expectedTrace: `
 values are not equal
 v1 -> map[string]interface {}{"color":"red"}
@@ -545,6 +1150,12 @@ v2.time -> "1987-02-10 06:31:15 -0500 EST"`,
 delta of 1m0s exceeds 30s
 v1.time -> "1987-02-10 06:30:15 -0500 EST"
 v2.time -> "1987-02-10 06:31:15 -0500 EST"`,
+			},
+			{v1: dict{"size": 1}, v2: dict{"size": 1.5}, opts: []ContainsOption{FloatDelta(0.25)},
+				expectedTrace: `
+delta of 0.5 exceeds 0.25
+v1.size -> 1
+v2.size -> 1.5`,
 			},
 			{v1: dict{"time": now}, v2: dict{"time": nowCST}, opts: []ContainsOption{ParseTimes()},
 				expectedTrace: `
@@ -576,6 +1187,75 @@ func TestNormalize_proto(t *testing.T) {
 	assert.Equal(t, dict{"name": "frank", "active": true}, v)
 }
 
+func TestNormalize_protoMarshalOptions(t *testing.T) {
+	s := proto.Sample{
+		Name:      "frank",
+		IsEnabled: true,
+	}
+
+	v, err := Normalize(&s, ProtoMarshalOptions(protojson.MarshalOptions{}))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "frank", "active": true}, v)
+
+	v, err = Normalize(&s, ProtoMarshalOptions(protojson.MarshalOptions{UseProtoNames: true}))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "frank", "is_enabled": true}, v)
+
+	v, err = Normalize(&proto.Sample{}, ProtoMarshalOptions(protojson.MarshalOptions{EmitUnpopulated: true}))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "", "active": false}, v)
+
+	// UseProtoNames is combined with the other options
+	v, err = Normalize(&proto.Sample{}, ProtoMarshalOptions(protojson.MarshalOptions{EmitUnpopulated: true}), UseProtoNames(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "", "is_enabled": false}, v)
+}
+
+func TestContains_protoNames(t *testing.T) {
+	s := &proto.Sample{
+		Name:      "frank",
+		IsEnabled: true,
+	}
+
+	v, err := Normalize(s, UseProtoNames(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "frank", "is_enabled": true}, v)
+
+	snake := dict{"name": "frank", "is_enabled": true}
+	camel := dict{"name": "frank", "active": true}
+
+	// by default, the json names are used
+	assert.True(t, Equivalent(s, camel))
+	assert.False(t, Contains(s, snake))
+
+	// with ProtoNames, the proto names are used
+	assert.True(t, Equivalent(s, snake, ProtoNames()))
+	assert.True(t, Equivalent(snake, s, ProtoNames()))
+	assert.False(t, Contains(s, camel, ProtoNames()))
+
+	var trace string
+	assert.False(t, Equivalent(s, camel, ProtoNames(), Trace(&trace)))
+	assert.Equal(t, `v2 contains extra keys: [active]
+v1 -> map[string]interface {}{"is_enabled":true, "name":"frank"}
+v2 -> map[string]interface {}{"active":true, "name":"frank"}`, trace)
+
+	// the option applies to messages on both sides, at any depth
+	s2 := &proto.Sample{Name: "frank"}
+	assert.True(t, Contains(dict{"sample": s}, dict{"sample": s2}, ProtoNames()))
+	assert.True(t, Contains(dict{"sample": s}, dict{"sample": dict{"is_enabled": true}}, ProtoNames()))
+	assert.False(t, Equivalent(dict{"sample": s}, dict{"sample": s2}, ProtoNames()))
+
+	// zero values are omitted by protojson, so empty values only match
+	// keys which are present, whichever names are used
+	assert.True(t, Contains(s, dict{"is_enabled": false}, ProtoNames(), EmptyValuesMatchAny()))
+	assert.False(t, Contains(s2, dict{"is_enabled": false}, ProtoNames(), EmptyValuesMatchAny()))
+	assert.False(t, Contains(s, dict{"active": false}, ProtoNames(), EmptyValuesMatchAny()))
+	assert.True(t, Contains(s, dict{"active": false}, EmptyValuesMatchAny()))
+
+	// the option doesn't leak into later comparisons
+	assert.True(t, Equivalent(s, camel))
+}
+
 func TestContainsMatch(t *testing.T) {
 	w1 := Widget{
 		Size:  1,
@@ -619,20 +1299,188 @@ func TestContainsMatch(t *testing.T) {
 	assert.True(t, ok, "should have been a channel, was %T", m.V2)
 }
 
-func TestEquivalent(t *testing.T) {
-	v1 := dict{"size": 1, "color": "big", "flavor": "mint"}
-	v2 := Widget{
-		Size:  1,
-		Color: "big",
+func TestHashMatch(t *testing.T) {
+	// compare the results of hashMatch with searching, which a comparator forces
+	searching := Comparator(func(string, interface{}, interface{}) (bool, bool) { return false, false })
+	rnd := rand.New(rand.NewSource(1))
+	elems := []interface{}{"a", "b", "c", 1.0, 2.0, true, false, nil, math.NaN()}
+	randSlice := func() []interface{} {
+		s := make([]interface{}, hashMatchMinLen+rnd.Intn(4))
+		for i := range s {
+			s[i] = elems[rnd.Intn(len(elems))]
+		}
+		return s
+	}
+	for i := 0; i < 500; i++ {
+		v1, v2 := randSlice(), randSlice()
+		if i%3 == 0 {
+			// mostly the same elements
+			v2 = append([]interface{}{}, v1...)
+			rnd.Shuffle(len(v2), func(i, j int) { v2[i], v2[j] = v2[j], v2[i] })
+			v2[0] = elems[rnd.Intn(len(elems))]
+		}
+		assert.Equal(t, Equivalent(v1, v2, searching), Equivalent(v1, v2), "%v %v", v1, v2)
+		assert.Equal(t, Contains(v1, v2, searching), Contains(v1, v2), "%v %v", v1, v2)
+		assert.Equal(t, Contains(v1, v2[:3], searching), Contains(v1, v2[:3]), "%v %v", v1, v2[:3])
 	}
-	assert.True(t, Contains(v1, v2))
 
-	var trace string
-	assert.False(t, Equivalent(v1, v2, Trace(&trace)))
+	long := []interface{}{"a", "a", "b", "b", "c", "c", "d", "d", "e", "e", "f", "f", "g", "g", "h", "h"}
+	assert.True(t, Equivalent(long, append(long[1:], "h")), "duplicates don't need to be balanced")
+	assert.False(t, Equivalent(long, append(long[1:], "i")))
 
-	assert.Equal(t, `v1 contains extra keys: [flavor]
-v1 -> map[string]interface {}{"color":"big", "flavor":"mint", "size":1}
-v2 -> map[string]interface {}{"color":"big", "size":1}`, trace)
+	// falls back to searching for other types, and options which change how primitives match
+	assert.True(t, Contains(long, []interface{}{IsString}))
+	assert.True(t, Contains(long, []interface{}{"A"}, CaseInsensitive()))
+	assert.True(t, Contains(append(long, dict{"color": "red"}), []interface{}{dict{}}))
+
+	// mismatches are explained by searching
+	m := EquivalentMatch(long, append(long[1:], "i"))
+	assert.Contains(t, m.Message, "v2 has elements not in v1: [i]")
+	m = ContainsMatch(long, []interface{}{"i"})
+	assert.Contains(t, m.Message, `v1 does not contain v2[0]: "i"`)
+}
+
+func TestContainsJSON(t *testing.T) {
+	body := []byte(`{"id":5,"color":"red","tags":["a","b"]}`)
+
+	m, err := ContainsJSON(body, []byte(`{"color":"red","tags":["b"]}`))
+	require.NoError(t, err)
+	assert.True(t, m.Matches)
+
+	m, err = ContainsJSON(body, []byte(`{"color":"blue"}`))
+	require.NoError(t, err)
+	assert.False(t, m.Matches)
+	assert.Equal(t, "color", m.Path)
+	assert.Equal(t, ContainsMatch(toMap(string(body)), toMap(`{"color":"blue"}`)), m)
+
+	m, err = ContainsJSON(body, []byte(`{"color":"RED"}`), CaseInsensitive())
+	require.NoError(t, err)
+	assert.True(t, m.Matches)
+
+	// scalars
+	m, err = ContainsJSON([]byte(`"red"`), []byte(` "red" `))
+	require.NoError(t, err)
+	assert.True(t, m.Matches)
+
+	// invalid JSON
+	_, err = ContainsJSON([]byte(`{"color":`), []byte(`{}`))
+	assert.ErrorContains(t, err, "error parsing v1")
+	_, err = ContainsJSON(body, []byte(`{color}`))
+	assert.ErrorContains(t, err, "error parsing v2")
+	_, err = ContainsJSON(nil, []byte(`{}`))
+	assert.Error(t, err)
+}
+
+func TestContainsContext(t *testing.T) {
+	v1 := dict{"color": "red", "tags": []string{"a", "b"}}
+	m, err := ContainsContext(context.Background(), v1, dict{"tags": []string{"b"}})
+	require.NoError(t, err)
+	assert.True(t, m.Matches)
+
+	m, err = ContainsContext(context.Background(), v1, dict{"color": "blue"})
+	require.NoError(t, err)
+	assert.False(t, m.Matches)
+	assert.Equal(t, "color", m.Path)
+
+	// already cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m, err = ContainsContext(ctx, v1, dict{"color": "red"})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, m.Error)
+	assert.False(t, m.Matches)
+
+	// cancelled mid-comparison
+	var items []interface{}
+	for i := 0; i < 200; i++ {
+		items = append(items, dict{"id": i, "name": strconv.Itoa(i)})
+	}
+	big := dict{"items": items}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	cancelling := Comparator(func(string, interface{}, interface{}) (bool, bool) {
+		calls++
+		if calls == 100 {
+			cancel()
+		}
+		return false, false
+	})
+	m, err = ContainsContext(ctx, big, big, cancelling)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, m.Error)
+	assert.False(t, m.Matches)
+	assert.Equal(t, "context canceled", m.Message)
+	assert.Less(t, calls, 100+cancelCheckInterval*2, "should stop soon after cancellation")
+
+	ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	_, err = ContainsContext(ctx, big, big)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestParallel(t *testing.T) {
+	var items1, items2 []interface{}
+	for i := 0; i < 100; i++ {
+		items1 = append(items1, dict{"id": i, "tags": []interface{}{"a", strconv.Itoa(i % 7)}})
+	}
+	for i := 99; i >= 0; i-- {
+		items2 = append(items2, dict{"id": i, "tags": []interface{}{strconv.Itoa(i % 7), "a"}})
+	}
+
+	assert.True(t, Equivalent(items1, items2, Parallel(4)))
+	assert.True(t, Contains(dict{"items": items1}, dict{"items": items2[:10]}, Parallel(4)))
+	assert.True(t, Contains(items1, items2, Parallel(200)), "more workers than elements")
+
+	// mismatches are the same as when searching sequentially
+	items3 := append([]interface{}{}, items2...)
+	items3[10] = dict{"id": 1000}
+	items3[20] = dict{"id": 2000}
+	for _, equiv := range []bool{false, true} {
+		match := ContainsMatch
+		if equiv {
+			match = EquivalentMatch
+		}
+		expected := match(dict{"items": items1}, dict{"items": items3})
+		actual := match(dict{"items": items1}, dict{"items": items3}, Parallel(4))
+		assert.False(t, actual.Matches)
+		assert.Equal(t, expected, actual)
+	}
+
+	// options are used by the goroutines
+	assert.True(t, Contains(items1, []interface{}{dict{"id": 5.2}, dict{"id": 9.9}}, Parallel(2), FloatDelta(0.5)))
+	assert.False(t, Contains(items1, []interface{}{dict{"id": 5.2}, dict{"id": 9.9}}, Parallel(2)))
+
+	// cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int64
+	cancelling := Comparator(func(string, interface{}, interface{}) (bool, bool) {
+		if atomic.AddInt64(&calls, 1) == 50 {
+			cancel()
+		}
+		return false, false
+	})
+	m, err := ContainsContext(ctx, items1, items2, Parallel(4), cancelling)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, m.Error)
+	assert.False(t, m.Matches)
+}
+
+func TestEquivalent(t *testing.T) {
+	v1 := dict{"size": 1, "color": "big", "flavor": "mint"}
+	v2 := Widget{
+		Size:  1,
+		Color: "big",
+	}
+	assert.True(t, Contains(v1, v2))
+
+	var trace string
+	assert.False(t, Equivalent(v1, v2, Trace(&trace)))
+
+	assert.Equal(t, `v1 contains extra keys: [flavor]
+v1 -> map[string]interface {}{"color":"big", "flavor":"mint", "size":1}
+v2 -> map[string]interface {}{"color":"big", "size":1}`, trace)
 
 	// inverse should also be false
 	assert.False(t, Equivalent(v2, v1))
@@ -668,292 +1516,2695 @@ v2 -> map[string]interface {}{"color":"big", "size":1}`, trace)
 
 	assert.True(t, Equivalent([]interface{}{"blue", "red", "green", "green"}, []interface{}{"red", "red", "green", "blue"}))
 	assert.False(t, Equivalent([]interface{}{"blue", "red", "green", "black"}, []interface{}{"red", "red", "green", "blue"}))
-}
 
-func TestEquivalentMatch(t *testing.T) {
-	w1 := Widget{
-		Size:  1,
-		Color: "red",
-	}
-	w2 := Widget{
-		Size:  1,
-		Color: "red",
-	}
-
-	m := EquivalentMatch(w1, w2)
-	assert.True(t, m.Matches)
-	assert.Empty(t, m.Message)
+	// slice mismatches are reported as set differences
+	assert.False(t, Equivalent([]interface{}{"blue", "red", "green"}, []interface{}{"red", "orange", "purple"}, Trace(&trace)))
+	assert.Equal(t, `v2 has elements not in v1: [orange purple]
+v1 has elements not in v2: [blue green]
+v1 -> []interface {}{"blue", "red", "green"}
+v2 -> []interface {}{"red", "orange", "purple"}`, trace)
 
-	w1.Color = "redblue"
-	m = EquivalentMatch(w1, w2)
-	assert.False(t, m.Matches)
-	assert.NotEmpty(t, m.Message)
+	assert.False(t, Equivalent([]interface{}{"blue", "red", "green", "black"}, []interface{}{"red", "red", "green", "blue"}, Trace(&trace)))
+	assert.Equal(t, `v1 has elements not in v2: [black]
+v1 -> []interface {}{"blue", "red", "green", "black"}
+v2 -> []interface {}{"red", "red", "green", "blue"}`, trace)
 
-	m = EquivalentMatch(w1, w2, StringContains())
-	assert.True(t, m.Matches)
+	assert.False(t, Equivalent(dict{"tags": []interface{}{"red", "green"}}, dict{"tags": []interface{}{"red", "blue"}}, Trace(&trace)))
+	assert.Equal(t, `v2 has elements not in v1: [blue]
+v1 has elements not in v2: [green]
+v1.tags -> []interface {}{"red", "green"}
+v2.tags -> []interface {}{"red", "blue"}`, trace)
 
-	// try something that will cause a marshaling error, like a channel value
-	m = EquivalentMatch(w1, dict{"size": 1, "color": make(chan string)})
-	assert.Error(t, m.Error)
-	assert.Contains(t, m.Error.Error(), "json: unsupported type")
-	assert.False(t, m.Matches)
-	assert.NotEmpty(t, m.Message)
-	assert.Contains(t, m.Message, "err normalizing v2")
-	assert.Equal(t, "color", m.Path)
-	assert.Equal(t, "redblue", m.V1)
-	_, ok := m.V2.(chan string)
-	assert.True(t, ok, "should have been a channel, was %T", m.V2)
+	// Contains still reports the first missing element
+	assert.False(t, Contains([]interface{}{"blue", "red", "green"}, []interface{}{"red", "orange", "purple"}, Trace(&trace)))
+	assert.Equal(t, `v1 does not contain v2[1]: "orange"
+v1 -> []interface {}{"blue", "red", "green"}
+v2 -> []interface {}{"red", "orange", "purple"}`, trace)
 }
 
-type dict = map[string]any
-
-func TestConflicts(t *testing.T) {
+func TestNumberAsString(t *testing.T) {
 	tests := []struct {
-		m1, m2   dict
+		v1       interface{}
+		v2       string
 		expected bool
 	}{
-		{
-			dict{"color": "red"},
-			dict{"temp": "hot"},
-			false,
-		},
-		{
-			dict{"color": "red"},
-			dict{"color": "blue"},
-			true,
+		{5712345678901234, "5712", true},
+		{int64(5712345678901234), "5712345678901234", true},
+		{uint64(5712345678901234), "901234", true},
+		{5712345678901234.0, "5712345678901234", true},
+		{1e20, "100000000000000000000", true},
+		{1e20, "e", false},
+		{1.5, "1.5", true},
+		{-42, "-4", true},
+		{json.Number("5712"), "57", true},
+		{5712345678901234, "5713", false},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v %v", test.v1, test.v2), func(t *testing.T) {
+			v1 := dict{"account": test.v1}
+			v2 := dict{"account": test.v2}
+			assert.Equal(t, test.expected, Contains(v1, v2, StringContains(), NumberAsString()))
+			// both options are required
+			assert.False(t, Contains(v1, v2, StringContains()))
+			assert.False(t, Contains(v1, v2, NumberAsString()))
+		})
+	}
+
+	// numbers are still compared to numbers as usual
+	assert.True(t, Contains(5712, 5712, StringContains(), NumberAsString()))
+	assert.False(t, Contains(5712, 57, StringContains(), NumberAsString()))
+	assert.True(t, Contains([]interface{}{1234, 5712345678901234}, []interface{}{"5712"}, StringContains(), NumberAsString()))
+
+	var trace string
+	assert.False(t, Contains(5712345678901234, "5713", StringContains(), NumberAsString(), Trace(&trace)))
+	assert.Contains(t, trace, "v1 does not contain v2")
+}
+
+func TestExactKeys(t *testing.T) {
+	v1 := dict{
+		"color": "red",
+		"tags":  []interface{}{"red", "green"},
+		"labels": dict{
+			"env":  "prod",
+			"tier": "web",
 		},
-		{
-			dict{"color": "red"},
-			dict{"temp": "hot", "color": "red"},
-			false,
+		"rules": []interface{}{
+			dict{"name": "a", "port": 80},
+			dict{"name": "b", "port": 443},
 		},
+	}
+	all := dict{
+		"color":  "red",
+		"tags":   []interface{}{"red", "green"},
+		"labels": dict{"env": "prod", "tier": "web"},
+		"rules":  []interface{}{dict{"name": "a", "port": 80}, dict{"name": "b", "port": 443}},
+	}
+
+	tests := []struct {
+		name                            string
+		v2                              interface{}
+		contains, exactKeys, equivalent bool
+	}{
+		{name: "same", v2: all, contains: true, exactKeys: true, equivalent: true},
+		{name: "extra v1 keys", v2: dict{"color": "red"}, contains: true},
 		{
-			dict{
-				"labels": dict{"region": "west"},
-			},
-			dict{
-				"temp":   "hot",
-				"labels": dict{"region": "west"},
-			},
-			false,
+			name:     "nested extra v1 keys",
+			v2:       dict{"color": "red", "tags": []interface{}{"red", "green"}, "labels": dict{"env": "prod"}, "rules": all["rules"]},
+			contains: true,
 		},
 		{
-			dict{
-				"labels": dict{"region": "east"},
-			},
-			dict{
-				"temp":   "hot",
-				"labels": dict{"region": "west"},
-			},
-			true,
+			name:     "slice subset",
+			v2:       dict{"color": "red", "tags": []interface{}{"green"}, "labels": all["labels"], "rules": all["rules"]},
+			contains: true, exactKeys: true,
 		},
 		{
-			dict{
-				"tags": []string{"green", "red"},
-			},
-			dict{
-				"tags": []string{"orange", "black"},
-			},
-			false,
+			name:     "extra keys in slice elements",
+			v2:       dict{"color": "red", "tags": all["tags"], "labels": all["labels"], "rules": []interface{}{dict{"name": "a"}}},
+			contains: true,
 		},
 		{
-			dict{
-				"tags": []string{"green", "red"},
-			},
-			dict{
-				"tags": []string{"orange", "black", "red"},
-			},
-			false,
+			name:     "slice elements subset",
+			v2:       dict{"color": "red", "tags": all["tags"], "labels": all["labels"], "rules": []interface{}{dict{"name": "a", "port": 80}}},
+			contains: true, exactKeys: true,
 		},
+		{name: "missing v1 key", v2: dict{"size": 1}},
 	}
-
 	for _, test := range tests {
-		assert.Equal(t, test.expected, Conflicts(test.m1, test.m2), pp.Sprintln("m1", test.m1, "m2", test.m2))
-		// should be reflexive
-		assert.Equal(t, test.expected, Conflicts(test.m2, test.m1), pp.Sprintln("inverse m1", test.m1, "m2", test.m2))
-
-	}
-}
-
-func BenchmarkBigMerge(b *testing.B) {
-	m1 := dict{}
-	m1["matches"] = bigNestedMaps("color", 5)
-	m1["notmatches"] = bigNestedMaps("weather", 5)
-	s1 := []interface{}{}
-	for i := 0; i < 100; i++ {
-		s1 = append(s1, bigNestedMaps(fmt.Sprintf("food%v", i), 3))
-	}
-	m1["slice"] = s1
-	m2 := dict{}
-	m2["matches"] = bigNestedMaps("color", 5)
-	m2["notmatches"] = bigNestedMaps("cars", 5)
-	s2 := []interface{}{}
-	for i := 0; i < 100; i++ {
-		s2 = append(s2, bigNestedMaps(fmt.Sprintf("water%v", i), 3))
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.contains, Contains(v1, test.v2))
+			assert.Equal(t, test.exactKeys, Contains(v1, test.v2, ExactKeys()))
+			assert.Equal(t, test.equivalent, Equivalent(v1, test.v2))
+			// no effect on Equivalent
+			assert.Equal(t, test.equivalent, Equivalent(v1, test.v2, ExactKeys()))
+		})
 	}
 
-	b.Run("withCopy", func(b *testing.B) {
-		// pp.Println("m1", m1)
-		for i := 0; i < b.N; i++ {
-			Merge(m1, m2)
-		}
-	})
+	var trace string
+	assert.False(t, Contains(v1, dict{"color": "red"}, ExactKeys(), Trace(&trace)))
+	assert.Contains(t, trace, "v1 contains extra keys: [labels rules tags]")
 
-	b.Run("noCopy", func(b *testing.B) {
-		// pp.Println("m1", m1)
-		for i := 0; i < b.N; i++ {
-			Merge(m1, m2, Copy(false))
-		}
-	})
+	// keys can be exempted
+	assert.True(t, Contains(v1, dict{"color": "red", "tags": []interface{}{}, "rules": []interface{}{}}, ExactKeys(), IgnoreKeys("labels")))
+	assert.True(t, Contains(v1, dict{"color": "red", "tags": []interface{}{}, "rules": []interface{}{}, "labels": dict{"env": "prod"}}, ExactKeys(), AllowExtraKeysUnder("labels")))
 }
 
-func BenchmarkMerge(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		Merge(dict{
-			"colors": dict{
-				"warm": "orange",
-			},
-			"numbers": dict{
-				"odd":  3,
-				"even": 4,
-			},
-		}, dict{
-			"hot": "roof",
-			"colors": dict{
-				"warm": "red",
-				"cool": "blue",
-			},
-			"flavors": dict{
-				"sweet": "chocolate",
-			},
+func TestTemplateMode(t *testing.T) {
+	v1 := dict{
+		"color": "red",
+		"tags":  []interface{}{"red", "green"},
+		"labels": dict{
+			"env":  "prod",
+			"tier": "web",
+		},
+		"rules": []interface{}{
+			dict{"name": "a", "port": 80},
+			dict{"name": "b", "port": 443},
 		},
-		)
 	}
-}
 
-func toMap(s string) (out dict) {
-	if err := json.Unmarshal([]byte(s), &out); err != nil {
-		panic(err)
+	tests := []struct {
+		name     string
+		v2       interface{}
+		expected bool
+	}{
+		{name: "empty", v2: dict{}, expected: true},
+		{name: "extra v1 keys", v2: dict{"color": "red"}, expected: true},
+		{name: "nested extra v1 keys", v2: dict{"labels": dict{"env": "prod"}}, expected: true},
+		{name: "missing v1 key", v2: dict{"size": 1}},
+		{name: "scalar mismatch", v2: dict{"color": "blue"}},
+		{name: "slice any order", v2: dict{"tags": []interface{}{"green", "red"}}, expected: true},
+		{name: "slice subset", v2: dict{"tags": []interface{}{"red"}}},
+		{name: "slice superset", v2: dict{"tags": []interface{}{"red", "green", "blue"}}},
+		{name: "slice vs scalar", v2: dict{"tags": "red"}},
+		{name: "slice elements are templates", v2: dict{"rules": []interface{}{dict{"name": "b"}, dict{"name": "a"}}}, expected: true},
+		{name: "slice elements must all match", v2: dict{"rules": []interface{}{dict{"name": "a"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Contains(v1, test.v2, TemplateMode()))
+			assert.Equal(t, test.expected, Equivalent(v1, test.v2, TemplateMode()))
+		})
 	}
-	return
-}
 
-type Widget struct {
-	Size  int    `json:"size"`
-	Color string `json:"color"`
-}
+	// without TemplateMode, Contains allows slice subsets
+	assert.True(t, Contains(v1, dict{"tags": []interface{}{"red"}}))
+	// and Equivalent doesn't allow extra keys
+	assert.False(t, Equivalent(v1, dict{"color": "red"}))
 
-// specialTime marshals to a time string.
-type specialTime struct {
-	t time.Time
+	var trace string
+	assert.False(t, Contains(v1, dict{"tags": []interface{}{"red"}}, TemplateMode(), Trace(&trace)))
+	assert.Equal(t, `v1 len 2 is not the same as v2 len 1
+v1.tags -> []interface {}{"red", "green"}
+v2.tags -> []interface {}{"red"}`, trace)
 }
 
-func (s *specialTime) MarshalJSON() ([]byte, error) {
-	return json.Marshal(s.t)
-}
+func TestComparator(t *testing.T) {
+	var paths []string
+	rounded := Comparator(func(path string, v1, v2 interface{}) (matched, handled bool) {
+		paths = append(paths, path)
+		f1, ok1 := v1.(float64)
+		f2, ok2 := v2.(float64)
+		if !ok1 || !ok2 {
+			return false, false
+		}
+		return math.Round(f1) == math.Round(f2), true
+	})
 
-func TestNormalize(t *testing.T) {
-	t1 := time.Date(1990, 11, 23, 2, 2, 2, 2, time.FixedZone("testzone", -3*60*60))
+	v1 := dict{"size": 1.2, "items": []interface{}{dict{"price": 4.9}}, "name": "bob"}
+	v2 := dict{"size": 0.8, "items": []interface{}{dict{"price": 5.1}}, "name": "bob"}
+	assert.False(t, Contains(v1, v2))
+	assert.True(t, Contains(v1, v2, rounded))
+	assert.True(t, Equivalent(v1, v2, rounded))
+	assert.Contains(t, paths, "")
+	assert.Contains(t, paths, "size")
+	assert.Contains(t, paths, "items.price")
+	assert.Contains(t, paths, "name")
 
-	n1, err := Normalize(t1)
-	require.NoError(t, err)
+	paths = nil
+	assert.True(t, Contains(v1, v2, rounded, OrderedSlices()))
+	assert.Contains(t, paths, "items[0].price")
 
-	n2, err := Normalize(t1.UTC())
-	require.NoError(t, err)
+	// unhandled values are compared the default way
+	assert.False(t, Contains(v1, dict{"name": "alice"}, rounded))
 
-	m1, err := time.Parse(time.RFC3339Nano, n1.(string))
-	require.NoError(t, err)
-	m2, err := time.Parse(time.RFC3339Nano, n2.(string))
-	require.NoError(t, err)
+	var trace string
+	assert.False(t, Contains(v1, dict{"size": 2}, rounded, Trace(&trace)))
+	assert.Equal(t, `values are not equal
+v1.size -> 1.2
+v2.size -> 2`, trace)
+
+	// the comparator can match values of different types
+	assert.True(t, Contains(dict{"version": "1.2.0"}, dict{"version": 1.2}, Comparator(func(path string, v1, v2 interface{}) (matched, handled bool) {
+		if s, ok := v1.(string); ok {
+			if f, ok := v2.(float64); ok {
+				return strings.HasPrefix(s, strconv.FormatFloat(f, 'f', -1, 64)+"."), true
+			}
+		}
+		return false, false
+	})))
+}
+
+func TestOrderedSlices(t *testing.T) {
+	tests := []struct {
+		name             string
+		v1, v2           interface{}
+		contains, equiv  bool
+		unorderedMatches bool
+	}{
+		{name: "equal", v1: []int{1, 2, 3}, v2: []int{1, 2, 3}, contains: true, equiv: true, unorderedMatches: true},
+		{name: "reversed", v1: []int{1, 2, 3}, v2: []int{3, 2, 1}, unorderedMatches: true},
+		{name: "prefix", v1: []int{1, 2, 3}, v2: []int{1, 2}, contains: true},
+		{name: "not a prefix", v1: []int{1, 2, 3}, v2: []int{2, 3}},
+		{name: "longer v2", v1: []int{1, 2}, v2: []int{1, 2, 3}},
+		{name: "empty v2", v1: []int{1, 2}, v2: []int{}, contains: true},
+		{
+			name:     "maps compared positionally",
+			v1:       []interface{}{dict{"id": 1, "size": 1}, dict{"id": 2}},
+			v2:       []interface{}{dict{"id": 1}},
+			contains: true,
+		},
+		{name: "nested", v1: dict{"a": [][]int{{1, 2}, {3}}}, v2: dict{"a": [][]int{{1, 2}, {3}}}, contains: true, equiv: true, unorderedMatches: true},
+		{name: "nested out of order", v1: dict{"a": [][]int{{1, 2}, {3}}}, v2: dict{"a": [][]int{{2, 1}, {3}}}, unorderedMatches: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.contains, Contains(test.v1, test.v2, OrderedSlices()), "contains")
+			assert.Equal(t, test.equiv, Equivalent(test.v1, test.v2, OrderedSlices()), "equivalent")
+			if test.unorderedMatches {
+				assert.True(t, Equivalent(test.v1, test.v2))
+			}
+		})
+	}
+
+	var trace string
+	assert.False(t, Equivalent(dict{"a": []int{1, 2, 3}}, dict{"a": []int{1, 3, 2}}, OrderedSlices(), Trace(&trace)))
+	assert.Equal(t, `values are not equal
+v1.a[1] -> 2
+v2.a[1] -> 3`, trace)
+}
+
+func TestVectorSlices(t *testing.T) {
+	tests := []struct {
+		name     string
+		v1, v2   interface{}
+		expected bool
+	}{
+		{name: "equal", v1: []float64{0.1, 0.2, 0.3}, v2: []float64{0.1, 0.2, 0.3}, expected: true},
+		{name: "within delta", v1: []float64{0.1, 0.2, 0.3}, v2: []float64{0.1009, 0.1991, 0.3}, expected: true},
+		{name: "exactly delta", v1: []int{1, 2}, v2: []float64{1, 2.001}, expected: true},
+		{name: "exceeds delta", v1: []float64{0.1, 0.2, 0.3}, v2: []float64{0.1, 0.202, 0.3}},
+		{name: "order matters", v1: []float64{0.1, 0.2}, v2: []float64{0.2, 0.1}},
+		{name: "shorter v2", v1: []float64{0.1, 0.2}, v2: []float64{0.1}},
+		{name: "longer v2", v1: []float64{0.1}, v2: []float64{0.1, 0.2}},
+		{name: "mixed number kinds", v1: []interface{}{1, uint8(2), float32(3)}, v2: []interface{}{1.0001, 2, 3}, expected: true},
+		{name: "non numbers compared positionally", v1: []interface{}{"a", 1.0}, v2: []interface{}{"a", 1.0001}, expected: true},
+		{name: "non numbers out of order", v1: []interface{}{"a", "b"}, v2: []interface{}{"b", "a"}},
+		{name: "nested vectors", v1: dict{"coords": [][]float64{{1, 2}, {3, 4}}}, v2: dict{"coords": [][]float64{{1.0001, 2}, {3, 3.9999}}}, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Contains(test.v1, test.v2, VectorSlices(0.001)))
+			assert.Equal(t, test.expected, Equivalent(test.v1, test.v2, VectorSlices(0.001)))
+		})
+	}
+
+	assert.False(t, Contains([]float64{math.NaN()}, []float64{math.NaN()}, VectorSlices(1)))
+
+	var trace string
+	assert.False(t, Contains(dict{"embedding": []float64{0.1, 0.2, 0.3}}, dict{"embedding": []float64{0.1, 0.25, 0.4}}, VectorSlices(0.01), Trace(&trace)))
+	assert.Equal(t, `delta of 0.04999999999999999 at index 1 exceeds 0.01
+v1.embedding[1] -> 0.2
+v2.embedding[1] -> 0.25`, trace)
+
+	assert.False(t, Contains(dict{"embedding": []float64{0.1, 0.2}}, dict{"embedding": []float64{0.1}}, VectorSlices(0.01), Trace(&trace)))
+	assert.Equal(t, `v1 len 2 is not the same as v2 len 1
+v1.embedding -> []interface {}{0.1, 0.2}
+v2.embedding -> []interface {}{0.1}`, trace)
+}
+
+func TestContains_sliceContainsMap(t *testing.T) {
+	v1 := dict{
+		"items": []interface{}{
+			dict{"name": "a", "color": "red", "tags": []interface{}{"big"}},
+			dict{"name": "b", "color": "blue"},
+		},
+	}
+
+	// a map v2 matches if any element of a slice v1 contains it
+	assert.True(t, Contains(v1["items"], dict{"name": "b"}))
+	assert.True(t, Contains(v1["items"], dict{"name": "a", "tags": []string{"big"}}))
+	assert.True(t, Contains(v1, dict{"items": dict{"color": "blue"}}))
+	assert.True(t, Contains(v1["items"], dict{}))
+
+	// the fields must all match the same element
+	assert.False(t, Contains(v1["items"], dict{"name": "a", "color": "blue"}))
+	assert.False(t, Contains(v1["items"], dict{"name": "c"}))
+	assert.False(t, Contains([]interface{}{}, dict{"name": "a"}))
+	assert.False(t, Contains([]interface{}{"a", "b"}, dict{"name": "a"}))
+
+	// works with other options
+	assert.False(t, Contains(v1["items"], dict{"name": "bl"}, StringContains()))
+	assert.True(t, Contains(v1["items"], dict{"color": "lu"}, StringContains()))
+	assert.True(t, Contains(v1["items"], dict{"name": "b", "color": ""}, EmptyValuesMatchAny()))
+
+	// in equivalent mode, both sides must be slices
+	assert.False(t, Equivalent(v1["items"], dict{"name": "b", "color": "blue"}))
+	assert.False(t, Contains(v1["items"], dict{"name": "b", "color": "blue"}, TemplateMode()))
+
+	var trace string
+	assert.False(t, Contains(v1, dict{"items": dict{"name": "c"}}, Trace(&trace)))
+	assert.Equal(t, `v1 does not contain v2
+v1.items -> []interface {}{map[string]interface {}{"color":"red", "name":"a", "tags":[]interface {}{"big"}}, map[string]interface {}{"color":"blue", "name":"b"}}
+v2.items -> map[string]interface {}{"name":"c"}`, trace)
+}
+
+func TestDecodeBase64(t *testing.T) {
+	tests := []struct {
+		name     string
+		v1, v2   interface{}
+		expected bool
+	}{
+		{name: "bytes vs std", v1: []byte("hello?"), v2: "aGVsbG8/", expected: true},
+		{name: "std vs bytes", v1: "aGVsbG8/", v2: []byte("hello?"), expected: true},
+		{name: "url", v1: []byte("hello?"), v2: "aGVsbG8_", expected: true},
+		{name: "unpadded", v1: []byte("hi"), v2: "aGk", expected: true},
+		{name: "padded", v1: []byte("hi"), v2: "aGk=", expected: true},
+		{name: "numbers", v1: []int{104, 105}, v2: "aGk=", expected: true},
+		{name: "empty", v1: []byte{}, v2: "", expected: true},
+		{name: "different bytes", v1: []byte("hello"), v2: "aGk="},
+		{name: "subset of bytes", v1: []byte("hello"), v2: "aGVs"},
+		{name: "not base64", v1: []byte("hi"), v2: "hi!"},
+		{name: "not bytes", v1: []int{104, 1050}, v2: "aGk="},
+		{name: "not integers", v1: []float64{104.5, 105}, v2: "aGk="},
+		{name: "strings aren't decoded", v1: "aGk=", v2: "aGk"},
+		{name: "nested", v1: dict{"data": []byte("hi")}, v2: dict{"data": "aGk="}, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Contains(test.v1, test.v2, DecodeBase64()))
+			assert.Equal(t, test.expected, Equivalent(test.v1, test.v2, DecodeBase64()))
+		})
+	}
+
+	// slices which aren't byte arrays are searched for the string, as usual
+	assert.True(t, Contains([]string{"red", "green"}, "red", DecodeBase64()))
+	assert.True(t, Contains([]string{"red", "hi!"}, "hi!", DecodeBase64()))
+	assert.True(t, Contains([]interface{}{104, "aGk="}, "aGk=", DecodeBase64()))
+
+	// without the option, the values don't match
+	assert.False(t, Contains([]byte("hi"), "aGk="))
+	assert.False(t, Contains("aGk=", []byte("hi")))
+
+	var trace string
+	assert.False(t, Contains(dict{"data": []int{104, 101, 108, 108, 111}}, dict{"data": "aGk="}, DecodeBase64(), Trace(&trace)))
+	assert.Equal(t, `decoded base64 bytes are not equal
+v1.data -> []interface {}{104, 101, 108, 108, 111}
+v2.data -> "aGk="`, trace)
+}
+
+func TestIgnoreKeys(t *testing.T) {
+	v1, err := Normalize(json.RawMessage(largeTestVal1))
+	require.NoError(t, err)
+	v2, err := Normalize(json.RawMessage(largeTestVal1))
+	require.NoError(t, err)
+
+	// change the volatile fields, at different depths
+	for _, section := range []string{"resource", "environment"} {
+		m := v2.(dict)[section].(dict)
+		m["createdAt"] = "2024-01-01T00:00:00Z"
+		m["updatedAt"] = "2024-01-01T00:00:00Z"
+		m["uuid"] = "00000000-0000-0000-0000-000000000000"
+	}
+	delete(v2.(dict)["environment"].(dict), "uuid")
+	v2.(dict)["principal"].(dict)["cust"].(dict)["uuid"] = "new"
+
+	volatile := IgnoreKeys("createdAt", "updatedAt", "uuid")
+	assert.False(t, Equivalent(v1, v2))
+	assert.True(t, Equivalent(v1, v2, volatile))
+	assert.True(t, Equivalent(v2, v1, volatile))
+	assert.True(t, Contains(v1, v2, volatile))
+	assert.True(t, Contains(v2, v1, volatile))
+
+	// keys are matched exactly
+	assert.False(t, Equivalent(v1, v2, IgnoreKeys("CreatedAt", "updatedAt", "uuid")))
+	assert.False(t, Equivalent(v1, v2, IgnoreKeys("createdAt", "updatedAt")))
+
+	// other differences are still detected
+	v2.(dict)["resource"].(dict)["state"] = "Deactivated"
+	var trace string
+	assert.False(t, Equivalent(v1, v2, volatile, Trace(&trace)))
+	assert.Equal(t, `values are not equal
+v1.resource.state -> "Active"
+v2.resource.state -> "Deactivated"`, trace)
+}
+
+func TestOnlyKeys(t *testing.T) {
+	v1 := dict{
+		"resource": dict{"state": "Active", "name": "a", "tags": []interface{}{dict{"color": "red", "size": 1}}},
+		"owner":    "bob",
+	}
+	v2 := dict{
+		"resource": dict{"state": "Active", "name": "b", "tags": []interface{}{dict{"color": "red", "size": 2}}},
+	}
+
+	assert.False(t, Equivalent(v1, v2))
+	assert.True(t, Equivalent(v1, v2, OnlyKeys("resource.state")))
+	assert.True(t, Contains(v1, v2, OnlyKeys("resource.state")))
+	assert.True(t, Equivalent(v1, v2, OnlyKeys("resource.state", "resource.tags[*].color")))
+	assert.True(t, Equivalent(v1, v2, OnlyKeys("resource.state"), OnlyKeys("resource.tags[*].color")))
+	assert.False(t, Equivalent(v1, v2, OnlyKeys("resource.state", "resource.name")))
+	assert.False(t, Equivalent(v1, v2, OnlyKeys("resource.tags")))
+
+	// paths missing from both sides match, but not from just v1
+	assert.True(t, Equivalent(v1, v2, OnlyKeys("nope")))
+	assert.False(t, Contains(v2, v1, OnlyKeys("owner")))
+	assert.True(t, Contains(v1, v2, OnlyKeys("owner")))
+	assert.False(t, Equivalent(v1, v2, OnlyKeys("owner")))
+
+	// in equiv mode, extra keys are only detected within the paths
+	v3 := dict{"resource": dict{"state": "Active", "name": "a", "tags": []interface{}{dict{"color": "red", "size": 1}}}}
+	assert.True(t, Equivalent(v1, v3, OnlyKeys("resource")))
+	v3["resource"].(dict)["extra"] = true
+	assert.False(t, Equivalent(v3, v1, OnlyKeys("resource")))
+	assert.True(t, Contains(v3, v1, OnlyKeys("resource")))
+
+	// matchers and structs
+	assert.True(t, Contains(v1, dict{"resource": dict{"state": IsString, "name": 5}}, OnlyKeys("resource.state")))
+	type resource struct {
+		State string `json:"state"`
+		Name  string `json:"name"`
+	}
+	assert.True(t, Equivalent(dict{"resource": resource{State: "Active", Name: "c"}}, v2, OnlyKeys("resource.state")))
+
+	var trace string
+	assert.False(t, Equivalent(v1, v2, OnlyKeys("resource.name", "owner"), Trace(&trace)))
+	assert.Contains(t, trace, "resource")
+
+	assert.False(t, Contains(v1, v2, OnlyKeys("a..b")))
+}
+
+func TestIgnoreKeys_sliceElements(t *testing.T) {
+	v1 := dict{
+		"items": []interface{}{
+			dict{"id": 1, "name": "a", "parts": []interface{}{dict{"id": 10, "size": 1}}},
+			dict{"id": 2, "name": "b"},
+		},
+	}
+	v2 := dict{
+		"items": []interface{}{
+			dict{"id": 7, "name": "b"},
+			dict{"id": 8, "name": "a", "parts": []interface{}{dict{"id": 11, "size": 1}}},
+		},
+	}
+
+	assert.False(t, Equivalent(v1, v2))
+	assert.True(t, Equivalent(v1, v2, IgnoreKeys("id")))
+	assert.True(t, Contains(v1, v2, IgnoreKeys("id")))
+
+	// ignored keys don't need to be present on either side
+	v3 := dict{"items": []interface{}{dict{"name": "b"}, dict{"name": "a", "parts": []interface{}{dict{"size": 1}}}}}
+	assert.True(t, Equivalent(v1, v3, IgnoreKeys("id")))
+	assert.True(t, Equivalent(v3, v1, IgnoreKeys("id")))
+
+	// positional comparison works too
+	assert.False(t, Equivalent(v1, v2, IgnoreKeys("id"), VectorSlices(0)))
+	assert.True(t, Equivalent(v1, dict{"items": []interface{}{dict{"name": "a", "parts": []interface{}{dict{"size": 1}}}, dict{"name": "b"}}}, IgnoreKeys("id"), VectorSlices(0)))
+
+	// other fields must still match
+	v2["items"].([]interface{})[0].(dict)["name"] = "c"
+	assert.False(t, Equivalent(v1, v2, IgnoreKeys("id")))
+
+	// in equiv mode, extra keys are still detected when the maps are the same length
+	assert.False(t, Equivalent(dict{"id": 1, "name": "a"}, dict{"uuid": 1, "name": "a"}, IgnoreKeys("uuid")))
+	assert.True(t, Equivalent(dict{"id": 1, "name": "a"}, dict{"uuid": 1, "name": "a"}, IgnoreKeys("uuid", "id")))
+	assert.True(t, Equivalent(dict{"id": 1, "name": "a"}, dict{"uuid": 1, "name": "a"}, IgnoreKeys("uuid"), IgnoreKeys("id")))
+
+	var trace string
+	assert.False(t, Equivalent(dict{"id": 1, "name": "a", "color": "red"}, dict{"id": 2, "name": "a"}, IgnoreKeys("id"), Trace(&trace)))
+	assert.Equal(t, `v1 contains extra keys: [color]
+v1 -> map[string]interface {}{"color":"red", "id":1, "name":"a"}
+v2 -> map[string]interface {}{"id":2, "name":"a"}`, trace)
+}
+
+func TestParseDurations(t *testing.T) {
+	tests := []struct {
+		v1, v2   interface{}
+		opts     []ContainsOption
+		expected bool
+	}{
+		{"1m30s", "90s", nil, true},
+		{"1m30s", "91s", nil, false},
+		{"1s", 1000000000, nil, true},
+		{1000000000, "1s", nil, true},
+		{"1s", 1e9, nil, true},
+		{"1s", json.Number("1000000000"), nil, true},
+		{time.Second.String(), int64(time.Second), nil, true},
+		{"1s", 1.5, nil, false},
+		{"1s", "one second", nil, false},
+		{"1s", true, nil, false},
+		// numbers are compared as usual
+		{1000, 1001, []ContainsOption{AllowDurationDelta(time.Second)}, false},
+		// delta
+		{"1m30s", "91s", []ContainsOption{AllowDurationDelta(time.Second)}, true},
+		{"91s", "1m30s", []ContainsOption{AllowDurationDelta(time.Second)}, true},
+		{"1m30s", "92s", []ContainsOption{AllowDurationDelta(time.Second)}, false},
+		{"1s", int64(time.Second + time.Millisecond), []ContainsOption{AllowDurationDelta(time.Millisecond)}, true},
+	}
+	for _, test := range tests {
+		opts := append([]ContainsOption{ParseDurations()}, test.opts...)
+		assert.Equal(t, test.expected, Contains(dict{"timeout": test.v1}, dict{"timeout": test.v2}, opts...), "%#v %#v", test.v1, test.v2)
+	}
+
+	// the option is needed
+	assert.False(t, Contains(dict{"timeout": "1m30s"}, dict{"timeout": "90s"}))
+	// AllowDurationDelta implies it
+	assert.True(t, Contains(dict{"timeout": "1m30s"}, dict{"timeout": "90s"}, AllowDurationDelta(0)))
+	// in slices
+	assert.True(t, Equivalent([]string{"1h", "1m", "1s"}, []interface{}{"60m", "60s", int64(time.Second)}, ParseDurations()))
+
+	var trace string
+	assert.False(t, Contains(dict{"timeout": "1m30s"}, dict{"timeout": "92s"}, AllowDurationDelta(time.Second), Trace(&trace)))
+	assert.Equal(t, "delta of 2s exceeds 1s\nv1.timeout -> \"1m30s\"\nv2.timeout -> \"1m32s\"", trace)
+	assert.False(t, Contains(dict{"timeout": "1m30s"}, dict{"timeout": "92s"}, ParseDurations(), Trace(&trace)))
+	assert.Equal(t, "values are not equal\nv1.timeout -> \"1m30s\"\nv2.timeout -> \"1m32s\"", trace)
+}
+
+func TestTraceStruct(t *testing.T) {
+	var info TraceInfo
+	var trace string
+	v1 := dict{"resource": dict{"color": "red", "size": 1}}
+	assert.False(t, Contains(v1, dict{"resource": dict{"color": "blue"}}, TraceStruct(&info), Trace(&trace)))
+	assert.Equal(t, TraceInfo{Path: "resource.color", Reason: "values are not equal", V1: "red", V2: "blue"}, info)
+	assert.Equal(t, "values are not equal\nv1.resource.color -> \"red\"\nv2.resource.color -> \"blue\"", trace)
+
+	assert.False(t, Contains(v1, dict{"resource": dict{"owner": "bob"}}, TraceStruct(&info)))
+	assert.Equal(t, "resource", info.Path)
+	assert.Equal(t, "v2 contains extra keys: [owner]", info.Reason)
+	assert.Equal(t, dict{"color": "red", "size": 1}, info.V1)
+	assert.Equal(t, dict{"owner": "bob"}, info.V2)
+
+	// reset when containment is true
+	assert.True(t, Contains(v1, dict{"resource": dict{"size": 1}}, TraceStruct(&info)))
+	assert.Equal(t, TraceInfo{}, info)
+
+	// nil is ignored
+	assert.False(t, Contains(v1, dict{"color": "red"}, TraceStruct(nil)))
+}
+
+func TestTracePointerPaths(t *testing.T) {
+	v1 := dict{"resource": dict{"tags": []string{"red"}, "a/b": dict{"c~d": 1}}, "coords": []float64{1, 2}}
+
+	var trace string
+	assert.False(t, Contains(v1, dict{"resource": dict{"tags": []string{"blue"}}}, TracePointerPaths(), Trace(&trace)))
+	assert.Equal(t, `v1 does not contain v2[0]: "blue"
+v1/resource/tags -> []interface {}{"red"}
+v2/resource/tags -> []interface {}{"blue"}`, trace)
+
+	// special characters are escaped
+	m := ContainsMatch(v1, dict{"resource": dict{"a/b": dict{"c~d": 2}}}, TracePointerPaths())
+	assert.False(t, m.Matches)
+	assert.Equal(t, "/resource/a~1b/c~0d", m.Path)
+	assert.Equal(t, `values are not equal
+v1/resource/a~1b/c~0d -> 1
+v2/resource/a~1b/c~0d -> 2`, m.Message)
+
+	// slice indexes
+	m = ContainsMatch(v1, dict{"coords": []float64{1, 3}}, TracePointerPaths(), VectorSlices(0))
+	assert.Equal(t, "/coords/1", m.Path)
+
+	// root
+	m = ContainsMatch("red", "blue", TracePointerPaths())
+	assert.Equal(t, "", m.Path)
+	assert.Equal(t, `values are not equal
+v1 -> "red"
+v2 -> "blue"`, m.Message)
+
+	// dotted paths are the default
+	m = ContainsMatch(v1, dict{"resource": dict{"a/b": dict{"c~d": 2}}})
+	assert.Equal(t, "resource.a/b.c~d", m.Path)
+}
+
+func TestEmptyContainersMatchAbsent(t *testing.T) {
+	type Thing struct {
+		Name   string            `json:"name"`
+		Tags   []string          `json:"tags"`
+		Labels map[string]string `json:"labels"`
+		Parts  []string          `json:"parts,omitempty"`
+	}
+
+	v2 := dict{"name": "a"}
+
+	tests := []struct {
+		name   string
+		v1, v2 interface{}
+	}{
+		{name: "nil slice", v1: Thing{Name: "a"}, v2: v2},
+		{name: "empty slice", v1: Thing{Name: "a", Tags: []string{}, Labels: map[string]string{}}, v2: v2},
+		{name: "empty v2 slice", v1: Thing{Name: "a"}, v2: dict{"name": "a", "tags": []string{}, "parts": []interface{}{}}},
+		{name: "null vs empty", v1: Thing{Name: "a"}, v2: dict{"name": "a", "tags": []string{}, "labels": dict{}}},
+		{name: "nested", v1: dict{"thing": Thing{Name: "a"}}, v2: dict{"thing": dict{"name": "a", "parts": nil}}},
+		{name: "in slices", v1: []Thing{{Name: "a"}}, v2: []interface{}{dict{"name": "a", "labels": dict{}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.False(t, Equivalent(test.v1, test.v2))
+			assert.True(t, Equivalent(test.v1, test.v2, EmptyContainersMatchAbsent()))
+			assert.True(t, Equivalent(test.v2, test.v1, EmptyContainersMatchAbsent()))
+			assert.True(t, Contains(test.v1, test.v2, EmptyContainersMatchAbsent()))
+		})
+	}
+
+	// non-empty containers still must match
+	assert.False(t, Equivalent(Thing{Name: "a", Tags: []string{"red"}}, v2, EmptyContainersMatchAbsent()))
+	assert.False(t, Contains(Thing{Name: "a"}, dict{"tags": []string{"red"}}, EmptyContainersMatchAbsent()))
+	assert.False(t, Contains(Thing{Name: "a"}, dict{"tags": []string{}, "color": "red"}, EmptyContainersMatchAbsent()))
+
+	// other empty values are not treated as absent
+	assert.False(t, Equivalent(dict{"name": "a", "size": 0}, v2, EmptyContainersMatchAbsent()))
+	assert.False(t, Equivalent(dict{"name": "a", "color": ""}, v2, EmptyContainersMatchAbsent()))
+
+	var trace string
+	assert.False(t, Equivalent(dict{"name": "a", "tags": []string{}, "color": "red"}, v2, EmptyContainersMatchAbsent(), Trace(&trace)))
+	assert.Equal(t, `v1 contains extra keys: [color]
+v1 -> map[string]interface {}{"color":"red", "name":"a", "tags":[]string{}}
+v2 -> map[string]interface {}{"name":"a"}`, trace)
+}
+
+func TestTraceClosestMatch(t *testing.T) {
+	v1 := dict{
+		"users": []interface{}{
+			dict{"name": "alice", "role": "admin", "team": "a"},
+			dict{"name": "bob", "role": "user", "team": "b"},
+			dict{"name": "carol", "role": "user", "team": "a"},
+		},
+	}
+
+	var trace string
+	assert.False(t, Contains(v1, dict{"users": []interface{}{dict{"name": "bob", "role": "admin", "team": "b"}}}, TraceClosestMatch(), Trace(&trace)))
+	assert.Equal(t, `v1 does not contain v2[0]: "map[name:bob role:admin team:b]"
+closest match is v1[1], which differs:
+  values are not equal
+  v1.role -> "user"
+  v2.role -> "admin"
+v1.users -> []interface {}{map[string]interface {}{"name":"alice", "role":"admin", "team":"a"}, map[string]interface {}{"name":"bob", "role":"user", "team":"b"}, map[string]interface {}{"name":"carol", "role":"user", "team":"a"}}
+v2.users -> []interface {}{map[string]interface {}{"name":"bob", "role":"admin", "team":"b"}}`, trace)
+
+	// map v2 against a slice v1
+	m := ContainsMatch(v1["users"], dict{"name": "carol", "role": "user", "team": "c"}, TraceClosestMatch())
+	assert.False(t, m.Matches)
+	assert.Equal(t, "", m.Path)
+	assert.Contains(t, m.Message, `v1 does not contain v2
+closest match is v1[2], which differs:
+  values are not equal
+  v1.team -> "a"
+  v2.team -> "c"`)
+
+	// nested slices count towards the score
+	m = ContainsMatch(
+		[]interface{}{dict{"tags": []string{"a"}, "x": 1}, dict{"tags": []string{"a", "b"}, "x": 2}},
+		[]interface{}{dict{"tags": []string{"a", "b"}, "x": 3}},
+		TraceClosestMatch(),
+	)
+	assert.Contains(t, m.Message, `closest match is v1[1], which differs:`)
+
+	// the option is needed
+	m = ContainsMatch(v1["users"], dict{"name": "carol", "team": "b"})
+	assert.Equal(t, `v1 does not contain v2
+v1 -> []interface {}{map[string]interface {}{"name":"alice", "role":"admin", "team":"a"}, map[string]interface {}{"name":"bob", "role":"user", "team":"b"}, map[string]interface {}{"name":"carol", "role":"user", "team":"a"}}
+v2 -> map[string]interface {}{"name":"carol", "team":"b"}`, m.Message)
+
+	// and doesn't change the result
+	assert.True(t, Contains(v1, dict{"users": []interface{}{dict{"name": "bob"}}}, TraceClosestMatch(), Trace(&trace)))
+	assert.False(t, Contains(v1, dict{"users": dict{"name": "dan"}}, TraceClosestMatch()))
+}
+
+func TestCollectAll(t *testing.T) {
+	v1 := dict{
+		"color": "red",
+		"size":  1,
+		"owner": dict{"name": "bob", "team": "a"},
+		"tags":  []string{"x", "y"},
+	}
+	v2 := dict{
+		"color": "blue",
+		"size":  1,
+		"owner": dict{"name": "alice", "team": "b", "role": "admin"},
+		"tags":  []string{"z"},
+	}
+
+	m := ContainsMatch(v1, v2, CollectAll())
+	assert.False(t, m.Matches)
+	var paths []string
+	for _, mm := range m.Mismatches {
+		paths = append(paths, mm.Path)
+	}
+	assert.Equal(t, []string{"color", "owner", "owner.name", "owner.team", "tags"}, paths)
+	assert.Equal(t, Mismatch{
+		Path:    "owner.name",
+		V1:      "bob",
+		V2:      "alice",
+		Message: "values are not equal\nv1.owner.name -> \"bob\"\nv2.owner.name -> \"alice\"",
+		Reason:  "values are not equal",
+	}, m.Mismatches[2])
+	assert.Contains(t, m.Mismatches[1].Message, "v2 contains extra keys: [role]")
+
+	// the first mismatch is in the other fields
+	assert.Equal(t, "color", m.Path)
+	assert.Equal(t, "red", m.V1)
+	assert.Equal(t, "blue", m.V2)
+	assert.Equal(t, m.Mismatches[0].Message, m.Message)
+
+	// without the option, only the first is reported
+	m = ContainsMatch(v1, v2)
+	assert.False(t, m.Matches)
+	assert.Empty(t, m.Mismatches)
+	assert.NotEmpty(t, m.Path)
+
+	// Equivalent, and ordered slices
+	m = EquivalentMatch(
+		dict{"ids": []int{1, 2, 3}, "extra": true},
+		dict{"ids": []int{1, 5, 6}},
+		CollectAll(), OrderedSlices(),
+	)
+	paths = nil
+	for _, mm := range m.Mismatches {
+		paths = append(paths, mm.Path)
+	}
+	assert.Equal(t, []string{"", "ids[1]", "ids[2]"}, paths)
+	assert.Contains(t, m.Mismatches[0].Message, "v1 contains extra keys: [extra]")
+
+	// indexes are sorted numerically
+	ids1, ids2 := make([]int, 12), make([]int, 12)
+	ids2[2], ids2[10], ids2[11] = 1, 1, 1
+	m = ContainsMatch(dict{"ids": ids1}, dict{"ids": ids2}, CollectAll(), OrderedSlices())
+	paths = nil
+	for _, mm := range m.Mismatches {
+		paths = append(paths, mm.Path)
+	}
+	assert.Equal(t, []string{"ids[2]", "ids[10]", "ids[11]"}, paths)
+	assert.Equal(t, "ids[2]", m.Path)
+
+	// matches
+	m = ContainsMatch(v1, dict{"size": 1}, CollectAll())
+	assert.True(t, m.Matches)
+	assert.Empty(t, m.Mismatches)
+
+	// no effect on Contains
+	assert.False(t, Contains(v1, v2, CollectAll()))
+	assert.True(t, Contains(v1, dict{"color": "red"}, CollectAll()))
+}
+
+func TestFlatten(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		v        interface{}
+		opts     []NormalizeOption
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:     "nested",
+			v:        dict{"a": dict{"b": []int{1, 2}}, "c": "red"},
+			expected: dict{"a.b[0]": 1.0, "a.b[1]": 2.0, "c": "red"},
+		},
+		{
+			name:     "escaped keys",
+			v:        dict{"a.b": 1, "a": dict{"b": 2, "[0]": 3}},
+			expected: dict{`a\.b`: 1.0, "a.b": 2.0, `a.\[0]`: 3.0},
+		},
+		{
+			name:     "separator",
+			v:        dict{"a": dict{"b": []int{1, 2}}, "c": "red"},
+			opts:     []NormalizeOption{FlattenSeparator("_")},
+			expected: dict{"a_b[0]": 1.0, "a_b[1]": 2.0, "c": "red"},
+		},
+		{
+			name:     "slices as leaves",
+			v:        dict{"a": dict{"b": []interface{}{1, dict{"c": 2}}}},
+			opts:     []NormalizeOption{SlicesAsLeaves()},
+			expected: dict{"a.b": []interface{}{1.0, dict{"c": 2.0}}},
+		},
+		{
+			name:     "times",
+			v:        dict{"a": dict{"b": now}},
+			opts:     []NormalizeOption{NormalizeTime(true)},
+			expected: dict{"a.b": now},
+		},
+		{
+			name:     "empty containers",
+			v:        dict{"a": dict{}, "b": []interface{}{}},
+			expected: dict{"a": dict{}, "b": []interface{}{}},
+		},
+		{
+			name:     "leaf",
+			v:        5,
+			expected: dict{"": 5.0},
+		},
+		{
+			name: "collision",
+			v:    dict{"a_b": 1, "a": dict{"b": 2}},
+			opts: []NormalizeOption{FlattenSeparator("_")},
+			err:  "flattened key collision at a_b",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := Flatten(test.v, test.opts...)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, f)
+		})
+	}
+
+	// flattened keys are paths to the leaves
+	v := dict{"a": dict{"b": []interface{}{1, dict{"c.d": "x"}}, "[e]": true}, "": "blank"}
+	f, err := Flatten(v)
+	require.NoError(t, err)
+	assert.Len(t, f, 4)
+	for key, value := range f {
+		actual, err := Get(v, key)
+		require.NoError(t, err, key)
+		assert.True(t, Equivalent(value, actual), key)
+	}
+}
+
+func TestUnflatten(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        map[string]interface{}
+		expected interface{}
+		err      string
+	}{
+		{
+			name:     "nested",
+			m:        dict{"a.b[0]": 1, "a.b[1]": 2, "c": "red"},
+			expected: dict{"a": dict{"b": []interface{}{1, 2}}, "c": "red"},
+		},
+		{
+			name:     "grow slices",
+			m:        dict{"a[2].b": 1, "a[0]": "x"},
+			expected: dict{"a": []interface{}{"x", nil, dict{"b": 1}}},
+		},
+		{
+			name:     "escaped keys",
+			m:        dict{`a\.b`: 1, "a.b": 2},
+			expected: dict{"a.b": 1, "a": dict{"b": 2}},
+		},
+		{
+			name:     "root",
+			m:        dict{"": 5},
+			expected: 5,
+		},
+		{
+			name:     "empty",
+			m:        dict{},
+			expected: dict{},
+		},
+		{
+			name: "leaf and nested",
+			m:    dict{"a": 1, "a.b": 2},
+			err:  `keys "a" and "a.b" conflict`,
+		},
+		{
+			name: "map and slice",
+			m:    dict{"a[0]": 1, "a.b": 2},
+			err:  `keys "a.b" and "a[0]" conflict`,
+		},
+		{
+			name: "root and nested",
+			m:    dict{"": 1, "a": 2},
+			err:  `keys "" and "a" conflict`,
+		},
+		{
+			name: "wildcard",
+			m:    dict{"a.*": 1},
+			err:  `invalid key "a.*": only map keys and slice indexes are supported`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := Unflatten(test.m)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				if strings.Contains(test.err, "conflict") {
+					assert.True(t, merry.Is(err, UnflattenConflictError))
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, v)
+		})
+	}
+
+	// round trip
+	for _, v := range []interface{}{
+		dict{"a": dict{"b": []interface{}{1.0, dict{"c.d": "x", "e": []interface{}{}}}, "[f]": true}, "": "blank", "g": dict{}},
+		[]interface{}{nil, "a", []interface{}{1.0, 2.0}},
+		"leaf",
+	} {
+		f, err := Flatten(v)
+		require.NoError(t, err)
+		u, err := Unflatten(f)
+		require.NoError(t, err)
+		assert.Equal(t, v, u)
+	}
+}
+
+func TestFlattenBeforeCompare(t *testing.T) {
+	flat := dict{"foo.bar": 1, "foo.baz": 2, "tags": []interface{}{dict{"name.first": "bob"}, "red"}}
+	nested := dict{"foo": dict{"bar": 1, "baz": 2}, "tags": []interface{}{dict{"name": dict{"first": "bob"}}, "red"}}
+
+	assert.False(t, Contains(flat, dict{"foo": dict{"bar": 1}}))
+	assert.True(t, Contains(flat, dict{"foo": dict{"bar": 1}}, FlattenBeforeCompare()))
+	assert.True(t, Contains(nested, dict{"foo.baz": 2}, FlattenBeforeCompare()))
+	assert.True(t, Equivalent(flat, nested, FlattenBeforeCompare()))
+
+	// slices are still compared as slices
+	assert.True(t, Contains(nested, dict{"tags": []interface{}{"red"}}, FlattenBeforeCompare()))
+	assert.False(t, Contains(nested, dict{"tags.[1]": "red"}, FlattenBeforeCompare()))
+
+	// matchers still work
+	assert.True(t, Contains(flat, dict{"foo": dict{"bar": NumberBetween(0, 5)}}, FlattenBeforeCompare()))
+
+	// colliding keys fall back to comparing without flattening
+	assert.False(t, Contains(dict{"a.b": 1, "a": dict{"b": 2}}, dict{"a.b": 2}, FlattenBeforeCompare()))
+	assert.True(t, Contains(dict{"a.b": 1, "a": dict{"b": 2}}, dict{"a": dict{"b": 2}}, FlattenBeforeCompare()))
+}
+
+func TestAllowExtraKeysUnder(t *testing.T) {
+	v1 := dict{
+		"resource": dict{
+			"name": "a",
+			"meta": dict{"etag": "x", "labels": dict{"app": "web", "added": "yes"}},
+		},
+		"items": []interface{}{
+			dict{"id": 1, "meta": dict{"created": "now"}},
+			dict{"id": 2, "meta": dict{}, "extra": true},
+		},
+	}
+	v2 := dict{
+		"resource": dict{
+			"name": "a",
+			"meta": dict{"labels": dict{"app": "web"}},
+		},
+		"items": []interface{}{
+			dict{"id": 1, "meta": dict{}},
+			dict{"id": 2, "meta": dict{}},
+		},
+	}
+
+	assert.False(t, Equivalent(v1, v2))
+	assert.False(t, Equivalent(v1, v2, AllowExtraKeysUnder("resource.meta")))
+	assert.True(t, Equivalent(v1, v2, AllowExtraKeysUnder("resource.meta", "items")))
+	assert.True(t, Equivalent(v1, v2, AllowExtraKeysUnder("resource.meta"), AllowExtraKeysUnder("items[]")))
+
+	var trace string
+	assert.False(t, Equivalent(v1, v2, AllowExtraKeysUnder("resource.meta", "items[].meta"), Trace(&trace)))
+	assert.Contains(t, trace, "v1 has elements not in v2: [map[extra:true id:2 meta:map[]]]")
+
+	// only relaxes keys in v1
+	assert.False(t, Equivalent(v2, v1, AllowExtraKeysUnder("resource", "items")))
+
+	// a path under a key doesn't relax the key's parent
+	assert.False(t, Equivalent(dict{"a": dict{"b": 1}, "c": 2}, dict{"a": dict{"b": 1}}, AllowExtraKeysUnder("a")))
+}
+
+func TestEquivalentMatch(t *testing.T) {
+	w1 := Widget{
+		Size:  1,
+		Color: "red",
+	}
+	w2 := Widget{
+		Size:  1,
+		Color: "red",
+	}
+
+	m := EquivalentMatch(w1, w2)
+	assert.True(t, m.Matches)
+	assert.Empty(t, m.Message)
+
+	w1.Color = "redblue"
+	m = EquivalentMatch(w1, w2)
+	assert.False(t, m.Matches)
+	assert.NotEmpty(t, m.Message)
+
+	m = EquivalentMatch(w1, w2, StringContains())
+	assert.True(t, m.Matches)
+
+	// try something that will cause a marshaling error, like a channel value
+	m = EquivalentMatch(w1, dict{"size": 1, "color": make(chan string)})
+	assert.Error(t, m.Error)
+	assert.Contains(t, m.Error.Error(), "json: unsupported type")
+	assert.False(t, m.Matches)
+	assert.NotEmpty(t, m.Message)
+	assert.Contains(t, m.Message, "err normalizing v2")
+	assert.Equal(t, "color", m.Path)
+	assert.Equal(t, "redblue", m.V1)
+	_, ok := m.V2.(chan string)
+	assert.True(t, ok, "should have been a channel, was %T", m.V2)
+}
+
+type dict = map[string]any
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		m1, m2   dict
+		expected bool
+	}{
+		{
+			dict{"color": "red"},
+			dict{"temp": "hot"},
+			false,
+		},
+		{
+			dict{"color": "red"},
+			dict{"color": "blue"},
+			true,
+		},
+		{
+			dict{"color": "red"},
+			dict{"temp": "hot", "color": "red"},
+			false,
+		},
+		{
+			dict{
+				"labels": dict{"region": "west"},
+			},
+			dict{
+				"temp":   "hot",
+				"labels": dict{"region": "west"},
+			},
+			false,
+		},
+		{
+			dict{
+				"labels": dict{"region": "east"},
+			},
+			dict{
+				"temp":   "hot",
+				"labels": dict{"region": "west"},
+			},
+			true,
+		},
+		{
+			dict{
+				"tags": []string{"green", "red"},
+			},
+			dict{
+				"tags": []string{"orange", "black"},
+			},
+			false,
+		},
+		{
+			dict{
+				"tags": []string{"green", "red"},
+			},
+			dict{
+				"tags": []string{"orange", "black", "red"},
+			},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Conflicts(test.m1, test.m2), pp.Sprintln("m1", test.m1, "m2", test.m2))
+		// should be reflexive
+		assert.Equal(t, test.expected, Conflicts(test.m2, test.m1), pp.Sprintln("inverse m1", test.m1, "m2", test.m2))
+
+	}
+}
+
+func BenchmarkBigMerge(b *testing.B) {
+	m1 := dict{}
+	m1["matches"] = bigNestedMaps("color", 5)
+	m1["notmatches"] = bigNestedMaps("weather", 5)
+	s1 := []interface{}{}
+	for i := 0; i < 100; i++ {
+		s1 = append(s1, bigNestedMaps(fmt.Sprintf("food%v", i), 3))
+	}
+	m1["slice"] = s1
+	m2 := dict{}
+	m2["matches"] = bigNestedMaps("color", 5)
+	m2["notmatches"] = bigNestedMaps("cars", 5)
+	s2 := []interface{}{}
+	for i := 0; i < 100; i++ {
+		s2 = append(s2, bigNestedMaps(fmt.Sprintf("water%v", i), 3))
+	}
+
+	b.Run("withCopy", func(b *testing.B) {
+		// pp.Println("m1", m1)
+		for i := 0; i < b.N; i++ {
+			Merge(m1, m2)
+		}
+	})
+
+	b.Run("noCopy", func(b *testing.B) {
+		// pp.Println("m1", m1)
+		for i := 0; i < b.N; i++ {
+			Merge(m1, m2, Copy(false))
+		}
+	})
+}
+
+func BenchmarkMerge(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Merge(dict{
+			"colors": dict{
+				"warm": "orange",
+			},
+			"numbers": dict{
+				"odd":  3,
+				"even": 4,
+			},
+		}, dict{
+			"hot": "roof",
+			"colors": dict{
+				"warm": "red",
+				"cool": "blue",
+			},
+			"flavors": dict{
+				"sweet": "chocolate",
+			},
+		},
+		)
+	}
+}
+
+func toMap(s string) (out dict) {
+	if err := json.Unmarshal([]byte(s), &out); err != nil {
+		panic(err)
+	}
+	return
+}
+
+type Widget struct {
+	Size  int    `json:"size"`
+	Color string `json:"color"`
+}
+
+// specialTime marshals to a time string.
+type specialTime struct {
+	t time.Time
+}
+
+func (s *specialTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.t)
+}
+
+func TestNormalize(t *testing.T) {
+	t1 := time.Date(1990, 11, 23, 2, 2, 2, 2, time.FixedZone("testzone", -3*60*60))
+
+	n1, err := Normalize(t1)
+	require.NoError(t, err)
+
+	n2, err := Normalize(t1.UTC())
+	require.NoError(t, err)
+
+	m1, err := time.Parse(time.RFC3339Nano, n1.(string))
+	require.NoError(t, err)
+	m2, err := time.Parse(time.RFC3339Nano, n2.(string))
+	require.NoError(t, err)
 
 	assert.Zero(t, m1.Sub(m2))
 
 	tests := []struct {
-		name    string
-		in, out interface{}
-		opts    []NormalizeOption
+		name    string
+		in, out interface{}
+		opts    []NormalizeOption
+	}{
+		// basic no-op types of cases
+		{in: 5, out: float64(5)},
+		{in: "red", out: "red"},
+		{},
+		{in: float64(10), out: float64(10)},
+		{in: float32(12), out: float64(12)},
+		{in: true, out: true},
+		{in: dict{"red": "green"}, out: dict{"red": "green"}},
+		{in: []interface{}{"red", 4}, out: []interface{}{"red", float64(4)}},
+		{in: []string{"red", "green"}, out: []interface{}{"red", "green"}},
+		// hits the marshaling currentPath
+		{in: &Widget{Size: 5, Color: "red"}, out: dict{"size": float64(5), "color": "red"}},
+		// marshaling might occur deep
+		{in: dict{"widget": &Widget{Size: 5, Color: "red"}}, out: dict{"widget": dict{"size": float64(5), "color": "red"}}},
+		{
+			name: "marshaller",
+			in:   json.RawMessage(`{"color":"blue"}`),
+			out:  dict{"color": "blue"},
+			opts: []NormalizeOption{Marshal(true)},
+		},
+		{in: t1, out: "1990-11-23T02:02:02.000000002-03:00"},
+		{in: t1.UTC(), out: "1990-11-23T05:02:02.000000002Z"},
+		{in: t1, out: t1, opts: []NormalizeOption{NormalizeTime(true)}},
+		{in: &specialTime{t: t1.UTC()}, out: t1.UTC(), opts: []NormalizeOption{NormalizeTime(true)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out interface{}
+			var err error
+			out, err = Normalize(test.in, test.opts...)
+
+			require.NoError(t, err)
+			require.Equal(t, test.out, out, "in: %v", pp.Sprint(test.in))
+		})
+	}
+}
+
+func TestNormalize_errorPath(t *testing.T) {
+	v := dict{"resource": dict{"meta": dict{"foo": make(chan string)}}}
+	_, err := Normalize(v)
+	require.Error(t, err)
+	assert.EqualError(t, err, "error normalizing at resource.meta.foo: json: unsupported type: chan string")
+
+	assert.Equal(t, Path{"resource", "meta", "foo"}, NormalizeErrorPath(err))
+	var uerr *json.UnsupportedTypeError
+	assert.True(t, errors.As(err, &uerr), "the cause can still be unwrapped")
+
+	_, err = Normalize(dict{"items": []interface{}{1, dict{"events": make(chan int)}}})
+	assert.EqualError(t, err, "error normalizing at items[1].events: json: unsupported type: chan int")
+
+	// top level values have no path
+	_, err = Normalize(make(chan int))
+	assert.EqualError(t, err, "json: unsupported type: chan int")
+
+	m := ContainsMatch(dict{"resource": dict{"events": make(chan int)}}, dict{"resource": dict{"events": 1}})
+	assert.EqualError(t, m.Error, "error normalizing at resource.events: json: unsupported type: chan int")
+}
+
+func TestNormalize_commonTypes(t *testing.T) {
+	type ints []int
+	type floats []float64
+	type bools []bool
+	type intMap map[string]int
+	tests := []struct {
+		v, reflected interface{}
+	}{
+		{[]string{"a", "b"}, namedStrings{"a", "b"}},
+		{[]string{}, namedStrings{}},
+		{[]string(nil), namedStrings(nil)},
+		{[]int{1, 2}, ints{1, 2}},
+		{[]float64{1.5}, floats{1.5}},
+		{[]bool{true, false}, bools{true, false}},
+		{map[string]string{"color": "red"}, namedStringMap{"color": "red"}},
+		{map[string]string(nil), namedStringMap(nil)},
+		{map[string]int{"size": 1}, intMap{"size": 1}},
+	}
+	opts := [][]NormalizeOption{
+		nil,
+		{Deep(false)},
+		{Copy(false), Deep(false)},
+		{PreserveInts(true)},
+		{NumbersAsJSONNumber(true)},
+	}
+	for _, test := range tests {
+		for _, o := range opts {
+			expected, err := Normalize(test.reflected, o...)
+			require.NoError(t, err)
+			actual, err := Normalize(test.v, o...)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual, "%#v", test.v)
+		}
+	}
+}
+
+func TestSQLNullTypes(t *testing.T) {
+	tm := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		v        interface{}
+		expected interface{}
+	}{
+		{sql.NullString{String: "x", Valid: true}, "x"},
+		{sql.NullString{String: "x"}, nil},
+		{sql.NullInt64{Int64: 5, Valid: true}, 5.0},
+		{sql.NullInt64{Int64: 5}, nil},
+		{sql.NullInt32{Int32: 5, Valid: true}, 5.0},
+		{sql.NullInt32{Int32: 5}, nil},
+		{sql.NullBool{Bool: true, Valid: true}, true},
+		{sql.NullBool{Bool: true}, nil},
+		{sql.NullFloat64{Float64: 1.5, Valid: true}, 1.5},
+		{sql.NullFloat64{Float64: 1.5}, nil},
+		{sql.NullTime{Time: tm, Valid: true}, tm.Format(time.RFC3339Nano)},
+		{sql.NullTime{Time: tm}, nil},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%#v", test.v), func(t *testing.T) {
+			n, err := Normalize(dict{"col": test.v}, SQLNullTypes(true))
+			require.NoError(t, err)
+			assert.Equal(t, dict{"col": test.expected}, n)
+
+			// without the option, marshaled like other structs
+			n, err = Normalize(test.v)
+			require.NoError(t, err)
+			assert.IsType(t, dict{}, n)
+		})
+	}
+
+	n, err := Normalize(sql.NullTime{Time: tm, Valid: true}, SQLNullTypes(true), NormalizeTime(true))
+	require.NoError(t, err)
+	assert.Equal(t, tm, n)
+}
+
+type stringerChan chan int
+
+func (stringerChan) String() string {
+	return "a channel"
+}
+
+func TestStringerFallback(t *testing.T) {
+	v := dict{"events": stringerChan(make(chan int))}
+	_, err := Normalize(v)
+	assert.Error(t, err)
+
+	n, err := Normalize(v, StringerFallback(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"events": "a channel"}, n)
+
+	_, err = Normalize(v, StringerFallback(true), StringerFallback(false))
+	assert.Error(t, err)
+
+	// only used when marshaling fails
+	n, err = Normalize(dict{"d": time.Duration(5)}, StringerFallback(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"d": 5.0}, n)
+
+	// values which aren't Stringers still fail
+	_, err = Normalize(dict{"events": make(chan int)}, StringerFallback(true))
+	assert.Error(t, err)
+}
+
+func TestNormalize_syncMap(t *testing.T) {
+	var sm sync.Map
+	sm.Store("color", "red")
+	sm.Store("size", 5)
+	sm.Store("tags", []string{"a", "b"})
+	sm.Store(1, "one")
+
+	n, err := Normalize(&sm)
+	require.NoError(t, err)
+	assert.Equal(t, dict{
+		"color": "red",
+		"size":  5.0,
+		"tags":  []interface{}{"a", "b"},
+		"1":     "one",
+	}, n)
+
+	n, err = Normalize((*sync.Map)(nil))
+	require.NoError(t, err)
+	assert.Nil(t, n)
+
+	assert.True(t, Contains(dict{"cache": &sm}, dict{"cache": dict{"color": "red", "tags": []string{"b"}}}))
+	assert.False(t, Contains(&sm, dict{"color": "blue"}))
+	assert.Equal(t, dict{"color": "blue", "size": 5.0, "tags": []interface{}{"a", "b"}, "1": "one"}, Merge(&sm, dict{"color": "blue"}))
+
+	// keys which convert to the same string collide
+	sm.Store("1", "also one")
+	_, err = Normalize(&sm)
+	assert.True(t, merry.Is(err, KeyCollisionError), "got %v", err)
+	assert.EqualError(t, err, `keys 1 and "1" both convert to "1"`)
+	_, err = Normalize(dict{"cache": &sm})
+	assert.True(t, merry.Is(err, KeyCollisionError), "got %v", err)
+}
+
+func TestParseTimeLayouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		layouts  []string
+		expected interface{}
+	}{
+		{"rfc3339nano", "2023-07-12T14:14:27.000000005Z", nil, time.Date(2023, 7, 12, 14, 14, 27, 5, time.UTC)},
+		{"rfc3339", "2023-07-12T14:14:27Z", nil, time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC)},
+		{"date only", "2023-07-12", nil, time.Date(2023, 7, 12, 0, 0, 0, 0, time.UTC)},
+		{"space not in defaults", "2023-07-12 14:14:27", nil, "2023-07-12 14:14:27"},
+		{"custom layout", "2023-07-12 14:14:27", []string{"2006-01-02 15:04:05"}, time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC)},
+		{"tried in order", "2023-07-12", []string{time.RFC3339, "2006-01-02"}, time.Date(2023, 7, 12, 0, 0, 0, 0, time.UTC)},
+		{"replaces defaults", "2023-07-12", []string{time.Kitchen}, "2023-07-12"},
+		{"not a time", "red", nil, "red"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opt := NormalizeTime(true)
+			if test.layouts != nil {
+				opt = ParseTimeLayouts(test.layouts...)
+			}
+			n, err := Normalize(dict{"t": test.s}, opt)
+			require.NoError(t, err)
+			assert.Equal(t, dict{"t": test.expected}, n)
+		})
+	}
+
+	v1 := dict{"created": "2023-07-12 14:14:27"}
+	assert.False(t, Contains(v1, dict{"created": time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC)}, ParseTimes()))
+	assert.True(t, Contains(dict{"created": "2023-07-12"}, dict{"created": time.Date(2023, 7, 12, 0, 0, 0, 0, time.UTC)}, ParseTimes()))
+	assert.True(t, Contains(v1, dict{"created": time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC)}, ParseTimesWithLayouts("2006-01-02 15:04:05")))
+	assert.True(t, Equivalent(v1, dict{"created": "2023-07-12T14:14:27Z"}, ParseTimesWithLayouts(time.RFC3339, "2006-01-02 15:04:05")))
+	assert.False(t, Contains(v1, dict{"created": time.Date(2023, 7, 12, 14, 14, 28, 0, time.UTC)}, ParseTimesWithLayouts("2006-01-02 15:04:05")))
+
+	got, err := GetTime(v1, "created", ParseTimeLayouts("2006-01-02 15:04:05"))
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 7, 12, 14, 14, 27, 0, time.UTC), got)
+	_, err = GetTime(v1, "created")
+	assert.True(t, merry.Is(err, PathNotTimeError), "got %v", err)
+}
+
+type cyclicNode struct {
+	Name string
+	Next *cyclicNode
+}
+
+func TestNormalize_cycles(t *testing.T) {
+	m := dict{"color": "red"}
+	m["self"] = m
+	_, err := Normalize(m)
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+	// the path ends where the cycle first repeats
+	assert.Equal(t, Path{"self"}, NormalizeErrorPath(err))
+	assert.Contains(t, err.Error(), "error normalizing at self: ")
+
+	s := []interface{}{"a", nil}
+	s[1] = s
+	_, err = Normalize(dict{"items": s})
+	assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+	assert.Equal(t, Path{"items", 1}, NormalizeErrorPath(err))
+
+	// typed maps are converted to new maps at each level
+	type typedMap map[string]interface{}
+	tm := typedMap{}
+	tm["self"] = tm
+	_, err = Normalize(tm, Copy(false))
+	assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+
+	// structs are marshaled
+	n := &cyclicNode{Name: "a"}
+	n.Next = n
+	_, err = Normalize(n)
+	assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+
+	// shared values aren't cycles
+	shared := dict{"color": "red"}
+	v, err := Normalize(dict{"a": shared, "b": []interface{}{shared, shared}})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"a": dict{"color": "red"}, "b": []interface{}{dict{"color": "red"}, dict{"color": "red"}}}, v)
+
+	// deeply nested values aren't cycles either
+	deep := dict{}
+	leaf := deep
+	for i := 0; i < startDetectingCyclesAfter*2; i++ {
+		next := dict{"tags": []interface{}{"a"}}
+		leaf["next"] = next
+		leaf = next
+	}
+	_, err = Normalize(deep)
+	require.NoError(t, err)
+}
+
+func TestContains_cycles(t *testing.T) {
+	m := dict{"color": "red"}
+	m["self"] = m
+	s := []interface{}{"a", nil}
+	s[1] = s
+
+	tests := []struct {
+		name     string
+		v1, v2   interface{}
+		opts     []ContainsOption
+		expected Path
+	}{
+		{name: "map", v1: m, v2: m, expected: Path{"self"}},
+		// unordered slice matching doesn't record indexes in the path
+		{name: "slice", v1: s, v2: s},
+		{name: "ordered slice", v1: s, v2: s, opts: []ContainsOption{OrderedSlices()}, expected: Path{1}},
+		{name: "nested", v1: dict{"a": m}, v2: dict{"a": m}, expected: Path{"a", "self"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, fn := range map[string]func(v1, v2 interface{}, opts ...ContainsOption) Match{
+				"contains":   ContainsMatch,
+				"equivalent": EquivalentMatch,
+			} {
+				match := fn(tt.v1, tt.v2, tt.opts...)
+				assert.False(t, match.Matches, name)
+				assert.True(t, merry.Is(match.Error, CycleDetectedError), "%s: got %v", name, match.Error)
+				if tt.expected != nil {
+					assert.Equal(t, tt.expected, NormalizeErrorPath(match.Error), name)
+				}
+			}
+			assert.False(t, Contains(tt.v1, tt.v2, tt.opts...))
+			assert.False(t, Equivalent(tt.v1, tt.v2, tt.opts...))
+		})
+	}
+
+	// a cyclic value can still be compared to one which isn't, and explained
+	match := ContainsMatch(m, []interface{}{"red"})
+	assert.False(t, match.Matches)
+	assert.NoError(t, match.Error)
+	assert.Contains(t, match.Message, "v1 -> map[string]interface {}{<cycle>}")
+	assert.True(t, Contains(m, dict{"color": "red", "self": dict{"color": "red"}}))
+	assert.False(t, Equivalent(m, dict{"color": "red"}))
+}
+
+func TestNumbersAsJSONNumber(t *testing.T) {
+	const id = int64(1234567890123456789)
+
+	// without the option, the id is corrupted
+	n, err := Normalize(id)
+	require.NoError(t, err)
+	assert.NotEqual(t, "1234567890123456789", strconv.FormatFloat(n.(float64), 'f', -1, 64))
+
+	type resource struct {
+		ID    int64   `json:"id"`
+		Score float32 `json:"score"`
+	}
+	tests := []struct {
+		name     string
+		v        interface{}
+		expected interface{}
+	}{
+		{name: "int64", v: id, expected: json.Number("1234567890123456789")},
+		{name: "uint64", v: uint64(math.MaxUint64), expected: json.Number("18446744073709551615")},
+		{name: "negative", v: -5, expected: json.Number("-5")},
+		{name: "float", v: 0.1, expected: json.Number("0.1")},
+		{name: "float32", v: float32(0.1), expected: json.Number("0.1")},
+		{name: "large float", v: 1e21, expected: json.Number("1e+21")},
+		{name: "nan", v: math.Inf(1), expected: math.Inf(1)},
+		{name: "json number", v: json.Number("12.50"), expected: json.Number("12.50")},
+		{name: "nested", v: dict{"ids": []int64{id}}, expected: dict{"ids": []interface{}{json.Number("1234567890123456789")}}},
+		{name: "marshaled", v: resource{ID: id, Score: 0.5}, expected: dict{"id": json.Number("1234567890123456789"), "score": json.Number("0.5")}},
+		{name: "raw json", v: json.RawMessage(`{"id":1234567890123456789}`), expected: dict{"id": json.Number("1234567890123456789")}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := Normalize(test.v, NumbersAsJSONNumber(true))
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, n)
+		})
+	}
+
+	// the id survives a round trip, and is compared exactly
+	n, err = Normalize(json.RawMessage(`{"id":1234567890123456789,"size":2}`), NumbersAsJSONNumber(true))
+	require.NoError(t, err)
+	assert.True(t, Contains(n, dict{"id": id}))
+	assert.True(t, Contains(n, dict{"id": json.Number("1234567890123456789")}))
+	assert.False(t, Contains(n, dict{"id": id - 1}))
+	assert.True(t, Contains(n, dict{"size": 2.0}))
+	assert.True(t, Equivalent(n, dict{"id": uint64(id), "size": 2}))
+	assert.False(t, Contains(n, dict{"id": "1234567890123456789"}))
+
+	// without the option, the ids would be indistinguishable
+	f, err := Normalize(dict{"id": id})
+	require.NoError(t, err)
+	assert.True(t, Contains(f, dict{"id": float64(id - 1)}))
+}
+
+func TestPreserveInts(t *testing.T) {
+	type resource struct {
+		Size int `json:"size"`
+	}
+	v := dict{
+		"int":     5,
+		"int64":   int64(1234567890123456789),
+		"uint8":   uint8(3),
+		"float32": float32(0.5),
+		"slice":   []int{1, 2},
+		"struct":  resource{Size: 2},
+	}
+	n, err := Normalize(v, PreserveInts(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{
+		"int":     5,
+		"int64":   int64(1234567890123456789),
+		"uint8":   uint8(3),
+		"float32": 0.5,
+		"slice":   []interface{}{1, 2},
+		"struct":  dict{"size": 2.0},
+	}, n)
+
+	// the default is unchanged
+	n, err = Normalize(v)
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, n.(dict)["int"])
+
+	n, err = Normalize(5, PreserveInts(true), NumbersAsJSONNumber(true))
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("5"), n)
+
+	// ints and floats with the same value match
+	n, err = Normalize(v, PreserveInts(true))
+	require.NoError(t, err)
+	assert.True(t, Contains(n, dict{"int": 5.0, "slice": []interface{}{2.0}}))
+	assert.True(t, Contains(n.(dict)["int"], 5.0))
+	assert.True(t, Contains(5.0, n.(dict)["int"]))
+	assert.False(t, Contains(n, dict{"int": 5.5}))
+	assert.True(t, Equivalent(dict{"sizes": []interface{}{1, 2.0}}, dict{"sizes": []interface{}{2, 1.0}}))
+}
+
+func TestMaxDepth(t *testing.T) {
+	nested := func(depth int) interface{} {
+		var v interface{} = "leaf"
+		for i := 0; i < depth; i++ {
+			if i%2 == 0 {
+				v = dict{"a": v}
+			} else {
+				v = []interface{}{v}
+			}
+		}
+		return v
+	}
+
+	for _, depth := range []int{0, 1, 4, 5} {
+		_, err := Normalize(nested(depth), MaxDepth(5))
+		assert.NoError(t, err, "depth %v", depth)
+	}
+
+	_, err := Normalize(nested(6), MaxDepth(5))
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, MaxDepthExceededError))
+	assert.EqualError(t, err, "error normalizing at [0].a[0].a[0]: exceeded max depth of 5")
+
+	_, err = Normalize(nested(1000))
+	assert.NoError(t, err, "no limit by default")
+
+	// values which are marshaled are checked too
+	b, err := json.Marshal(nested(6))
+	require.NoError(t, err)
+	_, err = Normalize(json.RawMessage(b), MaxDepth(5))
+	assert.True(t, merry.Is(err, MaxDepthExceededError))
+	_, err = Normalize(json.RawMessage(b), MaxDepth(6))
+	assert.NoError(t, err)
+
+	// the limit only applies to deep normalization
+	_, err = Normalize(nested(6), MaxDepth(5), Deep(false))
+	assert.NoError(t, err)
+
+	// options can be reused
+	opts := NormalizeOptions{Deep: true, MaxDepth: 5}
+	_, err = NormalizeWithOptions(nested(6), opts)
+	assert.Error(t, err)
+	_, err = NormalizeWithOptions(nested(5), opts)
+	assert.NoError(t, err)
+}
+
+func TestLowercaseKeys(t *testing.T) {
+	type resource struct {
+		Name string `json:"Name"`
+	}
+	v := dict{
+		"Resource": dict{
+			"CreatedAt": "today",
+			"Tags":      []interface{}{dict{"Color": "red"}},
+			"Labels":    map[string]string{"App": "web"},
+		},
+		"Owner": resource{Name: "bob"},
+		"lower": 1,
+	}
+	n, err := Normalize(v, LowercaseKeys(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{
+		"resource": dict{
+			"createdat": "today",
+			"tags":      []interface{}{dict{"color": "red"}},
+			"labels":    dict{"app": "web"},
+		},
+		"owner": dict{"name": "bob"},
+		"lower": 1.0,
+	}, n)
+
+	// v is not modified
+	assert.Contains(t, v, "Resource")
+	assert.Contains(t, v["Resource"], "CreatedAt")
+
+	// comparisons are insensitive to the case of keys, once both sides are normalized
+	n2, err := Normalize(dict{"RESOURCE": dict{"createdAt": "today"}}, LowercaseKeys(true))
+	require.NoError(t, err)
+	assert.True(t, Contains(n, n2))
+	got, err := Get(n, "resource.createdat")
+	require.NoError(t, err)
+	assert.Equal(t, "today", got)
+
+	// without Deep, only the top level is converted
+	n, err = Normalize(dict{"A": dict{"B": 1}}, LowercaseKeys(true), Deep(false))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"a": dict{"B": 1}}, n)
+
+	_, err = Normalize(dict{"a": dict{"ID": 1, "id": 2}}, LowercaseKeys(true))
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, KeyCollisionError))
+	assert.EqualError(t, err, `error normalizing at a: keys "ID" and "id" both lowercase to "id"`)
+}
+
+func TestDeepCopy(t *testing.T) {
+	type point struct{ X, Y int }
+	now := time.Now()
+	orig := dict{
+		"name":   "bob",
+		"count":  int64(5),
+		"ratio":  float32(0.5),
+		"when":   now,
+		"point":  point{1, 2},
+		"tags":   []interface{}{"a", dict{"b": []interface{}{1, 2}}},
+		"labels": map[string]string{"env": "prod"},
+		"ids":    []int{1, 2},
+		"grid":   [][]int{{1, 2}, {3, 4}},
+		"empty":  nil,
+	}
+
+	c, err := DeepCopy(orig)
+	require.NoError(t, err)
+	assert.Equal(t, orig, c, "types are preserved")
+
+	m := c.(dict)
+	m["name"] = "alice"
+	m["tags"].([]interface{})[0] = "z"
+	m["tags"].([]interface{})[1].(dict)["b"].([]interface{})[0] = 9
+	m["labels"].(map[string]string)["env"] = "dev"
+	m["ids"].([]int)[0] = 9
+	m["grid"].([][]int)[1][0] = 9
+
+	assert.Equal(t, "bob", orig["name"])
+	assert.Equal(t, []interface{}{"a", dict{"b": []interface{}{1, 2}}}, orig["tags"])
+	assert.Equal(t, map[string]string{"env": "prod"}, orig["labels"])
+	assert.Equal(t, []int{1, 2}, orig["ids"])
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}}, orig["grid"])
+
+	// primitives and nils
+	c, err = DeepCopy(5)
+	require.NoError(t, err)
+	assert.Equal(t, 5, c)
+	c, err = DeepCopy(nil)
+	require.NoError(t, err)
+	assert.Nil(t, c)
+	c, err = DeepCopy([]interface{}(nil))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}(nil), c)
+
+	// cycles
+	cyclic := dict{"color": "red"}
+	cyclic["self"] = cyclic
+	s := []interface{}{"a", nil}
+	s[1] = s
+	type typedMap map[string]interface{}
+	tm := typedMap{}
+	tm["self"] = tm
+	for _, v := range []interface{}{cyclic, s, tm, dict{"items": []interface{}{cyclic}}} {
+		_, err = DeepCopy(v)
+		assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+	}
+
+	// deeply nested values aren't cycles
+	deep := dict{}
+	leaf := deep
+	for i := 0; i < startDetectingCyclesAfter*2; i++ {
+		next := dict{"tags": []interface{}{"a"}}
+		leaf["next"] = next
+		leaf = next
+	}
+	c, err = DeepCopy(deep)
+	require.NoError(t, err)
+	assert.Equal(t, deep, c)
+}
+
+func TestNormalizeReader(t *testing.T) {
+	v, err := NormalizeReader(strings.NewReader(`{"color":"red","tags":["a"],"size":1}`))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"color": "red", "tags": []interface{}{"a"}, "size": 1.0}, v)
+
+	// trailing whitespace is ok
+	v, err = NormalizeReader(strings.NewReader("  [1, 2]\n\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{1.0, 2.0}, v)
+
+	// empty streams
+	v, err = NormalizeReader(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Nil(t, v)
+	v, err = NormalizeReader(strings.NewReader(" \n"))
+	require.NoError(t, err)
+	assert.Nil(t, v)
+
+	// options
+	v, err = NormalizeReader(strings.NewReader(`{"id":1234567890123456789}`), NumbersAsJSONNumber(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"id": json.Number("1234567890123456789")}, v)
+	v, err = NormalizeReader(strings.NewReader(`{"Color":"red"}`), LowercaseKeys(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"color": "red"}, v)
+	v, err = NormalizeReader(strings.NewReader(`{"created":"2020-01-02T03:04:05Z"}`), NormalizeTime(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"created": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}, v)
+
+	// errors
+	_, err = NormalizeReader(strings.NewReader(`{"color":"red"} {"color":"blue"}`))
+	assert.EqualError(t, err, "unexpected data after JSON value")
+	_, err = NormalizeReader(strings.NewReader(`{"color":"red"}x`))
+	assert.Error(t, err)
+	_, err = NormalizeReader(strings.NewReader(`{"color":`))
+	assert.ErrorContains(t, err, "error decoding JSON")
+}
+
+func TestAsNormalized(t *testing.T) {
+	w := Widget{Size: 1, Color: "red"}
+	n, err := AsNormalized(dict{"widget": w, "tags": []string{"red", "green"}})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"widget": dict{"size": float64(1), "color": "red"}, "tags": []interface{}{"red", "green"}}, n.Value())
+
+	// wrapping again is a no-op
+	n2, err := AsNormalized(n)
+	require.NoError(t, err)
+	assert.Equal(t, n, n2)
+
+	assert.True(t, Contains(n, dict{"widget": dict{"color": "red"}}))
+	assert.True(t, Equivalent(n, dict{"widget": w, "tags": []string{"green", "red"}}))
+	assert.True(t, Contains(dict{"widget": w}, dict{"widget": n.Value().(dict)["widget"]}))
+
+	v, err := Get(n, "tags[1]")
+	require.NoError(t, err)
+	assert.Equal(t, "green", v)
+
+	v, err = Get(n, "")
+	require.NoError(t, err)
+	assert.Equal(t, n.Value(), v)
+
+	// Normalize unwraps without re-normalizing
+	v, err = Normalize(n, Copy(false))
+	require.NoError(t, err)
+	assert.Equal(t, n.Value(), v)
+
+	// Merge still copies, so n isn't modified
+	m := Merge(n, dict{"color": "blue", "tags": []string{"blue"}})
+	assert.Equal(t, dict{"widget": dict{"size": float64(1), "color": "red"}, "color": "blue", "tags": []interface{}{"red", "green", "blue"}}, m)
+	assert.Equal(t, dict{"widget": dict{"size": float64(1), "color": "red"}, "tags": []interface{}{"red", "green"}}, n.Value())
+
+	// values are normalized with the options passed to AsNormalized
+	tm := time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC)
+	n, err = AsNormalized(dict{"createdAt": tm}, NormalizeTime(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"createdAt": tm}, n.Value())
+	assert.True(t, Contains(n, dict{"createdAt": tm}, ParseTimes()))
+
+	_, err = AsNormalized(dict{"color": make(chan string)})
+	assert.Error(t, err)
+}
+
+func TestGetTime(t *testing.T) {
+	tm := time.Date(2020, 3, 4, 10, 30, 0, 5, time.UTC)
+	type doc struct {
+		Created time.Time `json:"created"`
+	}
+	v := dict{
+		"created": tm,
+		"updated": tm.Format(time.RFC3339Nano),
+		"nested":  doc{Created: tm},
+		"name":    "bob",
+		"count":   5,
+	}
+
+	for _, path := range []string{"created", "updated", "nested.created"} {
+		t.Run(path, func(t *testing.T) {
+			got, err := GetTime(v, path)
+			require.NoError(t, err)
+			assert.True(t, tm.Equal(got), "expected %v, got %v", tm, got)
+		})
+	}
+
+	// the JSON round trip is the same as the original
+	var decoded interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"created":"2020-03-04T10:30:00.000000005Z"}`), &decoded))
+	got, err := GetTime(decoded, "created")
+	require.NoError(t, err)
+	assert.True(t, tm.Equal(got))
+
+	_, err = GetTime(v, "name")
+	assert.True(t, merry.Is(err, PathNotTimeError), "got %v", err)
+	assert.EqualError(t, err, "name is not a time")
+
+	_, err = GetTime(v, "count")
+	assert.True(t, merry.Is(err, PathNotTimeError), "got %v", err)
+
+	_, err = GetTime(v, "missing")
+	assert.True(t, merry.Is(err, PathNotFoundError), "got %v", err)
+}
+
+func TestHas(t *testing.T) {
+	v := dict{
+		"name":  "bob",
+		"color": nil,
+		"tags":  []interface{}{"a", "b"},
+		"things": []interface{}{
+			dict{"color": "red", "parts": []interface{}{dict{"id": 1}}},
+		},
+		"meta": dict{"id": 5},
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{"name", true},
+		{"color", true},
+		{"tags", true},
+		{"tags[1]", true},
+		{"tags[2]", false},
+		{"things[0].color", true},
+		{"things[0].parts[0].id", true},
+		{"things[0].parts[1].id", false},
+		{"things[0].parts[0].name", false},
+		{"meta.id", true},
+		{"meta.id.first", false},
+		{"missing", false},
+		{"missing.id", false},
+		{"name.first", false},
+		{"name[0]", false},
+		{"meta[0]", false},
+		{"", true},
+		{"[", false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			assert.Equal(t, test.expected, Has(v, test.path))
+		})
+	}
+
+	assert.False(t, Has(nil, ""))
+	assert.False(t, Has(nil, "name"))
+	assert.True(t, Has(5, ""))
+	assert.False(t, Has(5, "name"))
+	assert.True(t, Has([]interface{}{nil}, "[0]"))
+	assert.False(t, Has(dict{"a": make(chan int)}, "a.b"))
+}
+
+func TestGetOr(t *testing.T) {
+	v := dict{
+		"name":  "bob",
+		"color": nil,
+		"tags":  []interface{}{"a", "b"},
+		"meta":  dict{"id": 5},
+	}
+
+	// hits
+	assert.Equal(t, "bob", GetOr(v, "name", "alice"))
+	assert.Equal(t, "b", GetOr(v, "tags[1]", "z"))
+	assert.Equal(t, 5, GetOr(v, "meta.id", 0))
+	assert.Nil(t, GetOr(v, "color", "red"), "explicit nil isn't a miss")
+
+	// misses
+	assert.Equal(t, "red", GetOr(v, "size", "red"))
+	assert.Equal(t, "z", GetOr(v, "tags[5]", "z"))
+	assert.Equal(t, "z", GetOr(v, "name[0]", "z"))
+	assert.Equal(t, 0, GetOr(v, "name.first", 0))
+	assert.Nil(t, GetOr(v, "missing", nil))
+
+	// invalid paths and normalization errors
+	assert.Equal(t, "z", GetOr(v, "[", "z"))
+	assert.Equal(t, "z", GetOr(dict{"events": make(chan int)}, "events.id", "z"))
+}
+
+func TestGetTyped(t *testing.T) {
+	type color string
+	v := dict{
+		"name":    "bob",
+		"color":   color("red"),
+		"age":     30,
+		"height":  1.5,
+		"count":   uint8(3),
+		"whole":   4.0,
+		"big":     1e300,
+		"active":  true,
+		"tags":    []interface{}{"a"},
+		"created": time.Date(2020, 3, 4, 10, 30, 0, 0, time.UTC),
+	}
+
+	t.Run("string", func(t *testing.T) {
+		s, err := GetString(v, "name")
+		require.NoError(t, err)
+		assert.Equal(t, "bob", s)
+
+		s, err = GetString(v, "color")
+		require.NoError(t, err)
+		assert.Equal(t, "red", s)
+
+		s, err = GetString(v, "created")
+		require.NoError(t, err)
+		assert.Equal(t, "2020-03-04T10:30:00Z", s)
+
+		_, err = GetString(v, "age")
+		assert.True(t, merry.Is(err, PathNotStringError), "got %v", err)
+		assert.EqualError(t, err, "age is not a string (value type: float64)")
+
+		_, err = GetString(v, "missing")
+		assert.True(t, merry.Is(err, PathNotFoundError), "got %v", err)
+	})
+
+	t.Run("int", func(t *testing.T) {
+		for path, expected := range map[string]int{"age": 30, "count": 3, "whole": 4} {
+			i, err := GetInt(v, path)
+			require.NoError(t, err, path)
+			assert.Equal(t, expected, i, path)
+		}
+
+		_, err := GetInt(v, "height")
+		assert.True(t, merry.Is(err, PathNotNumberError), "got %v", err)
+		assert.EqualError(t, err, "height is not an int (value: 1.5)")
+
+		_, err = GetInt(v, "big")
+		assert.True(t, merry.Is(err, PathNotNumberError), "got %v", err)
+
+		_, err = GetInt(v, "name")
+		assert.True(t, merry.Is(err, PathNotNumberError), "got %v", err)
+		assert.EqualError(t, err, "name is not a number (value type: string)")
+	})
+
+	t.Run("float", func(t *testing.T) {
+		for path, expected := range map[string]float64{"age": 30, "height": 1.5, "count": 3} {
+			f, err := GetFloat(v, path)
+			require.NoError(t, err, path)
+			assert.Equal(t, expected, f, path)
+		}
+
+		_, err := GetFloat(v, "tags")
+		assert.True(t, merry.Is(err, PathNotNumberError), "got %v", err)
+		assert.EqualError(t, err, "tags is not a number (value type: []interface {})")
+	})
+
+	t.Run("bool", func(t *testing.T) {
+		b, err := GetBool(v, "active")
+		require.NoError(t, err)
+		assert.True(t, b)
+
+		_, err = GetBool(v, "name")
+		assert.True(t, merry.Is(err, PathNotBoolError), "got %v", err)
+		assert.EqualError(t, err, "name is not a bool (value type: string)")
+	})
+}
+
+func TestGetAll(t *testing.T) {
+	v := dict{
+		"resource": dict{
+			"tags": []interface{}{
+				dict{"color": "red"},
+				dict{"size": 1},
+				dict{"color": "blue"},
+			},
+		},
+		"items": []interface{}{
+			dict{"prices": []interface{}{1, 2}},
+			dict{"prices": []interface{}{}},
+			dict{"prices": []interface{}{3}},
+			"notamap",
+		},
+		"regions": dict{
+			"west":  dict{"name": "w", "zones": []interface{}{"a", "b"}},
+			"east":  dict{"name": "e", "zones": []interface{}{"c"}},
+			"empty": dict{},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected []interface{}
 	}{
-		// basic no-op types of cases
-		{in: 5, out: float64(5)},
-		{in: "red", out: "red"},
-		{},
-		{in: float64(10), out: float64(10)},
-		{in: float32(12), out: float64(12)},
-		{in: true, out: true},
-		{in: dict{"red": "green"}, out: dict{"red": "green"}},
-		{in: []interface{}{"red", 4}, out: []interface{}{"red", float64(4)}},
-		{in: []string{"red", "green"}, out: []interface{}{"red", "green"}},
-		// hits the marshaling currentPath
-		{in: &Widget{Size: 5, Color: "red"}, out: dict{"size": float64(5), "color": "red"}},
-		// marshaling might occur deep
-		{in: dict{"widget": &Widget{Size: 5, Color: "red"}}, out: dict{"widget": dict{"size": float64(5), "color": "red"}}},
+		{"resource.tags[*].color", []interface{}{"red", "blue"}},
+		{"resource.tags.*.color", []interface{}{"red", "blue"}},
+		{"resource.tags[].color", []interface{}{"red", "blue"}},
+		{"items[*].prices[0]", []interface{}{1, 3}},
+		{"items[*].prices[*]", []interface{}{1, 2, 3}},
+		{"regions.*.name", []interface{}{"e", "w"}},
+		{"regions[*].name", []interface{}{"e", "w"}},
+		{"regions[].name", []interface{}{}},
+		{"regions.*.zones[*]", []interface{}{"c", "a", "b"}},
+		{"regions.west.zones[1]", []interface{}{"b"}},
+		{"regions.west.zones[2]", []interface{}{}},
+		{"regions.*.zones[-1]", []interface{}{"c", "b"}},
+		{"regions.*.zones[-2]", []interface{}{"a"}},
+		{"missing.*", []interface{}{}},
+		{"*.*.name", []interface{}{"e", "w"}},
+		{"resource.tags[1].*", []interface{}{1}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			out, err := GetAll(v, test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	_, err := GetAll(dict{"a": []interface{}{make(chan int)}}, "a[*].b")
+	assert.Error(t, err)
+
+	_, err = GetAll(dict{"a": []interface{}{make(chan int)}}, "..b")
+	assert.Error(t, err)
+
+	_, err = Get(v, "resource.tags[*].color")
+	assert.EqualError(t, err, "resource.tags.*: Get doesn't support wildcards; use GetAll")
+}
+
+func TestGetAll_recursiveDescent(t *testing.T) {
+	v := dict{
+		"color": "red",
+		"resource": dict{
+			"color": "blue",
+			"tags": []interface{}{
+				dict{"color": "green", "id": 1},
+				dict{"parts": []interface{}{dict{"color": "black"}, dict{"id": 2}}},
+			},
+			"meta": dict{"owner": dict{"color": "white", "id": 3}},
+		},
+	}
+
+	tests := []struct {
+		path     string
+		expected []interface{}
+	}{
+		{"..color", []interface{}{"red", "blue", "white", "green", "black"}},
+		{"resource..color", []interface{}{"blue", "white", "green", "black"}},
+		{"resource.tags..color", []interface{}{"green", "black"}},
+		{"..id", []interface{}{3, 1, 2}},
+		{"..parts[1].id", []interface{}{2}},
+		{"..owner.*", []interface{}{"white", 3}},
+		{"..missing", []interface{}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			out, err := GetAll(v, test.path)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	_, err := Get(v, "..color")
+	assert.Error(t, err)
+
+	// DeleteAll supports it too
+	out, err := DeleteAll(v, "..color")
+	require.NoError(t, err)
+	all, err := GetAll(out, "..color")
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		v, out interface{}
+		path   string
+	}{
+		{5, 5, ""},
+		{[]string{"red"}, "red", "[0]"},
+		{dict{"color": "red"}, "red", "color"},
+		{dict{"tags": []string{"red", "green"}}, "green", "tags[1]"},
+		{dict{"tags": []string{"red", "green"}}, "red", "tags[0]"},
+		{dict{"tags": []string{"red", "green"}}, "green", "tags[-1]"},
+		{dict{"my.key": dict{"weird[name]": "red"}}, "red", `my\.key.weird[name]`},
+		{dict{"my.key": dict{"weird[name]": "red"}}, "red", `["my.key"]["weird[name]"]`},
+		{dict{"a[1]": "red"}, "red", `a\[1]`},
+		{dict{"tags": []string{"red", "green"}}, "red", "tags[-2]"},
+		{[]interface{}{dict{"tags": []string{"a", "b"}}, dict{"tags": []string{"c"}}}, "c", "[-1].tags[-1]"},
+		{dict{"resource": dict{"tags": []string{"red", "green"}}}, "red", "resource.tags[0]"},
+		{dict{"resource": dict{"tags": []string{"red", "green"}}}, []string{"red", "green"}, "resource.tags"},
+		{dict{"resource": dict{"tags": []string{"red", "green"}}}, dict{"tags": []string{"red", "green"}}, "resource"},
+		{dict{"tags": []string{"red", "green"}}, []interface{}{"red", "green"}, "tags[]"},
+		{dict{"items": []dict{{"name": "a"}, {"name": "b"}}}, []interface{}{"a", "b"}, "items[].name"},
+		{dict{"items": []interface{}{dict{"name": "a"}, dict{"size": 1}, "c", dict{"name": "d"}}}, []interface{}{"a", "d"}, "items[].name"},
+		{dict{"items": []interface{}{}}, []interface{}{}, "items[].name"},
+		{[]interface{}{dict{"tags": []string{"a", "b"}}, dict{"tags": []string{"c"}}}, []interface{}{"b"}, "[].tags[1]"},
 		{
-			name: "marshaller",
-			in:   json.RawMessage(`{"color":"blue"}`),
-			out:  dict{"color": "blue"},
-			opts: []NormalizeOption{Marshal(true)},
+			dict{"items": []interface{}{dict{"parts": []interface{}{dict{"id": 1}, dict{"id": 2}}}, dict{"parts": []interface{}{dict{"id": 3}}}}},
+			[]interface{}{[]interface{}{1, 2}, []interface{}{3}},
+			"items[].parts[].id",
 		},
-		{in: t1, out: "1990-11-23T02:02:02.000000002-03:00"},
-		{in: t1.UTC(), out: "1990-11-23T05:02:02.000000002Z"},
-		{in: t1, out: t1, opts: []NormalizeOption{NormalizeTime(true)}},
-		{in: &specialTime{t: t1.UTC()}, out: t1.UTC(), opts: []NormalizeOption{NormalizeTime(true)}},
 	}
 	for _, test := range tests {
-		t.Run(test.name, func(t *testing.T) {
-			var out interface{}
-			var err error
-			out, err = Normalize(test.in, test.opts...)
-
+		result, err := Get(test.v, test.path)
+		require.NoError(t, err, "v = %#v, currentPath = %v", test.v, test.path)
+		require.Equal(t, test.out, result, "v = %#v, currentPath = %v", test.v, test.path)
+	}
+
+	// errors
+	errorTests := []struct {
+		v         interface{}
+		path, msg string
+		kind      error
+	}{
+		{dict{"tags": []string{"red", "green"}}, "tags[2]", "Index out of bounds at tags[2] (len = 2)", IndexOutOfBoundsError},
+		{[]string{"red", "green"}, "[2]", "Index out of bounds at [2] (len = 2)", IndexOutOfBoundsError},
+		{dict{"tags": []string{"red", "green"}}, "tags[-3]", "Index out of bounds at tags[-3] (len = 2)", IndexOutOfBoundsError},
+		{dict{"tags": []string{}}, "tags[-1]", "Index out of bounds at tags[-1] (len = 0)", IndexOutOfBoundsError},
+		{dict{"tags": "red"}, "tags[2]", "tags is not a slice", PathNotSliceError},
+		{dict{"tags": "red"}, "[2]", "v is not a slice", PathNotSliceError},
+		{[]string{"red", "green"}, "tags[2]", "v is not a map", PathNotMapError},
+		{dict{"tags": "red"}, "color", "color not found", PathNotFoundError},
+		{dict{"tags": "red"}, "tags[].color", "tags is not a slice", PathNotSliceError},
+		{dict{"tags": "red"}, "[]", "v is not a slice", PathNotSliceError},
+	}
+	for _, test := range errorTests {
+		_, err := Get(test.v, test.path)
+		assert.EqualError(t, err, test.msg, "v = %#v, currentPath = %v", test.v, test.path)
+		assert.True(t, merry.Is(err, test.kind), "Wrong type of error.  Expected %v, was %v", test.kind, err)
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	v := dict{"resource": dict{"tags": []string{"red", "green"}}, "my.key": 1}
+
+	p, err := Compile("resource.tags[1]")
+	require.NoError(t, err)
+	out, err := GetPath(v, p)
+	require.NoError(t, err)
+	assert.Equal(t, "green", out)
+
+	// paths can be constructed directly
+	out, err = GetPath(v, Path{"my.key"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, out)
+
+	out, err = GetPath(v, nil)
+	require.NoError(t, err)
+	assert.Equal(t, v, out)
+
+	_, err = GetPath(v, Path{"resource", "color"})
+	assert.True(t, merry.Is(err, PathNotFoundError), "got %v", err)
+
+	// same options as Get
+	out, err = GetPath(v, Path{"Resource", "TAGS", 0}, CaseInsensitiveKeys())
+	require.NoError(t, err)
+	assert.Equal(t, "red", out)
+}
+
+func TestGet_caseInsensitiveKeys(t *testing.T) {
+	v := dict{"Resource": dict{"State": "active", "ID": 5}}
+
+	// exact case
+	out, err := Get(v, "Resource.State", CaseInsensitiveKeys())
+	require.NoError(t, err)
+	assert.Equal(t, "active", out)
+
+	// different case
+	out, err = Get(v, "resource.state", CaseInsensitiveKeys())
+	require.NoError(t, err)
+	assert.Equal(t, "active", out)
+	out, err = Get(v, "RESOURCE.id", CaseInsensitiveKeys())
+	require.NoError(t, err)
+	assert.Equal(t, 5, out)
+
+	// case-sensitive by default
+	_, err = Get(v, "resource.state")
+	assert.True(t, merry.Is(err, PathNotFoundError), "got %v", err)
+
+	_, err = Get(v, "resource.status", CaseInsensitiveKeys())
+	assert.EqualError(t, err, "resource.status not found")
+	assert.True(t, merry.Is(err, PathNotFoundError), "got %v", err)
+
+	// ambiguous
+	v = dict{"tags": dict{"Color": "red", "COLOR": "blue", "color": "green"}}
+	_, err = Get(v, "tags.cOLOR", CaseInsensitiveKeys())
+	assert.True(t, merry.Is(err, AmbiguousKeyError), "got %v", err)
+	assert.Contains(t, err.Error(), "tags.cOLOR is ambiguous: matches keys")
+
+	// an exact match isn't ambiguous
+	out, err = Get(v, "tags.color", CaseInsensitiveKeys())
+	require.NoError(t, err)
+	assert.Equal(t, "green", out)
+
+	// combined with other options
+	out, err = Get(struct{ Name string }{"bob"}, "name", CaseInsensitiveKeys(), Copy(true))
+	require.NoError(t, err)
+	assert.Equal(t, "bob", out)
+}
+
+func TestPathsEqual(t *testing.T) {
+	v := dict{
+		"resource": dict{
+			"account": "acme",
+			"tags":    []string{"red", "green"},
+			"size":    5,
+		},
+		"environment": dict{
+			"account": "acme",
+			"tags":    []interface{}{"green", "red"},
+			"size":    "5",
+			"region":  "east",
+			"owner":   "acme corp",
+		},
+	}
+
+	tests := []struct {
+		pathA, pathB string
+		expected     bool
+		opts         []ContainsOption
+	}{
+		{pathA: "resource.account", pathB: "environment.account", expected: true},
+		{pathA: "resource.tags", pathB: "environment.tags", expected: true},
+		{pathA: "resource.tags[0]", pathB: "environment.tags[1]", expected: true},
+		{pathA: "resource.tags[0]", pathB: "environment.tags[0]"},
+		{pathA: "resource.size", pathB: "environment.size"},
+		{pathA: "resource.account", pathB: "environment.region"},
+		{pathA: "environment.owner", pathB: "resource.account"},
+		{pathA: "environment.owner", pathB: "resource.account", expected: true, opts: []ContainsOption{StringContains()}},
+	}
+	for _, test := range tests {
+		b, err := PathsEqual(v, test.pathA, test.pathB, test.opts...)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, b, "%s == %s", test.pathA, test.pathB)
+	}
+
+	_, err := PathsEqual(v, "resource.region", "environment.region")
+	assert.EqualError(t, err, "error getting resource.region: resource.region not found")
+	assert.True(t, merry.Is(err, PathNotFoundError))
+
+	_, err = PathsEqual(v, "resource.account", "environment.tags[2]")
+	assert.EqualError(t, err, "error getting environment.tags[2]: Index out of bounds at environment.tags[2] (len = 2)")
+	assert.True(t, merry.Is(err, IndexOutOfBoundsError))
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		v        interface{}
+		path     string
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, "name", "bob", dict{"name": "bob"}},
+		{nil, "user.name.first", "bob", dict{"user": dict{"name": dict{"first": "bob"}}}},
+		{nil, "", 5, 5.0},
+		{dict{"name": "bob"}, "name", "alice", dict{"name": "alice"}},
+		{dict{"name": "bob"}, "age", 5, dict{"name": "bob", "age": 5.0}},
+		{dict{"tags": []string{"a", "b"}}, "tags[0]", "c", dict{"tags": []interface{}{"c", "b"}}},
+		{dict{"tags": []string{"a", "b"}}, "tags[-1]", "c", dict{"tags": []interface{}{"a", "c"}}},
+		{dict{"things": []interface{}{dict{"color": "red"}}}, "things[0].size", 1, dict{"things": []interface{}{dict{"color": "red", "size": 1.0}}}},
+		{dict{"user": nil}, "user.name", "bob", dict{"user": dict{"name": "bob"}}},
+		{dict{}, "my\\.key", dict{"a": 1}, dict{"my.key": dict{"a": 1.0}}},
+		// append
+		{nil, "tags[]", "red", dict{"tags": []interface{}{"red"}}},
+		{nil, "[]", "red", []interface{}{"red"}},
+		{dict{"tags": []string{"red"}}, "tags[]", "green", dict{"tags": []interface{}{"red", "green"}}},
+		{dict{"items": []interface{}{dict{"name": "a"}}}, "items[].name", "b", dict{"items": []interface{}{dict{"name": "a"}, dict{"name": "b"}}}},
+		{nil, "matrix[][]", 1, dict{"matrix": []interface{}{[]interface{}{1.0}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			out, err := Set(test.v, test.path, test.value)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, out)
+		})
+	}
+
+	t.Run("append several", func(t *testing.T) {
+		var v interface{}
+		var err error
+		for _, color := range []string{"red", "green", "blue"} {
+			v, err = Set(v, "resource.tags[]", color)
+			require.NoError(t, err)
+		}
+		v, err = Set(v, "resource.tags[-1]", "purple")
+		require.NoError(t, err)
+		assert.Equal(t, dict{"resource": dict{"tags": []interface{}{"red", "green", "purple"}}}, v)
+		assert.Equal(t, "resource.tags[]", Path{"resource", "tags", EachElement{}}.String())
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		orig := dict{"tags": []interface{}{"red"}, "user": dict{"name": "bob"}}
+		_, err := Set(orig, "user.name", "alice")
+		require.NoError(t, err)
+		_, err = Set(orig, "tags[]", "green")
+		require.NoError(t, err)
+		assert.Equal(t, dict{"tags": []interface{}{"red"}, "user": dict{"name": "bob"}}, orig)
+	})
+
+	errorTests := []struct {
+		v         interface{}
+		path, msg string
+		kind      error
+	}{
+		{dict{"tags": "red"}, "tags[]", "tags is not a slice", PathNotSliceError},
+		{dict{"tags": dict{}}, "tags[]", "tags is not a slice", PathNotSliceError},
+		{dict{"tags": "red"}, "tags.color", "tags is not a map", PathNotMapError},
+		{"red", "color", "v is not a map", PathNotMapError},
+		{dict{}, "[]", "v is not a slice", PathNotSliceError},
+		{dict{"tags": []string{"red"}}, "tags[1]", "Index out of bounds at tags[1] (len = 1)", IndexOutOfBoundsError},
+		{nil, "tags[0]", "Index out of bounds at tags[0] (len = 0)", IndexOutOfBoundsError},
+	}
+	for _, test := range errorTests {
+		t.Run(test.path, func(t *testing.T) {
+			_, err := Set(test.v, test.path, "x")
+			assert.EqualError(t, err, test.msg)
+			assert.True(t, merry.Is(err, test.kind), "expected %v, got %v", test.kind, err)
+		})
+	}
+
+	_, err := Set(dict{}, "tags[*]", 1)
+	assert.Error(t, err)
+}
+
+func TestDelete(t *testing.T) {
+	newV := func() dict {
+		return dict{
+			"name": "bob",
+			"tags": []interface{}{"a", "b", "c"},
+			"things": []interface{}{
+				dict{"color": "red", "size": 1},
+				dict{"color": "blue"},
+			},
+			"meta": dict{"id": 5},
+		}
+	}
+	norm, err := Normalize(newV())
+	require.NoError(t, err)
+
+	tests := []struct {
+		path     string
+		parent   string // the path to check after deleting
+		expected interface{}
+		err      error
+	}{
+		{path: "name", parent: "name", err: PathNotFoundError},
+		{path: "tags[1]", parent: "tags", expected: []interface{}{"a", "c"}},
+		{path: "tags[0]", parent: "tags", expected: []interface{}{"b", "c"}},
+		{path: "tags[-1]", parent: "tags", expected: []interface{}{"a", "b"}},
+		{path: "tags[-3]", parent: "tags", expected: []interface{}{"b", "c"}},
+		{path: "things[-1].color", parent: "things[1]", expected: dict{}},
+		{path: "tags[2]", parent: "tags", expected: []interface{}{"a", "b"}},
+		{path: "things[0].size", parent: "things[0]", expected: dict{"color": "red"}},
+		{path: "things[0]", parent: "things", expected: []interface{}{dict{"color": "blue"}}},
+		{path: "meta.id", parent: "meta", expected: dict{}},
+		{path: "", expected: norm},
+		// missing keys are ignored
+		{path: "meta.missing", expected: norm},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			orig := newV()
+			v, err := Delete(orig, test.path)
+			require.NoError(t, err)
+			assert.Equal(t, newV(), orig, "original should not be modified")
+
+			got, err := Get(v, test.parent)
+			if test.err != nil {
+				assert.True(t, merry.Is(err, test.err), "expected %v, got %v", test.err, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, got)
+		})
+	}
+
+	errTests := []struct {
+		path string
+		err  error
+	}{
+		{path: "tags[3]", err: IndexOutOfBoundsError},
+		{path: "tags[-4]", err: IndexOutOfBoundsError},
+		{path: "missing.id", err: PathNotFoundError},
+		{path: "name.first", err: PathNotMapError},
+		{path: "meta[0]", err: PathNotSliceError},
+		{path: "things[0].color[1]", err: PathNotSliceError},
+	}
+	for _, test := range errTests {
+		t.Run(test.path, func(t *testing.T) {
+			_, err := Delete(newV(), test.path)
+			assert.True(t, merry.Is(err, test.err), "expected %v, got %v", test.err, err)
+		})
+	}
+
+	_, err = Delete(newV(), "things[].color")
+	assert.Error(t, err)
+}
+
+func TestDeleteAll(t *testing.T) {
+	in := dict{
+		"sha256Fingerprint": "top",
+		"resource": dict{
+			"sha256Fingerprint": "nested",
+			"certs": []interface{}{
+				dict{"name": "a", "sha256Fingerprint": "a1"},
+				dict{"name": "b", "sha256Fingerprint": "b1", "chain": dict{"sha256Fingerprint": "b2"}},
+			},
+		},
+		"tags": []string{"red", "green", "blue"},
+	}
+
+	tests := []struct {
+		path     string
+		expected dict
+	}{
+		{
+			path: "**.sha256Fingerprint",
+			expected: dict{
+				"resource": dict{
+					"certs": []interface{}{
+						dict{"name": "a"},
+						dict{"name": "b", "chain": dict{}},
+					},
+				},
+				"tags": []interface{}{"red", "green", "blue"},
+			},
+		},
+		{
+			path: "resource.certs.*.sha256Fingerprint",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource": dict{
+					"sha256Fingerprint": "nested",
+					"certs": []interface{}{
+						dict{"name": "a"},
+						dict{"name": "b", "chain": dict{"sha256Fingerprint": "b2"}},
+					},
+				},
+				"tags": []interface{}{"red", "green", "blue"},
+			},
+		},
+		{
+			path: "resource.*",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource":          dict{},
+				"tags":              []interface{}{"red", "green", "blue"},
+			},
+		},
+		{
+			path: "tags[1]",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource":          in["resource"],
+				"tags":              []interface{}{"red", "blue"},
+			},
+		},
+		{
+			path: "tags[-1]",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource":          in["resource"],
+				"tags":              []interface{}{"red", "green"},
+			},
+		},
+		{
+			path: "tags[-4]",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource":          in["resource"],
+				"tags":              []interface{}{"red", "green", "blue"},
+			},
+		},
+		{
+			path: "tags.*",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource":          in["resource"],
+				"tags":              []interface{}{},
+			},
+		},
+		{
+			path: "**.certs[0]",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource": dict{
+					"sha256Fingerprint": "nested",
+					"certs": []interface{}{
+						dict{"name": "b", "sha256Fingerprint": "b1", "chain": dict{"sha256Fingerprint": "b2"}},
+					},
+				},
+				"tags": []interface{}{"red", "green", "blue"},
+			},
+		},
+		{
+			path: "resource.certs[].sha256Fingerprint",
+			expected: dict{
+				"sha256Fingerprint": "top",
+				"resource": dict{
+					"sha256Fingerprint": "nested",
+					"certs": []interface{}{
+						dict{"name": "a"},
+						dict{"name": "b", "chain": dict{"sha256Fingerprint": "b2"}},
+					},
+				},
+				"tags": []interface{}{"red", "green", "blue"},
+			},
+		},
+		{path: "color", expected: in},
+		{path: "tags[5]", expected: in},
+		{path: "resource.certs.*.color.*", expected: in},
+		{path: "", expected: in},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			out, err := DeleteAll(in, test.path)
 			require.NoError(t, err)
-			require.Equal(t, test.out, out, "in: %v", pp.Sprint(test.in))
+			assert.True(t, Equivalent(test.expected, out), "expected: %v\nactual: %v", pp.Sprint(test.expected), pp.Sprint(out))
 		})
 	}
-}
 
-func TestGet(t *testing.T) {
-	tests := []struct {
-		v, out interface{}
-		path   string
-	}{
-		{5, 5, ""},
-		{[]string{"red"}, "red", "[0]"},
-		{dict{"color": "red"}, "red", "color"},
-		{dict{"tags": []string{"red", "green"}}, "green", "tags[1]"},
-		{dict{"tags": []string{"red", "green"}}, "red", "tags[0]"},
-		{dict{"resource": dict{"tags": []string{"red", "green"}}}, "red", "resource.tags[0]"},
-		{dict{"resource": dict{"tags": []string{"red", "green"}}}, []string{"red", "green"}, "resource.tags"},
-		{dict{"resource": dict{"tags": []string{"red", "green"}}}, dict{"tags": []string{"red", "green"}}, "resource"},
-	}
-	for _, test := range tests {
-		result, err := Get(test.v, test.path)
-		require.NoError(t, err, "v = %#v, currentPath = %v", test.v, test.path)
-		require.Equal(t, test.out, result, "v = %#v, currentPath = %v", test.v, test.path)
-	}
+	// input should not be modified
+	assert.Equal(t, "b2", in["resource"].(dict)["certs"].([]interface{})[1].(dict)["chain"].(dict)["sha256Fingerprint"])
+	assert.Equal(t, []string{"red", "green", "blue"}, in["tags"])
 
-	// errors
-	errorTests := []struct {
-		v         interface{}
-		path, msg string
-		kind      error
-	}{
-		{dict{"tags": []string{"red", "green"}}, "tags[2]", "Index out of bounds at tags[2] (len = 2)", IndexOutOfBoundsError},
-		{[]string{"red", "green"}, "[2]", "Index out of bounds at [2] (len = 2)", IndexOutOfBoundsError},
-		{dict{"tags": "red"}, "tags[2]", "tags is not a slice", PathNotSliceError},
-		{dict{"tags": "red"}, "[2]", "v is not a slice", PathNotSliceError},
-		{[]string{"red", "green"}, "tags[2]", "v is not a map", PathNotMapError},
-		{dict{"tags": "red"}, "color", "color not found", PathNotFoundError},
-	}
-	for _, test := range errorTests {
-		_, err := Get(test.v, test.path)
-		assert.EqualError(t, err, test.msg, "v = %#v, currentPath = %v", test.v, test.path)
-		assert.True(t, merry.Is(err, test.kind), "Wrong type of error.  Expected %v, was %v", test.kind, err)
+	_, err := DeleteAll(dict{"color": make(chan string)}, "color")
+	assert.Error(t, err)
+
+	// an escaped ** is a literal key, not a recursive descent
+	stars := dict{"**": 1, "color": "red", "nested": dict{"**": 2, "color": "blue"}}
+	for _, path := range []string{`\*\*`, Path{"**"}.String()} {
+		out, err := DeleteAll(stars, path)
+		require.NoError(t, err)
+		assert.Equal(t, dict{"color": "red", "nested": dict{"**": 2.0, "color": "blue"}}, out, path)
 	}
+	out, err := DeleteAll(stars, `nested.\*\*`)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"**": 1.0, "color": "red", "nested": dict{"color": "blue"}}, out)
+	out, err = DeleteAll(stars, "**.color")
+	require.NoError(t, err)
+	assert.Equal(t, dict{"**": 1.0, "nested": dict{"**": 2.0}}, out)
 }
 
 type holder struct {
 	i interface{}
 }
 
+func TestPrune(t *testing.T) {
+	v := dict{
+		"name":  "bob",
+		"blank": "  ",
+		"null":  nil,
+		"count": 0,
+		"flag":  false,
+		"size":  2,
+		"tags":  []interface{}{"red", "", nil, []interface{}{}, 0},
+		"meta": dict{
+			"labels": dict{"app": ""},
+			"notes":  []interface{}{dict{"text": nil}},
+		},
+		"nested": dict{"a": dict{"b": dict{"c": 1, "d": dict{}}}},
+	}
+	expected := dict{
+		"name":   "bob",
+		"size":   2.0,
+		"tags":   []interface{}{"red"},
+		"nested": dict{"a": dict{"b": dict{"c": 1.0}}},
+	}
+	assert.Equal(t, expected, Prune(v))
+
+	// v is not modified
+	assert.Len(t, v, 9)
+	assert.Len(t, v["tags"], 5)
+
+	// zeros are kept with KeepZeros
+	expected["count"] = 0.0
+	expected["flag"] = false
+	expected["tags"] = []interface{}{"red", 0.0}
+	assert.Equal(t, expected, Prune(v, KeepZeros()))
+
+	assert.Nil(t, Prune(dict{"a": dict{"b": []interface{}{nil}}}))
+	assert.Nil(t, Prune(0))
+	assert.Equal(t, 0.0, Prune(0, KeepZeros()))
+	assert.Nil(t, Prune(dict{"a": make(chan int)}))
+
+	// times are normalized to strings, unless NormalizeTime is used
+	var zero time.Time
+	assert.Equal(t, dict{"t": "0001-01-01T00:00:00Z"}, Prune(dict{"t": zero}))
+	assert.Nil(t, Prune(dict{"t": zero}, NormalizeTime(true)))
+	assert.Equal(t, dict{"t": zero}, Prune(dict{"t": zero}, NormalizeTime(true), KeepZeros()))
+}
+
 func TestEmpty(t *testing.T) {
 	var num int
 	var ptr *Widget
@@ -1017,6 +4268,107 @@ func TestEmpty(t *testing.T) {
 	}
 }
 
+type (
+	namedString string
+	namedInt    int
+	namedBool   bool
+	namedFloat  float64
+)
+
+func TestEmptyWithOptions(t *testing.T) {
+	type Inner struct {
+		Tags  []string
+		Attrs map[string]string
+	}
+	type Outer struct {
+		Name    string
+		Inner   Inner
+		Ptr     *Inner
+		Created time.Time
+		seen    int
+	}
+
+	tests := []struct {
+		name      string
+		v         interface{}
+		fieldwise bool
+	}{
+		{name: "zero", v: Outer{}, fieldwise: true},
+		{name: "empty slice", v: Outer{Inner: Inner{Tags: []string{}}}, fieldwise: true},
+		{name: "empty map", v: Outer{Inner: Inner{Attrs: map[string]string{}}}, fieldwise: true},
+		{name: "whitespace", v: Outer{Name: "  "}, fieldwise: true},
+		{name: "unexported field", v: Outer{seen: 5}, fieldwise: true},
+		{name: "non empty nested", v: Outer{Inner: Inner{Tags: []string{"red"}}}},
+		{name: "non empty field", v: Outer{Name: "bob"}},
+		{name: "non nil pointer", v: Outer{Ptr: &Inner{}}},
+		{name: "time", v: Outer{Created: time.Now()}},
+		{name: "unexported only", v: holder{i: Widget{Color: "red"}}, fieldwise: true},
+		{name: "zero duration", v: struct{ D time.Duration }{}, fieldwise: true},
+		{name: "duration", v: struct{ D time.Duration }{D: time.Second}},
+		{name: "zero named string", v: struct{ S namedString }{}, fieldwise: true},
+		{name: "named string", v: struct{ S namedString }{S: "red"}},
+		{name: "zero named int", v: struct{ N namedInt }{}, fieldwise: true},
+		{name: "named int", v: struct{ N namedInt }{N: 1}},
+		{name: "named bool", v: struct{ B namedBool }{B: true}},
+		{name: "zero named float", v: struct{ F namedFloat }{}, fieldwise: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.fieldwise, EmptyWithOptions(test.v, EmptyFieldwise()))
+		})
+	}
+
+	// without the option, structs must equal their zero value
+	assert.False(t, Empty(Outer{Inner: Inner{Tags: []string{}}}))
+	assert.False(t, EmptyWithOptions(Outer{seen: 5}))
+	assert.True(t, EmptyWithOptions(Outer{}))
+
+	// named scalars are compared to their zero values, like their underlying types
+	assert.True(t, Empty(time.Duration(0)))
+	assert.False(t, Empty(time.Second))
+	assert.True(t, Empty(namedString("")))
+	assert.True(t, Empty(namedString("  ")))
+	assert.False(t, Empty(namedString(" a ")))
+	assert.False(t, EmptyWithOptions(time.Duration(0), ZeroIsNotEmpty()))
+	assert.False(t, EmptyWithOptions(struct{ D time.Duration }{}, EmptyFieldwise(), ZeroIsNotEmpty()))
+
+	// options don't change the treatment of other values
+	assert.True(t, EmptyWithOptions(0, EmptyFieldwise()))
+	assert.False(t, EmptyWithOptions("red", EmptyFieldwise()))
+	assert.False(t, EmptyWithOptions(&Outer{}, EmptyFieldwise()))
+}
+
+func TestZeroIsNotEmpty(t *testing.T) {
+	zeros := []interface{}{
+		0, int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), 0.0, complex64(0), complex128(0),
+		false, time.Time{},
+	}
+	for _, v := range zeros {
+		t.Run(fmt.Sprintf("%T", v), func(t *testing.T) {
+			assert.True(t, Empty(v))
+			assert.False(t, EmptyWithOptions(v, ZeroIsNotEmpty()))
+		})
+	}
+
+	empties := []interface{}{nil, "", "  ", dict{}, []interface{}{}, []string{}, map[string]int{}, [0]int{}}
+	for _, v := range empties {
+		assert.True(t, EmptyWithOptions(v, ZeroIsNotEmpty()), "%#v", v)
+	}
+
+	assert.False(t, EmptyWithOptions(1, ZeroIsNotEmpty()))
+	assert.False(t, EmptyWithOptions(true, ZeroIsNotEmpty()))
+
+	// combined with EmptyFieldwise, zero fields make a struct non-empty
+	type counts struct {
+		Hits int
+		Tags []string
+	}
+	assert.True(t, EmptyWithOptions(counts{Tags: []string{}}, EmptyFieldwise()))
+	assert.False(t, EmptyWithOptions(counts{Tags: []string{}}, EmptyFieldwise(), ZeroIsNotEmpty()))
+}
+
 func BenchmarkEmpty(b *testing.B) {
 	var w Widget
 	b.Run("struct", func(b *testing.B) {
@@ -1050,6 +4402,186 @@ func TestInternalNormalize(t *testing.T) {
 	assert.Equal(t, v, tm)
 }
 
+func TestCompareNumbers(t *testing.T) {
+	fives := []interface{}{
+		int(5), int8(5), int16(5), int32(5), int64(5),
+		uint(5), uint8(5), uint16(5), uint32(5), uint64(5),
+		float32(5), float64(5),
+	}
+	sixes := []interface{}{
+		int(6), int8(6), int16(6), int32(6), int64(6),
+		uint(6), uint8(6), uint16(6), uint32(6), uint64(6),
+		float32(6), float64(6),
+	}
+	for _, v1 := range fives {
+		for _, v2 := range fives {
+			cmp, ok := compareNumbers(v1, v2)
+			assert.True(t, ok, "%T %T", v1, v2)
+			assert.Equal(t, 0, cmp, "%T(%v) should equal %T(%v)", v1, v1, v2, v2)
+
+			ctx := newCtx()
+			assert.True(t, containsNormalized(v1, v2, ctx), "%T(%v) should contain %T(%v)", v1, v1, v2, v2)
+			ctx.release()
+		}
+		for _, v2 := range sixes {
+			cmp, ok := compareNumbers(v1, v2)
+			assert.True(t, ok, "%T %T", v1, v2)
+			assert.Equal(t, -1, cmp, "%T(%v) should be less than %T(%v)", v1, v1, v2, v2)
+			cmp, _ = compareNumbers(v2, v1)
+			assert.Equal(t, 1, cmp, "%T(%v) should be greater than %T(%v)", v2, v2, v1, v1)
+
+			ctx := newCtx()
+			assert.False(t, containsNormalized(v1, v2, ctx), "%T(%v) should not contain %T(%v)", v1, v1, v2, v2)
+			ctx.release()
+		}
+	}
+
+	tests := []struct {
+		v1, v2 interface{}
+		cmp    int
+		ok     bool
+	}{
+		{v1: int64(-1), v2: uint64(0), cmp: -1, ok: true},
+		{v1: uint64(0), v2: int64(-1), cmp: 1, ok: true},
+		{v1: uint64(math.MaxUint64), v2: int64(math.MaxInt64), cmp: 1, ok: true},
+		{v1: int64(math.MaxInt64), v2: uint64(math.MaxUint64), cmp: -1, ok: true},
+		{v1: uint64(math.MaxInt64) + 1, v2: uint64(math.MaxInt64) + 1, cmp: 0, ok: true},
+		{v1: int64(math.MinInt64), v2: int64(math.MaxInt64), cmp: -1, ok: true},
+		{v1: 5.5, v2: 5, cmp: 1, ok: true},
+		{v1: 5, v2: 5.5, cmp: -1, ok: true},
+		{v1: math.NaN(), v2: 5},
+		{v1: "5", v2: 5},
+		{v1: 5, v2: nil},
+	}
+	for _, test := range tests {
+		cmp, ok := compareNumbers(test.v1, test.v2)
+		assert.Equal(t, test.ok, ok, "%T(%v) <> %T(%v)", test.v1, test.v1, test.v2, test.v2)
+		assert.Equal(t, test.cmp, cmp, "%T(%v) <> %T(%v)", test.v1, test.v1, test.v2, test.v2)
+	}
+
+	ctx := newCtx()
+	ctx.matchEmptyValues = true
+	assert.True(t, containsNormalized(int64(5), uint8(0), ctx))
+	assert.False(t, containsNormalized(int64(5), "", ctx))
+	ctx.release()
+}
+
+func TestContainsCtx_release(t *testing.T) {
+	var trace string
+	var info TraceInfo
+	ctx := newCtx()
+	ctx.Match = Match{Matches: true, Path: "a", V1: 1, V2: 2, Error: errors.New("boom"), Message: "msg", Mismatches: []Mismatch{{Path: "a"}}}
+	ctx.currentPath = append(ctx.currentPath, ".", "a")
+	ctx.explain = true
+	ctx.equiv = true
+	ctx.template = true
+	ctx.exactKeys = true
+	ctx.strBuf = append(ctx.strBuf, "a")
+	ctx.stringContains = true
+	ctx.numberAsString = true
+	ctx.caseInsensitive = true
+	ctx.matchEmptyValues = true
+	ctx.trace = &trace
+	ctx.traceInfo = &info
+	ctx.reason = "reason"
+	ctx.roundTimes = time.Second
+	ctx.truncateTimes = time.Second
+	ctx.timeDelta = time.Second
+	ctx.ignoreTimeZone = true
+	ctx.parseDurations = true
+	ctx.durationDelta = time.Second
+	ctx.vectorSlices = true
+	ctx.vectorDelta = 1
+	ctx.floatDelta = 1
+	ctx.orderedSlices = true
+	ctx.decodeBase64 = true
+	ctx.ignoreKeys = map[string]bool{"a": true}
+	ctx.pointerPaths = true
+	ctx.emptyIsAbsent = true
+	ctx.traceClosest = true
+	ctx.flatten = true
+	ctx.collectAll = true
+	ctx.allowExtraKeysUnder = []Path{{"a"}}
+	ctx.onlyKeys = &projection{}
+	ctx.comparator = func(string, interface{}, interface{}) (bool, bool) { return false, false }
+	ctx.cancelCtx = context.Background()
+	ctx.cancelErr = context.Canceled
+	ctx.steps = 5
+	ctx.mismatchPaths = []Path{{"a"}}
+	ctx.containing = append(ctx.containing, containsFrame{v1: dict{}, v2: dict{}, pathLen: 2})
+	ctx.comparing = map[[2]visit]bool{{}: true}
+	ctx.buf.WriteString("msg")
+	ctx.NormalizeOptions = NormalizeOptions{Copy: true, Marshal: true}
+
+	ctx.release()
+	assert.Equal(t, &containsCtx{strBuf: ctx.strBuf, currentPath: ctx.currentPath, containing: ctx.containing}, ctx)
+	assert.Empty(t, ctx.strBuf)
+	assert.Empty(t, ctx.currentPath)
+	assert.Empty(t, ctx.containing)
+
+	// results from earlier comparisons don't leak into later ones
+	for i := 0; i < 10; i++ {
+		assert.True(t, ContainsMatch(1, 1).Matches)
+	}
+	m := ContainsMatch(1, 1, OnlyKeys("tags..color"))
+	assert.False(t, m.Matches)
+	assert.Error(t, m.Error)
+}
+
+func TestTransformKeys(t *testing.T) {
+	snakeToCamel := func(key string) string {
+		parts := strings.Split(key, "_")
+		for i := 1; i < len(parts); i++ {
+			if parts[i] != "" {
+				parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+			}
+		}
+		return strings.Join(parts, "")
+	}
+
+	v := dict{
+		"first_name": "bob",
+		"home_address": dict{
+			"zip_code": "12345",
+			"tags":     []interface{}{dict{"tag_name": "home"}, "not_a_key"},
+		},
+	}
+	expected := dict{
+		"firstName": "bob",
+		"homeAddress": dict{
+			"zipCode": "12345",
+			"tags":    []interface{}{dict{"tagName": "home"}, "not_a_key"},
+		},
+	}
+	out, err := TransformKeys(v, snakeToCamel)
+	require.NoError(t, err)
+	assert.Equal(t, expected, out)
+
+	// v is not modified
+	assert.Contains(t, v, "first_name")
+	assert.Contains(t, v["home_address"], "zip_code")
+
+	out, err = TransformKeys(dict{"a": dict{"b": 1}}, func(key string) string { return "x_" + key })
+	require.NoError(t, err)
+	assert.Equal(t, dict{"x_a": dict{"x_b": 1.0}}, out)
+
+	// structs are normalized first
+	out, err = TransformKeys(struct {
+		Name string `json:"user_name"`
+	}{"bob"}, snakeToCamel)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"userName": "bob"}, out)
+
+	// collisions
+	_, err = TransformKeys(dict{"items": []interface{}{dict{"Name": 1, "name": 2}}}, strings.ToLower)
+	require.Error(t, err)
+	assert.True(t, merry.Is(err, KeyCollisionError))
+	assert.EqualError(t, err, `items[0]: keys "Name" and "name" both transform to "name"`)
+
+	_, err = TransformKeys(dict{"a_b": 1, "aB": 2}, snakeToCamel)
+	assert.EqualError(t, err, `keys "aB" and "a_b" both transform to "aB"`)
+}
+
 func TestTransform(t *testing.T) {
 	in := dict{
 		"color": "red",
@@ -1119,6 +4651,145 @@ func TestTransform(t *testing.T) {
 	out, err = Transform(out, transformer)
 	assert.NoError(t, err)
 	assert.Equal(t, expected, out)
+
+	t.Run("bottomUp", func(t *testing.T) {
+		in := dict{
+			"a": 1,
+			"b": dict{
+				"c": 2,
+				"d": []interface{}{3, 4},
+			},
+		}
+
+		// replace each map or slice with the sum of its children.  Bottom-up, the
+		// parents see the sums computed for their children.
+		var visited []interface{}
+		sum := func(in interface{}) (interface{}, error) {
+			visited = append(visited, in)
+			var total float64
+			switch t := in.(type) {
+			case dict:
+				for _, v := range t {
+					total += v.(float64)
+				}
+			case []interface{}:
+				for _, v := range t {
+					total += v.(float64)
+				}
+			default:
+				return in, nil
+			}
+			return total, nil
+		}
+
+		out, err := Transform(in, sum, BottomUp())
+		require.NoError(t, err)
+		assert.Equal(t, float64(10), out)
+		// the root should be visited last, and see its transformed children
+		assert.Equal(t, dict{"a": float64(1), "b": float64(9)}, visited[len(visited)-1])
+		assert.Len(t, visited, 7)
+
+		// input should not be modified
+		assert.Equal(t, dict{"a": 1, "b": dict{"c": 2, "d": []interface{}{3, 4}}}, in)
+
+		// ErrStop stops the traversal.  Nodes already transformed keep their new values
+		visited = nil
+		out, err = Transform(dict{"a": dict{"b": "red"}}, func(in interface{}) (interface{}, error) {
+			visited = append(visited, in)
+			if s, ok := in.(string); ok {
+				return s + "s", ErrStop
+			}
+			return in, nil
+		}, BottomUp())
+		require.NoError(t, err)
+		assert.Equal(t, dict{"a": dict{"b": "reds"}}, out)
+		assert.Equal(t, []interface{}{"red"}, visited)
+	})
+
+	t.Run("collectErrors", func(t *testing.T) {
+		in := dict{
+			"name": "bob",
+			"size": -1,
+			"items": []interface{}{
+				dict{"size": 2},
+				dict{"size": -3},
+			},
+		}
+		negative := errors.New("negative")
+		validate := func(in interface{}) (interface{}, error) {
+			if f, ok := in.(float64); ok {
+				if f < 0 {
+					return nil, negative
+				}
+				return f * 10, nil
+			}
+			if in == "bob" {
+				return nil, errors.New("bob")
+			}
+			return in, nil
+		}
+
+		// without the option, the first error aborts
+		_, err := Transform(in, validate)
+		require.Error(t, err)
+		_, isCollected := err.(TransformErrors)
+		assert.False(t, isCollected)
+
+		out, err := Transform(in, validate, CollectErrors())
+		require.Error(t, err)
+		errs, ok := err.(TransformErrors)
+		require.True(t, ok)
+		assert.Equal(t, TransformErrors{
+			{Path: Path{"items", 1, "size"}, Err: negative},
+			{Path: Path{"name"}, Err: errors.New("bob")},
+			{Path: Path{"size"}, Err: negative},
+		}, errs)
+		assert.EqualError(t, err, "items[1].size: negative\nname: bob\nsize: negative")
+
+		// values which failed are unchanged, the rest are transformed
+		assert.Equal(t, dict{
+			"name":  "bob",
+			"size":  float64(-1),
+			"items": []interface{}{dict{"size": float64(20)}, dict{"size": float64(-3)}},
+		}, out)
+
+		// errors on maps are collected too, and the children are still visited
+		out, err = Transform(in, func(in interface{}) (interface{}, error) {
+			// bottom up, the child was already transformed
+			if m, ok := in.(dict); ok && m["size"] == float64(20) {
+				return nil, errors.New("two")
+			}
+			return validate(in)
+		}, CollectErrors(), BottomUp())
+		assert.EqualError(t, err, "items[0]: two\nitems[1].size: negative\nname: bob\nsize: negative")
+		assert.Equal(t, dict{"size": float64(20)}, out.(dict)["items"].([]interface{})[0])
+
+		// indexes are sorted numerically
+		items := make([]interface{}, 12)
+		for i := range items {
+			items[i] = 1
+		}
+		items[2], items[10], items[11] = -1, -1, -1
+		_, err = Transform(items, validate, CollectErrors())
+		assert.EqualError(t, err, "[2]: negative\n[10]: negative\n[11]: negative")
+
+		// errors on the root have an empty path
+		_, err = Transform("bob", validate, CollectErrors())
+		assert.Equal(t, TransformErrors{{Err: errors.New("bob")}}, err)
+		assert.EqualError(t, err, "bob")
+
+		// ErrStop still stops, returning the errors collected so far
+		_, err = Transform(dict{"a": "bob"}, func(in interface{}) (interface{}, error) {
+			if in == "bob" {
+				return nil, errors.New("bob")
+			}
+			if _, ok := in.(dict); ok {
+				return in, ErrStop
+			}
+			return in, nil
+		}, CollectErrors(), BottomUp())
+		assert.EqualError(t, err, "a: bob")
+	})
 }
 
 func TestParsePath(t *testing.T) {
@@ -1130,13 +4801,59 @@ func TestParsePath(t *testing.T) {
 		{"", nil, true},
 		{"a", Path{"a"}, true},
 		{"a.b", Path{"a", "b"}, true},
-		{"a.b..c", Path{"a", "b", "c"}, false},
+		{"a.b..c", Path{"a", "b", RecursiveDescent{}, "c"}, true},
+		{"..c", Path{RecursiveDescent{}, "c"}, true},
+		{"a...c", Path{"a", RecursiveDescent{}, "c"}, false},
+		{"a..[0]", Path{"a", RecursiveDescent{}, 0}, true},
+		{"a..*", Path{"a", RecursiveDescent{}, Wildcard{}}, true},
+		{"..", Path{RecursiveDescent{}}, true},
+		{"a.", Path{"a"}, false},
 		{"[3]", Path{3}, true},
 		{"a[3]", Path{"a", 3}, true},
 		{"a.b[3]", Path{"a", "b", 3}, true},
 		{"a[1].b[3]", Path{"a", 1, "b", 3}, true},
+		{"a[-1]", Path{"a", -1}, true},
+		{"a[-2].b[-10]", Path{"a", -2, "b", -10}, true},
+		{"[-1].[0]", Path{-1, 0}, true},
 		{"[1].[3]", Path{1, 3}, true},
 		{"a[b].c", Path{"a[b]", "c"}, true},
+		{"a[]", Path{"a", EachElement{}}, true},
+		{"a[].b", Path{"a", EachElement{}, "b"}, true},
+		{"[]", Path{EachElement{}}, true},
+		{"a[].[].b", Path{"a", EachElement{}, EachElement{}, "b"}, true},
+		{"a[1].b[].c[0]", Path{"a", 1, "b", EachElement{}, "c", 0}, true},
+		{"*", Path{Wildcard{}}, true},
+		{"a.*.b", Path{"a", Wildcard{}, "b"}, true},
+		{"a[*].b", Path{"a", Wildcard{}, "b"}, false},
+		{"a[1].*", Path{"a", 1, Wildcard{}}, true},
+		{"[*]", Path{Wildcard{}}, false},
+		{"a.*b", Path{"a", "*b"}, true},
+		{`a\.b.c`, Path{"a.b", "c"}, true},
+		{`a\\b`, Path{`a\b`}, true},
+		{`a\[1]`, Path{"a[1]"}, true},
+		{`a[b]`, Path{"a[b]"}, true},
+		{`a[b].c[1]`, Path{"a[b]", "c", 1}, true},
+		{`a\[]`, Path{"a[]"}, true},
+		{`\*`, Path{"*"}, true},
+		{"**", Path{RecursiveDescent{}}, false},
+		{"a.**.b", Path{"a", RecursiveDescent{}, "b"}, false},
+		{"a.**.**.b", Path{"a", RecursiveDescent{}, "b"}, false},
+		{"a..**.b", Path{"a", RecursiveDescent{}, "b"}, false},
+		{"**[0]", Path{RecursiveDescent{}, 0}, false},
+		{`\*\*`, Path{"**"}, true},
+		{`a.\*\*.b`, Path{"a", "**", "b"}, true},
+		{"a.**b", Path{"a", "**b"}, true},
+		{`a.\*.b`, Path{"a", "*", "b"}, true},
+		{`["my.key"]`, Path{"my.key"}, false},
+		{`a["my.key"].b`, Path{"a", "my.key", "b"}, false},
+		{`a["my.key"][0]`, Path{"a", "my.key", 0}, false},
+		{`a["weird[name]"]`, Path{"a", "weird[name]"}, false},
+		{`a["q\"uote\\"]`, Path{"a", `q"uote\`}, false},
+		{`a["unterminated`, Path{"a[\"unterminated"}, false},
+		{`a[""]`, Path{"a", ""}, true},
+		{`a[" b "]`, Path{"a", " b "}, true},
+		{`a.b\`, Path{"a", `b\`}, false},
+		{`a[1][2]`, Path{"a", 1, 2}, false},
 	}
 	for _, test := range tests {
 		out, err := ParsePath(test.in)
@@ -1148,6 +4865,125 @@ func TestParsePath(t *testing.T) {
 	}
 
 	assert.Equal(t, "a.b[3]", Path{"a", "b", 3, "c", 4}[0:3].String())
+
+	// keys with special characters round trip
+	keys := []string{"my.key", "weird[name]", "a[1]", "a[]", "a[*]", `a["b"]`, `back\slash`, "*", "**", "", " ", `"`, "a.", ".", "..", "[", "]", "[[1]]"}
+	for _, key := range keys {
+		p := Path{key, 0, key, RecursiveDescent{}, key, Wildcard{}, key}
+		parsed, err := ParsePath(p.String())
+		require.NoError(t, err)
+		assert.Equal(t, p, parsed, "key: %q, string: %v", key, p.String())
+	}
+
+	// empty keys are quoted, so they aren't confused with RecursiveDescent
+	v := dict{"a": dict{"": dict{"c": 1}, "c": 2}}
+	for _, p := range []Path{{"a", "", "c"}, {"", ""}, {"", 0, ""}, {"a", RecursiveDescent{}, "", "c"}} {
+		s := p.String()
+		parsed, err := ParsePath(s)
+		require.NoError(t, err)
+		assert.Equal(t, p, parsed, "string: %v", s)
+	}
+	assert.Equal(t, `a[""].c`, Path{"a", "", "c"}.String())
+	got, err := Get(v, Path{"a", "", "c"}.String())
+	require.NoError(t, err)
+	assert.Equal(t, 1, got)
+	got, err = Get(v, "a.c")
+	require.NoError(t, err)
+	assert.Equal(t, 2, got)
+}
+
+func TestPath_StringRoundTrip(t *testing.T) {
+	// every combination of up to three elements, including consecutive indices
+	elems := []interface{}{0, 3, -1, EachElement{}, Wildcard{}, RecursiveDescent{}, "a", ""}
+	paths := []Path{nil}
+	for depth := 0; depth < 3; depth++ {
+		for _, p := range paths {
+			if len(p) != depth {
+				continue
+			}
+			for _, elem := range elems {
+				if elem == (RecursiveDescent{}) && len(p) > 0 && p[len(p)-1] == (RecursiveDescent{}) {
+					// consecutive RecursiveDescents are collapsed
+					continue
+				}
+				paths = append(paths, append(p[:len(p):len(p)], elem))
+			}
+		}
+	}
+	for _, p := range paths {
+		s := p.String()
+		parsed, err := ParsePath(s)
+		require.NoError(t, err)
+		assert.Equal(t, p, parsed, "string: %v", s)
+		// the string form is canonical
+		assert.Equal(t, s, parsed.String())
+	}
+
+	// consecutive indices are separated by dots, but may be parsed without them
+	assert.Equal(t, "[1].[3]", Path{1, 3}.String())
+	assert.Equal(t, "a[1].[2].[]", Path{"a", 1, 2, EachElement{}}.String())
+	for _, s := range []string{"[1][3]", "[1].[3]"} {
+		p, err := ParsePath(s)
+		require.NoError(t, err)
+		assert.Equal(t, Path{1, 3}, p, s)
+	}
+}
+
+func TestParsePathStrict(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Path
+	}{
+		{"", nil},
+		{"a.b", Path{"a", "b"}},
+		{"a..c", Path{"a", "", "c"}},
+		{"a...c", Path{"a", "", "", "c"}},
+		{"a.", Path{"a", ""}},
+		{".a", Path{"", "a"}},
+		{".", Path{"", ""}},
+		{"a..[0]", Path{"a", "", 0}},
+		{`a[""].c`, Path{"a", "", "c"}},
+		{"a.**.c", Path{"a", RecursiveDescent{}, "c"}},
+		{`a.\*\*.c`, Path{"a", "**", "c"}},
+		{"a[1].*", Path{"a", 1, Wildcard{}}},
+	}
+	for _, test := range tests {
+		out, err := ParsePathStrict(test.in)
+		require.NoError(t, err)
+		assert.Equal(t, test.out, out, "input: %v", test.in)
+	}
+
+	// the lenient parser is unchanged
+	p, err := ParsePath("a..c")
+	require.NoError(t, err)
+	assert.Equal(t, Path{"a", RecursiveDescent{}, "c"}, p)
+
+	// empty keys round trip through Path.String
+	elems := []interface{}{0, -1, EachElement{}, Wildcard{}, "a", "", " ", "**"}
+	paths := []Path{nil}
+	for depth := 0; depth < 3; depth++ {
+		for _, p := range paths {
+			if len(p) != depth {
+				continue
+			}
+			for _, elem := range elems {
+				paths = append(paths, append(p[:len(p):len(p)], elem))
+			}
+		}
+	}
+	for _, p := range paths {
+		s := p.String()
+		parsed, err := ParsePathStrict(s)
+		require.NoError(t, err)
+		assert.Equal(t, p, parsed, "string: %v", s)
+	}
+
+	doc := dict{"a": dict{"": dict{"c": 1}, "c": 2}}
+	p, err = ParsePathStrict("a..c")
+	require.NoError(t, err)
+	got, err := GetPath(doc, p)
+	require.NoError(t, err)
+	assert.Equal(t, 1, got)
 }
 
 const largeTestVal1 string = `
@@ -1265,6 +5101,22 @@ func BenchmarkGet(b *testing.B) {
 	}
 }
 
+func BenchmarkGetPath(b *testing.B) {
+	n1, err := Normalize(json.RawMessage(largeTestVal1))
+	require.NoError(b, err)
+
+	p, err := Compile("environment.obligations.blue.details.color")
+	require.NoError(b, err)
+	get, err := GetPath(n1, p)
+	require.NoError(b, err)
+	require.Equal(b, "blue", get)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = GetPath(n1, p)
+	}
+}
+
 func BenchmarkContains(b *testing.B) {
 	// factor out the time to normalize
 	n1, err := Normalize(json.RawMessage(largeTestVal1))
@@ -1293,6 +5145,7 @@ func BenchmarkContains(b *testing.B) {
 	require.NoError(b, err)
 
 	b.Run("containsMismatchWithTrace", func(b *testing.B) {
+		b.ReportAllocs()
 		var traceMsg string
 
 		for i := 0; i < b.N; i++ {
@@ -1301,24 +5154,28 @@ func BenchmarkContains(b *testing.B) {
 	})
 
 	b.Run("containsMismatchNoTrace", func(b *testing.B) {
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			Contains(n1, notMatchingValue)
 		}
 	})
 
 	b.Run("containsMatching", func(b *testing.B) {
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			Contains(n1, matchingValue)
 		}
 	})
 
 	b.Run("containsMatchMismatch", func(b *testing.B) {
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			ContainsMatch(n1, notMatchingValue)
 		}
 	})
 
 	b.Run("containsMatchMatching", func(b *testing.B) {
+		b.ReportAllocs()
 		for i := 0; i < b.N; i++ {
 			ContainsMatch(n1, matchingValue)
 		}
@@ -1327,6 +5184,8 @@ func BenchmarkContains(b *testing.B) {
 }
 
 func BenchmarkEquivalent(b *testing.B) {
+	b.ReportAllocs()
+
 	// factor out the time to normalize
 	n1, err := Normalize(json.RawMessage(largeTestVal1))
 	require.NoError(b, err)
@@ -1363,6 +5222,69 @@ func BenchmarkAvoidMarshal(b *testing.B) {
 	}
 }
 
+func BenchmarkParallel(b *testing.B) {
+	v1 := make([]interface{}, 300)
+	for i := range v1 {
+		v1[i] = dict{"id": i, "name": strconv.Itoa(i), "tags": []interface{}{"a", "b"}}
+	}
+	v2 := make([]interface{}, len(v1))
+	copy(v2, v1)
+	rand.Shuffle(len(v2), func(i, j int) {
+		v2[i], v2[j] = v2[j], v2[i]
+	})
+
+	for _, n := range []int{0, 2, 4, 8} {
+		b.Run(fmt.Sprintf("parallel %v", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m := EquivalentMatch(v1, v2, Parallel(n))
+				if !m.Matches {
+					b.Fatal("the slices weren't equivalent: ", m.Message)
+				}
+			}
+		})
+	}
+}
+
+type namedStrings []string
+
+type namedStringMap map[string]string
+
+func BenchmarkNormalizeTyped(b *testing.B) {
+	strs := make([]string, 100)
+	m := make(map[string]string, 100)
+	for i := range strs {
+		strs[i] = strconv.Itoa(i)
+		m[strs[i]] = strs[i]
+	}
+
+	// named types are converted with reflection
+	b.Run("[]string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Normalize(strs)
+		}
+	})
+	b.Run("[]string reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Normalize(namedStrings(strs))
+		}
+	})
+	b.Run("map[string]string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Normalize(m)
+		}
+	})
+	b.Run("map[string]string reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = Normalize(namedStringMap(m))
+		}
+	})
+}
+
 func BenchmarkEquivalentSlices(b *testing.B) {
 	// the toughest slice match is a large slice with lots of duplicates
 	v1 := make([]string, 300)
@@ -1392,6 +5314,18 @@ func BenchmarkEquivalentSlices(b *testing.B) {
 		}
 	})
 
+	// a comparator disables the hash-based fast path
+	searching := Comparator(func(string, interface{}, interface{}) (bool, bool) { return false, false })
+	b.Run("large slices, searching", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := EquivalentMatch(v1, v2, searching)
+			if !m.Matches {
+				b.Fatal("the slices weren't equivalent: ", m.Message)
+			}
+		}
+	})
+
 	v1 = make([]string, 60)
 	v2 = make([]string, 60)
 	for i := 0; i < 30; i++ {
@@ -1,6 +1,7 @@
 package mapstest
 
 import (
+	"encoding/json"
 	"fmt"
 	maps "github.com/ansel1/vespucci/v4"
 	"github.com/davecgh/go-spew/spew"
@@ -15,6 +16,21 @@ type strictMarker int
 // disables the default ContainsOptions.
 const Strict strictMarker = 0
 
+type defaultsMarker int
+
+// These options can be passed to the Contains and Equivalent assertions to disable one of the
+// default ContainsOptions, keeping the others.  For example, to keep matching empty values, but
+// require time zones to match:
+//
+//	AssertContains(t, v1, v2, NoIgnoreTimeZones)
+//
+// Since maps.IgnoreTimeZones implies maps.ParseTimes, NoParseTimes disables both.
+const (
+	NoEmptyValuesMatchAny defaultsMarker = 1 << iota
+	NoIgnoreTimeZones
+	NoParseTimes
+)
+
 // AssertContains returns true if maps.Contains(v1, v2).  The following
 // ContainsOptions are automatically applied:
 //
@@ -26,19 +42,30 @@ const Strict strictMarker = 0
 //
 //	AssertContains(t, v1, v2, Strict)
 //
+// Or individually, by passing NoEmptyValuesMatchAny, NoIgnoreTimeZones, or NoParseTimes.
+//
 // optsMsgAndArgs can contain a string msg and a series of args, which
 // will be formatted into the assertion failure message.
 //
 // optsMsgAndArgs may also contain additional ContainOptions, which will be extracted
 // and applied to the Contains() function.
 func AssertContains(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	return AssertContainsMatch(t, v1, v2, optsMsgAndArgs...).Matches
+}
+
+// AssertContainsMatch is like AssertContains, but returns the maps.Match, so the path and
+// values of the mismatch can be inspected, like by tools which aggregate test failures.
+func AssertContainsMatch(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{}) maps.Match {
 	if h, ok := t.(tHelper); ok {
 		h.Helper()
 	}
 	opts, optsMsgAndArgs := splitOptions(optsMsgAndArgs)
 	match := maps.ContainsMatch(v1, v2, opts...)
 	if !assert.NoError(t, match.Error, match.Message) {
-		return false
+		return match
 	}
 
 	if !match.Matches {
@@ -50,12 +77,12 @@ func AssertContains(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{
 		if assert.NoError(t, err, "error normalizing v2") {
 			v2 = nv2
 		}
-		diff := containsDiff(v1, v2)
-		return assert.Fail(t, fmt.Sprintf("v1 does not contain v2: \n"+
+		diff := DiffFormatter(v1, v2)
+		assert.Fail(t, fmt.Sprintf("v1 does not contain v2: \n"+
 			"%s%s", match.Message, diff), optsMsgAndArgs...)
 	}
 
-	return true
+	return match
 }
 
 // AssertNotContains is the inverse of AssertContains
@@ -93,19 +120,30 @@ func AssertNotContains(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interfa
 // - maps.IgnoreTimeZones(true)
 // - maps.ParseTimes
 //
+// These default options can be suppressed like in AssertContains.
+//
 // optsMsgAndArgs can contain a string msg and a series of args, which
 // will be formatted into the assertion failure message.
 //
 // optsMsgAndArgs may also contain additional ContainOptions, which will be extracted
 // and applied to the Equivalent() function.
 func AssertEquivalent(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	return AssertEquivalentMatch(t, v1, v2, optsMsgAndArgs...).Matches
+}
+
+// AssertEquivalentMatch is like AssertEquivalent, but returns the maps.Match, like
+// AssertContainsMatch.
+func AssertEquivalentMatch(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{}) maps.Match {
 	if h, ok := t.(tHelper); ok {
 		h.Helper()
 	}
 	opts, optsMsgAndArgs := splitOptions(optsMsgAndArgs)
 	match := maps.EquivalentMatch(v1, v2, opts...)
 	if !assert.NoError(t, match.Error, match.Message) {
-		return false
+		return match
 	}
 
 	if !match.Matches {
@@ -117,11 +155,11 @@ func AssertEquivalent(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interfac
 		if assert.NoError(t, err, "error normalizing v2") {
 			v2 = nv2
 		}
-		return assert.Fail(t, fmt.Sprintf("v1 !≈ v2: \n"+
-			"%s%s", match.Message, containsDiff(v1, v2)), optsMsgAndArgs...)
+		assert.Fail(t, fmt.Sprintf("v1 !≈ v2: \n"+
+			"%s%s", match.Message, DiffFormatter(v1, v2)), optsMsgAndArgs...)
 	}
 
-	return true
+	return match
 }
 
 // AssertNotEquivalent is the inverse of AssertEquivalent
@@ -152,6 +190,49 @@ func AssertNotEquivalent(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...inter
 	return true
 }
 
+// AssertContainsJSON is like AssertContains, but v2 is a JSON document, which is unmarshaled
+// before comparing.  Fails if expectedJSON isn't valid JSON.
+//
+//	AssertContainsJSON(t, resp, `{"name":"bob","tags":["red"]}`)
+func AssertContainsJSON(t TestingT, v1 interface{}, expectedJSON string, optsMsgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	v2, ok := unmarshalExpected(t, expectedJSON, optsMsgAndArgs)
+	if !ok {
+		return false
+	}
+	return AssertContains(t, v1, v2, optsMsgAndArgs...)
+}
+
+// AssertEquivalentJSON is like AssertEquivalent, but v2 is a JSON document, which is unmarshaled
+// before comparing.  Fails if expectedJSON isn't valid JSON.
+func AssertEquivalentJSON(t TestingT, v1 interface{}, expectedJSON string, optsMsgAndArgs ...interface{}) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	v2, ok := unmarshalExpected(t, expectedJSON, optsMsgAndArgs)
+	if !ok {
+		return false
+	}
+	return AssertEquivalent(t, v1, v2, optsMsgAndArgs...)
+}
+
+// unmarshalExpected unmarshals the expected value for the JSON assertions, and fails the
+// test if it's invalid.
+func unmarshalExpected(t TestingT, expectedJSON string, optsMsgAndArgs []interface{}) (interface{}, bool) {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(expectedJSON), &v); err != nil {
+		// copy, so optsMsgAndArgs isn't modified
+		_, msgAndArgs := splitOptions(append([]interface{}(nil), optsMsgAndArgs...))
+		return nil, assert.Fail(t, fmt.Sprintf("expected value is not valid JSON: %v\n%s", err, expectedJSON), msgAndArgs...)
+	}
+	return v, true
+}
+
 // RequireContains is like AssertContains, but fails the test immediately.
 func RequireContains(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...interface{}) {
 	if h, ok := t.(tHelper); ok {
@@ -192,6 +273,14 @@ func RequireNotEquivalent(t TestingT, v1, v2 interface{}, optsMsgAndArgs ...inte
 	}
 }
 
+// DiffFormatter renders the difference between v1 and v2 in the failure messages of
+// AssertContains and AssertEquivalent.  The result is appended to the explanation of why the
+// values don't match.  v1 and v2 are normalized first, if possible.
+//
+// The default is a unified diff of both values.  It can be replaced with a more compact
+// format for large documents, like one line per changed path, built with maps.Diff.
+var DiffFormatter = containsDiff
+
 var spewC = spew.ConfigState{
 	Indent:                  " ",
 	DisablePointerAddresses: true,
@@ -225,11 +314,14 @@ func containsDiff(v1 interface{}, v2 interface{}) string {
 func splitOptions(args []interface{}) (opts []maps.ContainsOption, msgAndArgs []interface{}) {
 	msgAndArgs = args[:0]
 	var strict bool
+	var disabled defaultsMarker
 
 	for _, arg := range args {
 		switch t := arg.(type) {
 		case strictMarker:
 			strict = true
+		case defaultsMarker:
+			disabled |= t
 		case maps.ContainsOption:
 			opts = append(opts, t)
 		default:
@@ -238,11 +330,15 @@ func splitOptions(args []interface{}) (opts []maps.ContainsOption, msgAndArgs []
 	}
 
 	if !strict {
-		opts = append(opts,
-			maps.EmptyMapValuesMatchAny(),
-			maps.IgnoreTimeZones(true),
-			maps.ParseTimes(),
-		)
+		if disabled&NoEmptyValuesMatchAny == 0 {
+			opts = append(opts, maps.EmptyMapValuesMatchAny())
+		}
+		if disabled&(NoIgnoreTimeZones|NoParseTimes) == 0 {
+			opts = append(opts, maps.IgnoreTimeZones(true))
+		}
+		if disabled&NoParseTimes == 0 {
+			opts = append(opts, maps.ParseTimes())
+		}
 	}
 
 	return
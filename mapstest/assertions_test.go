@@ -5,6 +5,7 @@ import (
 	maps "github.com/ansel1/vespucci/v4"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 type mockTestingT struct {
@@ -130,3 +131,122 @@ func TestAssertionsContains(t *testing.T) {
 		})
 	}
 }
+
+func TestAssertionsDefaults(t *testing.T) {
+	tm := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	est := tm.In(time.FixedZone("EST", -5*60*60))
+	v1 := dict{"color": "red", "created": tm}
+
+	tests := []struct {
+		name     string
+		v2       interface{}
+		opts     []interface{}
+		contains bool
+	}{
+		{"defaults", dict{"color": "", "created": est}, nil, true},
+		{"strict", dict{"color": "", "created": est}, []interface{}{Strict}, false},
+		{"no empty values", dict{"color": ""}, []interface{}{NoEmptyValuesMatchAny}, false},
+		{"no empty values keeps time zones", dict{"created": est}, []interface{}{NoEmptyValuesMatchAny}, true},
+		{"no time zones keeps empty values", dict{"color": ""}, []interface{}{NoIgnoreTimeZones}, true},
+		{"no time zones", dict{"created": est}, []interface{}{NoIgnoreTimeZones}, false},
+		{"no time zones keeps parsing times", dict{"created": tm.Format("2006-01-02T15:04:05.000Z07:00")}, []interface{}{NoIgnoreTimeZones}, true},
+		{"no parse times", dict{"created": tm.Format("2006-01-02T15:04:05.000Z07:00")}, []interface{}{NoParseTimes}, false},
+		{"no parse times keeps empty values", dict{"color": ""}, []interface{}{NoParseTimes}, true},
+		{"combined", dict{"color": ""}, []interface{}{NoIgnoreTimeZones, NoEmptyValuesMatchAny}, false},
+		{"with other options", dict{"color": "re"}, []interface{}{NoIgnoreTimeZones, maps.StringContains()}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mt := mockTestingT{}
+			assert.Equal(t, test.contains, AssertContains(&mt, v1, test.v2, test.opts...), mt.msg)
+		})
+	}
+}
+
+func TestAssertionsJSON(t *testing.T) {
+	v1 := dict{"name": "bob", "tags": []string{"red", "blue"}, "size": 5}
+
+	mt := mockTestingT{}
+	assert.True(t, AssertContainsJSON(&mt, v1, `{"name":"bob","tags":["blue"]}`), mt.msg)
+	assert.True(t, AssertEquivalentJSON(&mt, v1, `{"name":"bob","tags":["red","blue"],"size":5}`), mt.msg)
+	assert.False(t, mt.failed)
+
+	// options and messages are passed along
+	assert.True(t, AssertContainsJSON(&mt, v1, `{"name":"b"}`, maps.StringContains(), "sample %v", 1), mt.msg)
+
+	mt = mockTestingT{}
+	assert.False(t, AssertContainsJSON(&mt, v1, `{"name":"alice"}`, "sample %v", 1))
+	assert.True(t, mt.failed)
+	assert.Contains(t, mt.msg, "v1 does not contain v2")
+	assert.Contains(t, mt.msg, "sample 1")
+
+	mt = mockTestingT{}
+	assert.False(t, AssertEquivalentJSON(&mt, v1, `{"name":"bob"}`))
+	assert.True(t, mt.failed)
+
+	for _, fn := range []func(TestingT, interface{}, string, ...interface{}) bool{AssertContainsJSON, AssertEquivalentJSON} {
+		mt = mockTestingT{}
+		assert.False(t, fn(&mt, v1, `{"name":`, Strict, "sample %v", 1))
+		assert.True(t, mt.failed)
+		assert.Contains(t, mt.msg, "expected value is not valid JSON: unexpected end of JSON input")
+		assert.Contains(t, mt.msg, "sample 1")
+	}
+}
+
+func TestDiffFormatter(t *testing.T) {
+	old := DiffFormatter
+	t.Cleanup(func() { DiffFormatter = old })
+	DiffFormatter = func(v1, v2 interface{}) string {
+		changes, err := maps.Diff(v1, v2)
+		if err != nil {
+			return err.Error()
+		}
+		var s string
+		for _, c := range changes {
+			s += fmt.Sprintf("\n%s: v1=%v v2=%v", c.Path, c.OldValue, c.NewValue)
+		}
+		return s
+	}
+
+	v1 := dict{"resource": dict{"state": "Active", "name": "web"}}
+	v2 := dict{"resource": dict{"state": "Pending"}}
+
+	mt := mockTestingT{}
+	assert.False(t, AssertContains(&mt, v1, v2))
+	assert.Contains(t, mt.msg, "v1 does not contain v2")
+	assert.Contains(t, mt.msg, "resource.state: v1=Active v2=Pending")
+	assert.NotContains(t, mt.msg, "Diff:")
+
+	mt = mockTestingT{}
+	assert.False(t, AssertEquivalent(&mt, v1, v2))
+	assert.Contains(t, mt.msg, "resource.name: v1=web v2=<nil>")
+}
+
+func TestAssertContainsMatch(t *testing.T) {
+	v1 := dict{"resource": dict{"state": "Active", "name": "web"}}
+
+	mt := mockTestingT{}
+	m := AssertContainsMatch(&mt, v1, dict{"resource": dict{"state": "Pending"}})
+	assert.False(t, m.Matches)
+	assert.True(t, mt.failed)
+	assert.Equal(t, "resource.state", m.Path)
+	assert.Equal(t, "Active", m.V1)
+	assert.Equal(t, "Pending", m.V2)
+
+	mt = mockTestingT{}
+	m = AssertContainsMatch(&mt, v1, dict{"resource": dict{"state": "Active"}})
+	assert.True(t, m.Matches)
+	assert.False(t, mt.failed)
+
+	mt = mockTestingT{}
+	m = AssertEquivalentMatch(&mt, v1, dict{"resource": dict{"state": "Active"}})
+	assert.False(t, m.Matches)
+	assert.True(t, mt.failed)
+	assert.Equal(t, "resource", m.Path)
+
+	mt = mockTestingT{}
+	m = AssertContainsMatch(&mt, v1, make(chan bool))
+	assert.False(t, m.Matches)
+	assert.Error(t, m.Error)
+	assert.True(t, mt.failed)
+}
@@ -0,0 +1,169 @@
+package maps
+
+import (
+	"fmt"
+	"time"
+)
+
+// matcher can be used as a v2 value in Contains and Equivalent.  Instead of
+// comparing v1 to the matcher, the matcher decides whether v1 matches.  v1 is normalized
+// before being passed to the matcher.
+//
+// If v1 doesn't match, the matcher should call ctx.traceMsg to explain why.
+type matcher interface {
+	match(v1 interface{}, ctx *containsCtx) bool
+}
+
+// TimeRange is a v2 value which matches v1 time values within a range.
+// See TimeBetween.
+type TimeRange struct {
+	Lo, Hi time.Time
+}
+
+// TimeBetween returns a value which can be used in v2 in Contains or Equivalent.  It
+// matches v1 values which are times, or strings which can be parsed into times, and
+// which fall between lo and hi.  Both bounds are inclusive:
+//
+//	v1 := map[string]interface{}{"createdAt": "2017-03-03T14:08:30Z"}
+//	lo := time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC)
+//	hi := time.Date(2017, 3, 4, 0, 0, 0, 0, time.UTC)
+//	Contains(v1, map[string]interface{}{"createdAt": TimeBetween(lo, hi)}) // true
+//
+// Time zones are ignored: only the instants are compared.
+func TimeBetween(lo, hi time.Time) TimeRange {
+	return TimeRange{Lo: lo, Hi: hi}
+}
+
+// String implements fmt.Stringer
+func (r TimeRange) String() string {
+	return fmt.Sprintf("[%v, %v]", r.Lo, r.Hi)
+}
+
+func (r TimeRange) match(v1 interface{}, ctx *containsCtx) bool {
+	var tm time.Time
+	switch t := v1.(type) {
+	case time.Time:
+		tm = t
+	case string:
+		var err error
+		if tm, err = parseTime(t, ctx.TimeLayouts); err != nil {
+			ctx.traceMsg(v1, r.String(), `v1 is not a time`)
+			return false
+		}
+	default:
+		ctx.traceMsg(v1, r.String(), `v1 is not a time`)
+		return false
+	}
+
+	if tm.Before(r.Lo) || tm.After(r.Hi) {
+		ctx.traceMsg(tm.String(), r.String(), `v1 is not between %v and %v`, r.Lo, r.Hi)
+		return false
+	}
+	return true
+}
+
+// NumberRange is a v2 value which matches v1 numbers within a range.
+// See NumberBetween and NumberBetweenExclusive.
+//
+// Both bounds are inclusive by default.  Set ExcludeLo or ExcludeHi to
+// make a bound exclusive.
+type NumberRange struct {
+	Lo, Hi               float64
+	ExcludeLo, ExcludeHi bool
+}
+
+// NumberBetween returns a value which can be used in v2 in Contains or Equivalent.  It
+// matches v1 values which are numbers between lo and hi.  Both bounds are inclusive:
+//
+//	v1 := map[string]interface{}{"size": 5}
+//	Contains(v1, map[string]interface{}{"size": NumberBetween(1, 5)}) // true
+//	Contains(v1, map[string]interface{}{"size": NumberBetweenExclusive(1, 5)}) // false
+func NumberBetween(lo, hi float64) NumberRange {
+	return NumberRange{Lo: lo, Hi: hi}
+}
+
+// NumberBetweenExclusive is like NumberBetween, but both bounds are exclusive.
+func NumberBetweenExclusive(lo, hi float64) NumberRange {
+	return NumberRange{Lo: lo, Hi: hi, ExcludeLo: true, ExcludeHi: true}
+}
+
+// String implements fmt.Stringer.  It returns the range in interval notation,
+// e.g. "[1, 5)".
+func (r NumberRange) String() string {
+	open, closing := "[", "]"
+	if r.ExcludeLo {
+		open = "("
+	}
+	if r.ExcludeHi {
+		closing = ")"
+	}
+	return fmt.Sprintf("%s%v, %v%s", open, r.Lo, r.Hi, closing)
+}
+
+func (r NumberRange) match(v1 interface{}, ctx *containsCtx) bool {
+	lo, ok := compareNumbers(v1, r.Lo)
+	if !ok {
+		ctx.traceMsg(v1, r.String(), `v1 is not a number`)
+		return false
+	}
+	hi, _ := compareNumbers(v1, r.Hi)
+
+	if lo < 0 || hi > 0 || (r.ExcludeLo && lo == 0) || (r.ExcludeHi && hi == 0) {
+		ctx.traceMsg(v1, r.String(), `v1 is not in %v`, r)
+		return false
+	}
+	return true
+}
+
+// TypeMatcher is a v2 value which matches any v1 value of a particular
+// JSON type, regardless of the value itself:
+//
+//	v1 := map[string]interface{}{"size": 5, "color": "red"}
+//	Contains(v1, map[string]interface{}{"size": IsNumber, "color": IsString}) // true
+//
+// TypeMatchers are also the type tokens used in Validate schemas.
+type TypeMatcher string
+
+// TypeMatchers for each of the JSON types.
+const (
+	IsString TypeMatcher = "string"
+	IsNumber TypeMatcher = "number"
+	IsBool   TypeMatcher = "bool"
+	IsMap    TypeMatcher = "object"
+	IsSlice  TypeMatcher = "array"
+	IsNull   TypeMatcher = "null"
+)
+
+// String implements fmt.Stringer
+func (m TypeMatcher) String() string {
+	return string(m)
+}
+
+func (m TypeMatcher) match(v1 interface{}, ctx *containsCtx) bool {
+	if t := jsonType(v1); t != m {
+		ctx.traceMsg(v1, m.String(), `v1 is a %v, not a %v`, t, m)
+		return false
+	}
+	return true
+}
+
+// jsonType returns the JSON type of the normalized value v.  Times are
+// treated as strings, since that's how they marshal.
+func jsonType(v interface{}) TypeMatcher {
+	switch v.(type) {
+	case nil:
+		return IsNull
+	case string, time.Time:
+		return IsString
+	case bool:
+		return IsBool
+	case map[string]interface{}:
+		return IsMap
+	case []interface{}:
+		return IsSlice
+	}
+	if kind, _, _, _ := asNumber(v); kind != notNumber {
+		return IsNumber
+	}
+	return TypeMatcher(fmt.Sprintf("%T", v))
+}
@@ -0,0 +1,103 @@
+package maps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTimeBetween(t *testing.T) {
+	lo := time.Date(2017, 3, 3, 0, 0, 0, 0, time.UTC)
+	hi := time.Date(2017, 3, 4, 0, 0, 0, 0, time.UTC)
+	r := TimeBetween(lo, hi)
+
+	tests := []struct {
+		name     string
+		v1       interface{}
+		expected bool
+		options  []ContainsOption
+	}{
+		{name: "inside", v1: lo.Add(time.Hour), expected: true},
+		{name: "lower bound inclusive", v1: lo, expected: true},
+		{name: "upper bound inclusive", v1: hi, expected: true},
+		{name: "before", v1: lo.Add(-time.Nanosecond)},
+		{name: "after", v1: hi.Add(time.Nanosecond)},
+		{name: "string", v1: "2017-03-03T14:08:30Z", expected: true},
+		{name: "string outside", v1: "2017-03-05T14:08:30Z"},
+		{name: "other time zone", v1: lo.In(time.FixedZone("test", -3*60*60)), expected: true},
+		{name: "parse times", v1: "2017-03-03T14:08:30Z", expected: true, options: []ContainsOption{ParseTimes()}},
+		{name: "not a time", v1: "red"},
+		{name: "number", v1: 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Contains(test.v1, r, test.options...))
+			assert.Equal(t, test.expected, Contains(dict{"createdAt": test.v1}, dict{"createdAt": r}, test.options...))
+			assert.Equal(t, test.expected, Equivalent(dict{"createdAt": test.v1}, dict{"createdAt": r}, test.options...))
+		})
+	}
+
+	assert.True(t, Equivalent([]interface{}{lo, hi}, []interface{}{r, r}))
+
+	var trace string
+	Contains(dict{"createdAt": hi.Add(time.Hour)}, dict{"createdAt": r}, Trace(&trace))
+	assert.Equal(t, `v1 is not between 2017-03-03 00:00:00 +0000 UTC and 2017-03-04 00:00:00 +0000 UTC
+v1.createdAt -> "2017-03-04 01:00:00 +0000 UTC"
+v2.createdAt -> "[2017-03-03 00:00:00 +0000 UTC, 2017-03-04 00:00:00 +0000 UTC]"`, trace)
+
+	Contains(dict{"createdAt": "red"}, dict{"createdAt": r}, Trace(&trace))
+	assert.Equal(t, `v1 is not a time
+v1.createdAt -> "red"
+v2.createdAt -> "[2017-03-03 00:00:00 +0000 UTC, 2017-03-04 00:00:00 +0000 UTC]"`, trace)
+}
+
+func TestNumberBetween(t *testing.T) {
+	tests := []struct {
+		name     string
+		v1       interface{}
+		r        NumberRange
+		expected bool
+	}{
+		{name: "inside", v1: 3, r: NumberBetween(1, 5), expected: true},
+		{name: "lower bound inclusive", v1: 1, r: NumberBetween(1, 5), expected: true},
+		{name: "upper bound inclusive", v1: 5, r: NumberBetween(1, 5), expected: true},
+		{name: "below", v1: 0.99, r: NumberBetween(1, 5)},
+		{name: "above", v1: 5.01, r: NumberBetween(1, 5)},
+		{name: "exclusive inside", v1: 3, r: NumberBetweenExclusive(1, 5), expected: true},
+		{name: "lower bound exclusive", v1: 1, r: NumberBetweenExclusive(1, 5)},
+		{name: "upper bound exclusive", v1: 5, r: NumberBetweenExclusive(1, 5)},
+		{name: "half open lower", v1: 1, r: NumberRange{Lo: 1, Hi: 5, ExcludeHi: true}, expected: true},
+		{name: "half open upper", v1: 5, r: NumberRange{Lo: 1, Hi: 5, ExcludeHi: true}},
+		{name: "negative", v1: -2, r: NumberBetween(-5, 0), expected: true},
+		{name: "uint", v1: uint64(3), r: NumberBetween(1, 5), expected: true},
+		{name: "string", v1: "3", r: NumberBetween(1, 5)},
+		{name: "nil", v1: nil, r: NumberBetween(1, 5)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, Contains(test.v1, test.r))
+			assert.Equal(t, test.expected, Contains(dict{"size": test.v1}, dict{"size": test.r}))
+			assert.Equal(t, test.expected, Equivalent(dict{"size": test.v1}, dict{"size": test.r}))
+		})
+	}
+
+	// matchers can be used for slice elements too
+	assert.True(t, Contains([]interface{}{1, 10}, []interface{}{NumberBetween(9, 11)}))
+	assert.False(t, Equivalent([]interface{}{1, 10}, []interface{}{NumberBetween(9, 11)}))
+	assert.True(t, Equivalent([]interface{}{1, 10}, []interface{}{NumberBetween(9, 11), NumberBetween(0, 2)}))
+
+	assert.Equal(t, "[1, 5]", NumberBetween(1, 5).String())
+	assert.Equal(t, "(1, 5)", NumberBetweenExclusive(1, 5).String())
+	assert.Equal(t, "(1.5, 5]", NumberRange{Lo: 1.5, Hi: 5, ExcludeLo: true}.String())
+
+	var trace string
+	Contains(dict{"size": 5}, dict{"size": NumberBetweenExclusive(1, 5)}, Trace(&trace))
+	assert.Equal(t, `v1 is not in (1, 5)
+v1.size -> 5
+v2.size -> "(1, 5)"`, trace)
+
+	Contains(dict{"size": "red"}, dict{"size": NumberBetween(1, 5)}, Trace(&trace))
+	assert.Equal(t, `v1 is not a number
+v1.size -> "red"
+v2.size -> "[1, 5]"`, trace)
+}
@@ -0,0 +1,168 @@
+package maps
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ansel1/merry"
+)
+
+// OrderedMap is a map which remembers the order keys were added in.  It marshals to
+// a JSON object with the keys in that order, and unmarshaling a JSON object into an
+// OrderedMap keeps the order of the keys in the document, so config files can be
+// decoded, modified, and encoded again without reordering them.
+//
+// Nested objects are unmarshaled as *OrderedMap values, so their order is kept too.
+// Numbers are unmarshaled as json.Number values.  The zero value is an empty map,
+// ready to use.
+//
+// Normalize converts an OrderedMap to a map[string]interface{}, like any other
+// json.Marshaler, unless the PreserveOrder option is set.  With PreserveOrder, Normalize
+// keeps *OrderedMap values, and Merge adds new keys after the existing ones.
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewOrderedMap returns an empty OrderedMap.
+func NewOrderedMap() *OrderedMap {
+	return &OrderedMap{}
+}
+
+// Get returns the value of key, and whether key was present.
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Set sets the value of key.  New keys are added after the existing keys.  Setting an
+// existing key keeps its position.
+func (m *OrderedMap) Set(key string, value interface{}) {
+	if m.values == nil {
+		m.values = map[string]interface{}{}
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Delete removes key.
+func (m *OrderedMap) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Keys returns the keys, in order.  The result must not be modified.
+func (m *OrderedMap) Keys() []string {
+	return m.keys
+}
+
+// Len returns the number of keys.
+func (m *OrderedMap) Len() int {
+	return len(m.keys)
+}
+
+// MarshalJSON implements json.Marshaler.  The keys are written in order.
+func (m OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte(':')
+		b, err = json.Marshal(m.values[key])
+		if err != nil {
+			return nil, merry.Prependf(err, "error marshaling %v", key)
+		}
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.  The keys are added in the order they
+// appear in the document, replacing the current contents of m.
+func (m *OrderedMap) UnmarshalJSON(b []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// numbers are written back exactly as they were read
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if tok != json.Delim('{') {
+		return merry.Errorf("expected JSON object, got %v", tok)
+	}
+	*m = OrderedMap{}
+	return m.decode(dec)
+}
+
+// asOrderedMap returns v as an *OrderedMap, if it's an OrderedMap, or a non-nil *OrderedMap.
+func asOrderedMap(v interface{}) (*OrderedMap, bool) {
+	switch t := v.(type) {
+	case *OrderedMap:
+		return t, t != nil
+	case OrderedMap:
+		return &t, true
+	}
+	return nil, false
+}
+
+// decode reads the keys and values of an object, after its opening brace.
+func (m *OrderedMap) decode(dec *json.Decoder) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		key := tok.(string)
+		v, err := decodeOrdered(dec)
+		if err != nil {
+			return merry.Prependf(err, "error decoding %v", key)
+		}
+		m.Set(key, v)
+	}
+	// closing brace
+	_, err := dec.Token()
+	return merry.Wrap(err)
+}
+
+// decodeOrdered reads the next value, decoding objects as *OrderedMap.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	switch tok {
+	case json.Delim('{'):
+		m := &OrderedMap{}
+		return m, m.decode(dec)
+	case json.Delim('['):
+		s := []interface{}{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, v)
+		}
+		// closing bracket
+		_, err := dec.Token()
+		return s, merry.Wrap(err)
+	}
+	return tok, nil
+}
@@ -0,0 +1,170 @@
+package maps
+
+import (
+	"encoding/json"
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap()
+	m.Set("zebra", 1)
+	m.Set("apple", "red")
+	m.Set("mango", true)
+	m.Set("zebra", 2)
+	assert.Equal(t, []string{"zebra", "apple", "mango"}, m.Keys())
+	assert.Equal(t, 3, m.Len())
+
+	v, ok := m.Get("zebra")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	_, ok = m.Get("pear")
+	assert.False(t, ok)
+
+	m.Delete("apple")
+	m.Delete("pear")
+	assert.Equal(t, []string{"zebra", "mango"}, m.Keys())
+
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	assert.Equal(t, `{"zebra":2,"mango":true}`, string(b))
+
+	var zero OrderedMap
+	b, err = json.Marshal(zero)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(b))
+}
+
+func TestOrderedMap_roundTrip(t *testing.T) {
+	docs := []string{
+		`{}`,
+		`{"b":1,"a":2}`,
+		`{"id":12345678901234567890,"name":"web","env":{"PORT":"80","HOST":"x","DEBUG":null},"args":["-v",{"z":1,"y":[]}],"on":false}`,
+	}
+	for _, doc := range docs {
+		t.Run(doc, func(t *testing.T) {
+			var m OrderedMap
+			require.NoError(t, json.Unmarshal([]byte(doc), &m))
+			b, err := json.Marshal(m)
+			require.NoError(t, err)
+			assert.Equal(t, doc, string(b))
+		})
+	}
+
+	var m OrderedMap
+	require.NoError(t, json.Unmarshal([]byte(docs[2]), &m))
+	env, _ := m.Get("env")
+	assert.Equal(t, []string{"PORT", "HOST", "DEBUG"}, env.(*OrderedMap).Keys())
+
+	// adding keys appends them
+	m.Set("added", 1.5)
+	b, err := json.Marshal(&m)
+	require.NoError(t, err)
+	assert.Equal(t, docs[2][:len(docs[2])-1]+`,"added":1.5}`, string(b))
+
+	// unmarshaling replaces the contents
+	require.NoError(t, json.Unmarshal([]byte(docs[1]), &m))
+	assert.Equal(t, []string{"b", "a"}, m.Keys())
+
+	assert.Error(t, json.Unmarshal([]byte(`[1]`), &m))
+
+	// normalized like other json.Marshalers
+	n, err := Normalize(m)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"b": 1.0, "a": 2.0}, n)
+	assert.True(t, Contains(&m, dict{"a": 2}))
+}
+
+func TestPreserveOrder(t *testing.T) {
+	doc := `{"name":"web","env":{"PORT":"80","HOST":"x","DEBUG":null},"args":["-v",{"z":1,"y":[]}],"on":false,"id":12345678901234567890}`
+	var m OrderedMap
+	require.NoError(t, json.Unmarshal([]byte(doc), &m))
+
+	for _, v := range []interface{}{m, &m} {
+		n, err := Normalize(v, PreserveOrder(true), NumbersAsJSONNumber(true))
+		require.NoError(t, err)
+		require.IsType(t, &OrderedMap{}, n)
+		b, err := json.Marshal(n)
+		require.NoError(t, err)
+		assert.Equal(t, doc, string(b))
+	}
+
+	// numbers are normalized like any other value
+	n, err := Normalize(&m, PreserveOrder(true))
+	require.NoError(t, err)
+	args, _ := n.(*OrderedMap).Get("args")
+	z, _ := args.([]interface{})[1].(*OrderedMap).Get("z")
+	assert.Equal(t, 1.0, z)
+
+	// the result is a copy
+	n.(*OrderedMap).Set("added", true)
+	assert.Equal(t, 5, m.Len())
+
+	// decoding keeps the order too
+	n, err = NormalizeReader(strings.NewReader(doc), PreserveOrder(true), NumbersAsJSONNumber(true))
+	require.NoError(t, err)
+	b, err := json.Marshal(n)
+	require.NoError(t, err)
+	assert.Equal(t, doc, string(b))
+
+	n, err = NormalizeReader(strings.NewReader(""), PreserveOrder(true))
+	require.NoError(t, err)
+	assert.Nil(t, n)
+
+	// marshaled values keep the order of the JSON, so struct fields keep their order
+	type config struct {
+		Zebra string            `json:"zebra"`
+		Apple map[string]string `json:"apple"`
+		Mango int               `json:"mango"`
+	}
+	n, err = Normalize(config{Zebra: "z", Apple: map[string]string{"b": "1", "a": "2"}, Mango: 3}, PreserveOrder(true))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zebra", "apple", "mango"}, n.(*OrderedMap).Keys())
+	mango, _ := n.(*OrderedMap).Get("mango")
+	assert.Equal(t, 3.0, mango)
+
+	// plain maps don't have an order
+	n, err = Normalize(dict{"b": 1, "a": 2}, PreserveOrder(true))
+	require.NoError(t, err)
+	assert.Equal(t, dict{"b": 1.0, "a": 2.0}, n)
+
+	// cycles are still detected
+	cyclic := NewOrderedMap()
+	cyclic.Set("self", cyclic)
+	_, err = Normalize(cyclic, PreserveOrder(true))
+	assert.True(t, merry.Is(err, CycleDetectedError), "got %v", err)
+}
+
+func TestPreserveOrder_merge(t *testing.T) {
+	var m1, m2 OrderedMap
+	require.NoError(t, json.Unmarshal([]byte(`{"b":1,"a":{"y":1,"x":2},"tags":["a"]}`), &m1))
+	require.NoError(t, json.Unmarshal([]byte(`{"c":3,"a":{"z":1,"x":5},"tags":["b","a"],"d":4}`), &m2))
+
+	merged, err := MergeWithError(&m1, &m2, PreserveOrder(true))
+	require.NoError(t, err)
+	b, err := json.Marshal(merged)
+	require.NoError(t, err)
+	// existing keys keep their position, and new keys are added in m2's order
+	assert.Equal(t, `{"b":1,"a":{"y":1,"x":5,"z":1},"tags":["a","b"],"c":3,"d":4}`, string(b))
+
+	// m1 and m2 aren't modified
+	b, err = json.Marshal(m1)
+	require.NoError(t, err)
+	assert.Equal(t, `{"b":1,"a":{"y":1,"x":2},"tags":["a"]}`, string(b))
+
+	// keys from plain maps are added in sorted order, so the result is stable
+	for i := 0; i < 10; i++ {
+		merged = Merge(&m1, dict{"f": 1, "e": 2, "b": 3}, PreserveOrder(true))
+		b, err = json.Marshal(merged)
+		require.NoError(t, err)
+		assert.Equal(t, `{"b":3,"a":{"y":1,"x":2},"tags":["a"],"e":2,"f":1}`, string(b))
+	}
+	merged = Merge(dict{"f": 1, "e": 2}, &m2, PreserveOrder(true))
+	assert.Equal(t, []string{"e", "f", "c", "a", "tags", "d"}, merged.(*OrderedMap).Keys())
+
+	// without the option, the order is lost
+	assert.IsType(t, dict{}, Merge(&m1, &m2))
+}
@@ -0,0 +1,267 @@
+package maps
+
+import (
+	"github.com/ansel1/merry"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// InvalidPatchError indicates a JSON Patch operation was malformed, or one of its
+// paths couldn't be resolved.  If the path couldn't be resolved, the cause is one of
+// the errors returned by Get, like PathNotFoundError.
+var InvalidPatchError = merry.New("Invalid patch")
+
+// PatchTestFailedError indicates a "test" operation in a JSON Patch failed.
+var PatchTestFailedError = merry.New("Patch test failed")
+
+// ApplyPatch applies a JSON Patch (RFC 6902) to the normalized value of doc, and
+// returns the result.  patch is a list of operations, like:
+//
+//	[
+//	  {"op": "add", "path": "/resource/tags/-", "value": "red"},
+//	  {"op": "remove", "path": "/resource/owner"},
+//	  {"op": "test", "path": "/resource/name", "value": "bob"}
+//	]
+//
+// All the operations are supported: add, remove, replace, move, copy, and test.  Paths are
+// JSON Pointers (RFC 6901), so "~1" and "~0" stand for "/" and "~" in keys.  Operations
+// are normalized, so they can also be structs.
+//
+// If an operation is malformed, or its path can't be resolved, InvalidPatchError is
+// returned.  If a test operation fails, PatchTestFailedError is returned.  Test compares
+// values exactly, so slices must be in the same order.  If any operation fails, no result
+// is returned.  doc is not modified.
+func ApplyPatch(doc interface{}, patch []interface{}) (interface{}, error) {
+	doc, err := Normalize(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range patch {
+		op, err := Normalize(op)
+		if err != nil {
+			return nil, merry.Prependf(err, "patch operation %d", i)
+		}
+		m, ok := op.(map[string]interface{})
+		if !ok {
+			return nil, InvalidPatchError.Here().WithMessagef("patch operation %d is not an object", i)
+		}
+		doc, err = applyPatchOp(doc, m)
+		if err != nil {
+			return nil, merry.Prependf(err, "patch operation %d", i)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op map[string]interface{}) (interface{}, error) {
+	opName, _ := op["op"].(string)
+	ptr, ok := op["path"].(string)
+	if !ok {
+		return nil, InvalidPatchError.Here().WithMessage("path is missing")
+	}
+	value, hasValue := op["value"]
+	switch opName {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, InvalidPatchError.Here().WithMessagef("%v operation is missing a value", opName)
+		}
+	case "move", "copy":
+		from, ok := op["from"].(string)
+		if !ok {
+			return nil, InvalidPatchError.Here().WithMessagef("%v operation is missing from", opName)
+		}
+		fromPath, err := resolvePointer(doc, from, false)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getPointer(doc, from, fromPath); err != nil {
+			return nil, err
+		}
+		if opName == "copy" {
+			// the copy mustn't share any maps or slices with the original
+			value, _ = Normalize(value)
+			break
+		}
+		if ptr != from && strings.HasPrefix(ptr, from+"/") {
+			return nil, InvalidPatchError.Here().WithMessagef("can't move %v into its own child %v", from, ptr)
+		}
+		if len(fromPath) == 0 {
+			// moving the root to the root
+			return doc, nil
+		}
+		if doc, err = deletePath(doc, fromPath, 0); err != nil {
+			return nil, err
+		}
+		opName = "add"
+	case "remove":
+	default:
+		return nil, InvalidPatchError.Here().WithMessagef("invalid op: %v", op["op"])
+	}
+
+	path, err := resolvePointer(doc, ptr, opName == "add" || opName == "copy")
+	if err != nil {
+		return nil, err
+	}
+
+	switch opName {
+	case "add", "copy":
+		return addPatchValue(doc, path, value)
+	case "remove":
+		if len(path) == 0 {
+			return nil, InvalidPatchError.Here().WithMessage("can't remove the root")
+		}
+		if _, err := getPointer(doc, ptr, path); err != nil {
+			return nil, err
+		}
+		return deletePath(doc, path, 0)
+	case "replace":
+		if _, err := getPointer(doc, ptr, path); err != nil {
+			return nil, err
+		}
+		return setPath(doc, path, 0, value)
+	default: // test
+		actual, err := getPointer(doc, ptr, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return nil, PatchTestFailedError.Here().WithMessagef("test failed at %v: expected %v, was %v", ptr, value, actual)
+		}
+		return doc, nil
+	}
+}
+
+// addPatchValue implements the add operation.  Unlike Set, adding to a slice index
+// inserts the value before the existing element.
+func addPatchValue(doc interface{}, path Path, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	idx, ok := path[len(path)-1].(int)
+	if !ok {
+		// map keys are set, EachElement appends
+		return setPath(doc, path, 0, value)
+	}
+	parentPath := path[:len(path)-1]
+	parent, err := get(doc, parentPath, 0, &GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s := parent.([]interface{})
+	if idx > len(s) {
+		return nil, InvalidPatchError.Here().WithCause(IndexOutOfBoundsError).WithMessagef("Index out of bounds at %v (len = %v)", path, len(s))
+	}
+	s = append(s, nil)
+	copy(s[idx+1:], s[idx:])
+	s[idx] = value
+	return setPath(doc, parentPath, 0, s)
+}
+
+// getPointer gets the value at the resolved path.
+func getPointer(doc interface{}, ptr string, path Path) (interface{}, error) {
+	v, err := get(doc, path, 0, &GetOptions{})
+	if err != nil {
+		return nil, InvalidPatchError.Here().WithCause(err).WithMessagef("invalid path %v: %v", ptr, err)
+	}
+	return v, nil
+}
+
+// resolvePointer converts a JSON Pointer into a Path, by resolving it against doc.  The
+// containers along the path determine whether each token is a map key or a slice index.
+// If forAdd is true, the last token may be "-", which is converted to EachElement (i.e.
+// append).  Except for the parent of the last token, resolvePointer checks the path exists.
+func resolvePointer(doc interface{}, ptr string, forAdd bool) (Path, error) {
+	if ptr == "" {
+		return Path{}, nil
+	}
+	if ptr[0] != '/' {
+		return nil, InvalidPatchError.Here().WithMessagef("invalid path %v: must start with /", ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	path := make(Path, 0, len(tokens))
+	cur := doc
+	for i, token := range tokens {
+		token = jsonPointerUnescaper.Replace(token)
+		last := i == len(tokens)-1
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			path = append(path, token)
+			if !last {
+				var present bool
+				if cur, present = c[token]; !present {
+					return nil, InvalidPatchError.Here().WithCause(PathNotFoundError).WithMessagef("invalid path %v: %v not found", ptr, path)
+				}
+			}
+		case []interface{}:
+			if token == "-" && last && forAdd {
+				path = append(path, EachElement{})
+				break
+			}
+			idx, err := strconv.Atoi(token)
+			if err != nil || token[0] < '0' || token[0] > '9' || (len(token) > 1 && token[0] == '0') {
+				return nil, InvalidPatchError.Here().WithMessagef("invalid path %v: %q is not a slice index", ptr, token)
+			}
+			path = append(path, idx)
+			if !last {
+				if idx >= len(c) {
+					return nil, InvalidPatchError.Here().WithCause(IndexOutOfBoundsError).WithMessagef("invalid path %v: Index out of bounds at %v (len = %v)", ptr, path, len(c))
+				}
+				cur = c[idx]
+			}
+		default:
+			return nil, InvalidPatchError.Here().WithCause(PathNotMapError).WithMessagef("invalid path %v: %v is not a map or slice", ptr, path)
+		}
+	}
+	return path, nil
+}
+
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to target, and returns the
+// result.  Both values are normalized first.  target and patch are not modified.
+//
+// Merge patches are different from Merge:
+//
+//   - A nil value in the patch deletes the key from target, rather than setting it to nil.
+//   - Slices in the patch replace slices in target, rather than being merged with them.
+//   - If the patch isn't a map, it replaces target entirely.
+//
+// For example:
+//
+//	Merge({"a":[1,2],"b":1}, {"a":[2,3],"b":null})      // {"a":[1,2,3],"b":null}
+//	MergePatch({"a":[1,2],"b":1}, {"a":[2,3],"b":null}) // {"a":[2,3]}
+//
+// If either value can't be normalized, MergePatch returns nil.
+func MergePatch(target, patch interface{}) interface{} {
+	target, err := Normalize(target)
+	if err != nil {
+		return nil
+	}
+	patch, err = Normalize(patch)
+	if err != nil {
+		return nil
+	}
+	return mergePatch(target, patch)
+}
+
+// mergePatch merges the normalized patch into target.  target may be modified
+// in place.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+		} else {
+			t[key] = mergePatch(t[key], value)
+		}
+	}
+	return t
+}
@@ -0,0 +1,155 @@
+package maps
+
+import (
+	"encoding/json"
+	"github.com/ansel1/merry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	// mostly from the examples in RFC 6902, appendix A
+	tests := []struct {
+		name            string
+		doc, patch, out string
+	}{
+		{"add key", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"add to end", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux"]}`},
+		{"append", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"add replaces", `{"foo":"bar"}`, `[{"op":"add","path":"/foo","value":1}]`, `{"foo":1}`},
+		{"add nested", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"add root", `{"foo":"bar"}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"remove key", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"replace element", `{"foo":[1,2]}`, `[{"op":"replace","path":"/foo/0","value":3}]`, `{"foo":[3,2]}`},
+		{
+			"move key",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"foo":{"bar":[1]}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"add","path":"/baz/bar/-","value":2}]`, `{"foo":{"bar":[1]},"baz":{"bar":[1,2]}}`},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"escaping", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"replace","path":"/~1","value":1}]`, `{"/":1,"~1":10}`},
+		{"numeric keys", `{"0":"a"}`, `[{"op":"add","path":"/1","value":"b"}]`, `{"0":"a","1":"b"}`},
+		{"several", `{}`, `[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1},{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1]}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var doc, patch, expected interface{}
+			require.NoError(t, json.Unmarshal([]byte(test.doc), &doc))
+			require.NoError(t, json.Unmarshal([]byte(test.patch), &patch))
+			require.NoError(t, json.Unmarshal([]byte(test.out), &expected))
+
+			orig, err := Normalize(doc)
+			require.NoError(t, err)
+
+			out, err := ApplyPatch(doc, patch.([]interface{}))
+			require.NoError(t, err)
+			assert.Equal(t, expected, out)
+			assert.Equal(t, orig, doc, "doc should not be modified")
+		})
+	}
+
+	t.Run("structs", func(t *testing.T) {
+		type op struct {
+			Op    string      `json:"op"`
+			Path  string      `json:"path"`
+			Value interface{} `json:"value,omitempty"`
+		}
+		out, err := ApplyPatch(dict{"a": 1}, []interface{}{op{Op: "add", Path: "/b", Value: 2}})
+		require.NoError(t, err)
+		assert.Equal(t, dict{"a": 1.0, "b": 2.0}, out)
+	})
+
+	errorTests := []struct {
+		name, doc, patch string
+		kinds            []error
+	}{
+		{"test failed", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, []error{PatchTestFailedError}},
+		{"test slice order", `{"a":[1,2]}`, `[{"op":"test","path":"/a","value":[2,1]}]`, []error{PatchTestFailedError}},
+		{"missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, []error{InvalidPatchError, PathNotFoundError}},
+		{"remove missing", `{"foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, []error{InvalidPatchError, PathNotFoundError}},
+		{"replace missing", `{"foo":"bar"}`, `[{"op":"replace","path":"/baz","value":1}]`, []error{InvalidPatchError, PathNotFoundError}},
+		{"index out of bounds", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":1}]`, []error{InvalidPatchError, IndexOutOfBoundsError}},
+		{"remove out of bounds", `{"foo":[1]}`, `[{"op":"remove","path":"/foo/1"}]`, []error{InvalidPatchError, IndexOutOfBoundsError}},
+		{"bad index", `{"foo":[1]}`, `[{"op":"add","path":"/foo/01","value":1}]`, []error{InvalidPatchError}},
+		{"dash outside add", `{"foo":[1]}`, `[{"op":"replace","path":"/foo/-","value":1}]`, []error{InvalidPatchError}},
+		{"not a container", `{"foo":1}`, `[{"op":"add","path":"/foo/bar","value":1}]`, []error{InvalidPatchError, PathNotMapError}},
+		{"bad pointer", `{"foo":1}`, `[{"op":"add","path":"foo","value":1}]`, []error{InvalidPatchError}},
+		{"missing value", `{"foo":1}`, `[{"op":"add","path":"/foo"}]`, []error{InvalidPatchError}},
+		{"missing from", `{"foo":1}`, `[{"op":"move","path":"/foo"}]`, []error{InvalidPatchError}},
+		{"move into child", `{"foo":{}}`, `[{"op":"move","from":"/foo","path":"/foo/bar"}]`, []error{InvalidPatchError}},
+		{"bad op", `{"foo":1}`, `[{"op":"frob","path":"/foo"}]`, []error{InvalidPatchError}},
+		{"not an object", `{"foo":1}`, `["add"]`, []error{InvalidPatchError}},
+		{"remove root", `{"foo":1}`, `[{"op":"remove","path":""}]`, []error{InvalidPatchError}},
+	}
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			var doc, patch interface{}
+			require.NoError(t, json.Unmarshal([]byte(test.doc), &doc))
+			require.NoError(t, json.Unmarshal([]byte(test.patch), &patch))
+
+			out, err := ApplyPatch(doc, patch.([]interface{}))
+			assert.Nil(t, out)
+			require.Error(t, err)
+			for _, kind := range test.kinds {
+				assert.True(t, merry.Is(err, kind), "expected %v, got %v", kind, err)
+			}
+		})
+	}
+
+	_, err := ApplyPatch(dict{"a": 1}, []interface{}{dict{"op": "test", "path": "/a", "value": 2}})
+	assert.EqualError(t, err, "patch operation 0: test failed at /a: expected 2, was 1")
+}
+
+func TestMergePatch(t *testing.T) {
+	// from RFC 7386, appendix A
+	tests := []struct {
+		target, patch, out string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.target+" "+test.patch, func(t *testing.T) {
+			var target, patch, expected interface{}
+			require.NoError(t, json.Unmarshal([]byte(test.target), &target))
+			require.NoError(t, json.Unmarshal([]byte(test.patch), &patch))
+			require.NoError(t, json.Unmarshal([]byte(test.out), &expected))
+
+			origTarget, _ := Normalize(target)
+			origPatch, _ := Normalize(patch)
+			assert.Equal(t, expected, MergePatch(target, patch))
+			assert.Equal(t, origTarget, target, "target should not be modified")
+			assert.Equal(t, origPatch, patch, "patch should not be modified")
+		})
+	}
+
+	t.Run("compared to merge", func(t *testing.T) {
+		target := dict{"tags": []int{1, 2}, "owner": "bob", "size": 1}
+		patch := dict{"tags": []int{2, 3}, "owner": nil}
+
+		assert.Equal(t, dict{"tags": []interface{}{1.0, 2.0, 3.0}, "owner": nil, "size": 1.0}, Merge(target, patch))
+		assert.Equal(t, dict{"tags": []interface{}{2.0, 3.0}, "size": 1.0}, MergePatch(target, patch))
+	})
+
+	assert.Nil(t, MergePatch(dict{"a": make(chan int)}, dict{}))
+}
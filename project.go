@@ -0,0 +1,236 @@
+package maps
+
+import (
+	"github.com/ansel1/merry"
+)
+
+// Project returns a new value, containing only the values at the given paths in the
+// normalized value of v, with the same nesting.  It's like a whitelist:
+//
+//	v := {"resource":{"id":1,"name":"a","tags":[{"color":"red","size":1}]},"owner":"bob"}
+//	Project(v, "resource.id", "resource.tags[*].color")
+//	// {"resource":{"id":1,"tags":[{"color":"red"}]}}
+//
+// Paths are parsed with ParsePath.  Wildcards, like "*" and "[*]", select every key or element.
+// Selecting a slice index keeps the element, but not its position: elements which aren't
+// selected are removed, and the others keep their order.  Paths which don't exist in v are
+// ignored.  If none of the paths exist, Project returns nil.  RecursiveDescent isn't supported.
+//
+// The result is a copy.  v is not modified.
+func Project(v interface{}, paths ...string) (interface{}, error) {
+	root, err := newProjection(paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	v, err = Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok, _ := project(v, []*projection{root}, nil); ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// Omit returns a copy of the normalized value of v, with the values at the given paths
+// removed.  It's the opposite of Project, like a blacklist:
+//
+//	Omit(v, "principal.acct", "resource.tags[0]", "resource.tags[*].secret")
+//
+// Paths are parsed with ParsePath, and may contain wildcards, like "*" and "[*]".  Map keys are
+// deleted, and slice elements are removed, shifting the remaining elements down.  All the
+// paths refer to the original value, so Omit(v, "tags[0]", "tags[1]") removes the first two
+// elements of tags.  Paths which don't exist in v are ignored.  The empty path removes v itself,
+// so Omit returns nil.  RecursiveDescent isn't supported; use DeleteAll.
+//
+// The result is a copy.  v is not modified.
+func Omit(v interface{}, paths ...string) (interface{}, error) {
+	root, err := newProjection(paths)
+	if err != nil {
+		return nil, err
+	}
+	v, err = Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	if root.all {
+		return nil, nil
+	}
+	return omit(v, []*projection{root}), nil
+}
+
+func newProjection(paths []string) (*projection, error) {
+	root := &projection{}
+	for _, p := range paths {
+		path, err := ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := root.add(path); err != nil {
+			return nil, merry.Prependf(err, "invalid path %q", p)
+		}
+	}
+	return root, nil
+}
+
+// projection is a tree of the paths selected by Project, or removed by Omit.
+type projection struct {
+	all      bool // the whole value is selected
+	keys     map[string]*projection
+	indexes  map[int]*projection
+	wildcard *projection // applies to every key or element
+}
+
+func (p *projection) add(path Path) error {
+	for _, elem := range path {
+		switch t := elem.(type) {
+		case string:
+			if p.keys == nil {
+				p.keys = map[string]*projection{}
+			}
+			if p.keys[t] == nil {
+				p.keys[t] = &projection{}
+			}
+			p = p.keys[t]
+		case int:
+			if p.indexes == nil {
+				p.indexes = map[int]*projection{}
+			}
+			if p.indexes[t] == nil {
+				p.indexes[t] = &projection{}
+			}
+			p = p.indexes[t]
+		case Wildcard, EachElement:
+			if p.wildcard == nil {
+				p.wildcard = &projection{}
+			}
+			p = p.wildcard
+		default:
+			return merry.Errorf("%v isn't supported", Path{elem})
+		}
+	}
+	p.all = true
+	return nil
+}
+
+// keyChildren returns the projections which apply to key.
+func keyChildren(ps []*projection, key string) []*projection {
+	var children []*projection
+	for _, p := range ps {
+		if child := p.keys[key]; child != nil {
+			children = append(children, child)
+		}
+		if p.wildcard != nil {
+			children = append(children, p.wildcard)
+		}
+	}
+	return children
+}
+
+// indexChildren returns the projections which apply to element i of a slice of length l.
+func indexChildren(ps []*projection, i, l int) []*projection {
+	var children []*projection
+	for _, p := range ps {
+		for idx, child := range p.indexes {
+			if idx, ok := sliceIndex(idx, l); ok && idx == i {
+				children = append(children, child)
+			}
+		}
+		if p.wildcard != nil {
+			children = append(children, p.wildcard)
+		}
+	}
+	return children
+}
+
+func anyAll(ps []*projection) bool {
+	for _, p := range ps {
+		if p.all {
+			return true
+		}
+	}
+	return false
+}
+
+// omit removes the values selected by the projections from the normalized value v,
+// in place.
+func omit(v interface{}, ps []*projection) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			switch children := keyChildren(ps, key); {
+			case anyAll(children):
+				delete(t, key)
+			case len(children) > 0:
+				t[key] = omit(value, children)
+			}
+		}
+	case []interface{}:
+		s := t[:0]
+		for i, value := range t {
+			switch children := indexChildren(ps, i, len(t)); {
+			case anyAll(children):
+				continue
+			case len(children) > 0:
+				value = omit(value, children)
+			}
+			s = append(s, value)
+		}
+		for i := len(s); i < len(t); i++ {
+			t[i] = nil
+		}
+		return s
+	}
+	return v
+}
+
+// project applies all the projections to v.  ok is false if none of the projections
+// selected anything in v.  If opts is not nil, v is normalized with opts as the
+// projections are applied, and matchers are treated as leaves.
+func project(v interface{}, ps []*projection, opts *NormalizeOptions) (_ interface{}, ok bool, err error) {
+	if anyAll(ps) {
+		return v, true, nil
+	}
+	if opts != nil {
+		if _, isMatcher := v.(matcher); isMatcher {
+			return nil, false, nil
+		}
+		if v, err = normalize(v, opts); err != nil {
+			return nil, false, err
+		}
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range t {
+			if children := keyChildren(ps, key); len(children) > 0 {
+				value, ok, err := project(value, children, opts)
+				if err != nil {
+					return nil, false, err
+				}
+				if ok {
+					m[key] = value
+				}
+			}
+		}
+		return m, len(m) > 0, nil
+	case []interface{}:
+		var s []interface{}
+		for i, value := range t {
+			if children := indexChildren(ps, i, len(t)); len(children) > 0 {
+				value, ok, err := project(value, children, opts)
+				if err != nil {
+					return nil, false, err
+				}
+				if ok {
+					s = append(s, value)
+				}
+			}
+		}
+		return s, len(s) > 0, nil
+	}
+	return nil, false, nil
+}
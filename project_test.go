@@ -0,0 +1,184 @@
+package maps
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	v := json.RawMessage(largeTestVal1)
+	tests := []struct {
+		name     string
+		paths    []string
+		expected interface{}
+	}{
+		{
+			name:  "several paths",
+			paths: []string{"resource.id", "resource.meta.service_name", "principal.sub", "principal.cust.groups"},
+			expected: dict{
+				"resource": dict{
+					"id":   "142514aecaff4329876579935829a052fcaf7753343843df833b2bfae72f2b36",
+					"meta": dict{"service_name": "connectionmgmt"},
+				},
+				"principal": dict{
+					"sub":  "bob",
+					"cust": dict{"groups": []interface{}{"CCKM Users"}},
+				},
+			},
+		},
+		{
+			name:  "missing paths are omitted",
+			paths: []string{"resource.state", "resource.nope", "nope.nope", "principal.sub.nope"},
+			expected: dict{
+				"resource": dict{"state": "Active"},
+			},
+		},
+		{
+			name:     "nothing found",
+			paths:    []string{"nope"},
+			expected: nil,
+		},
+		{
+			name:  "wildcards",
+			paths: []string{"*.meta.service_name", "environment.obligations.*.details"},
+			expected: dict{
+				"resource":    dict{"meta": dict{"service_name": "connectionmgmt"}},
+				"environment": dict{"meta": dict{"service_name": "connectionmgmt"}, "obligations": dict{"blue": dict{"details": dict{"color": "blue"}}}},
+			},
+		},
+		{
+			name:  "overlapping paths",
+			paths: []string{"resource.meta", "resource.meta.description"},
+			expected: dict{
+				"resource": dict{"meta": dict{
+					"description":    "connection manager credential",
+					"service_name":   "connectionmgmt",
+					"resource_type":  "connections",
+					"connection_uri": "kylo:kylo:connectionmgmt:connections:gcp-connection2-fc9d0a07-cf98-4d97-bce6-99a8ef9baf81",
+				}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Project(v, test.paths...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, p)
+		})
+	}
+}
+
+func TestProject_slices(t *testing.T) {
+	v := dict{
+		"tags": []interface{}{
+			dict{"color": "red", "size": 1, "name": "a"},
+			dict{"color": "blue", "size": 2},
+			dict{"name": "c"},
+		},
+	}
+	p, err := Project(v, "tags[*].color", "tags[*].name")
+	require.NoError(t, err)
+	assert.Equal(t, dict{"tags": []interface{}{dict{"color": "red", "name": "a"}, dict{"color": "blue"}, dict{"name": "c"}}}, p)
+
+	p, err = Project(v, "tags[-1]", "tags[1].size", "tags[5]")
+	require.NoError(t, err)
+	assert.Equal(t, dict{"tags": []interface{}{dict{"size": 2.0}, dict{"name": "c"}}}, p)
+
+	// the result doesn't share anything with v
+	p, err = Project(v, "tags")
+	require.NoError(t, err)
+	p.(dict)["tags"].([]interface{})[0].(dict)["color"] = "green"
+	assert.Equal(t, "red", v["tags"].([]interface{})[0].(dict)["color"])
+
+	p, err = Project(v, "")
+	require.NoError(t, err)
+	assert.True(t, Equivalent(v, p))
+
+	p, err = Project(v)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	_, err = Project(v, "tags..color")
+	assert.EqualError(t, err, `invalid path "tags..color": .. isn't supported`)
+}
+
+func TestOmit(t *testing.T) {
+	v := dict{
+		"principal": dict{"acct": "secret", "sub": "bob"},
+		"tags":      []interface{}{"a", "b", "c", "d"},
+		"items": []interface{}{
+			dict{"id": 1, "secret": "x"},
+			dict{"id": 2, "secret": "y"},
+		},
+	}
+	tests := []struct {
+		name     string
+		paths    []string
+		expected interface{}
+	}{
+		{
+			name:  "nested",
+			paths: []string{"principal.acct"},
+			expected: dict{
+				"principal": dict{"sub": "bob"},
+				"tags":      []interface{}{"a", "b", "c", "d"},
+				"items":     []interface{}{dict{"id": 1.0, "secret": "x"}, dict{"id": 2.0, "secret": "y"}},
+			},
+		},
+		{
+			name:  "indexes refer to the original slice",
+			paths: []string{"tags[0]", "tags[1]", "tags[-1]", "items[1].secret"},
+			expected: dict{
+				"principal": dict{"acct": "secret", "sub": "bob"},
+				"tags":      []interface{}{"c"},
+				"items":     []interface{}{dict{"id": 1.0, "secret": "x"}, dict{"id": 2.0}},
+			},
+		},
+		{
+			name:  "wildcards",
+			paths: []string{"items[*].secret", "*.acct"},
+			expected: dict{
+				"principal": dict{"sub": "bob"},
+				"tags":      []interface{}{"a", "b", "c", "d"},
+				"items":     []interface{}{dict{"id": 1.0}, dict{"id": 2.0}},
+			},
+		},
+		{
+			name:  "missing paths",
+			paths: []string{"nope", "principal.nope", "tags[10]", "tags.nope", "principal.sub.nope"},
+			expected: dict{
+				"principal": dict{"acct": "secret", "sub": "bob"},
+				"tags":      []interface{}{"a", "b", "c", "d"},
+				"items":     []interface{}{dict{"id": 1.0, "secret": "x"}, dict{"id": 2.0, "secret": "y"}},
+			},
+		},
+		{
+			name:     "root",
+			paths:    []string{""},
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := Omit(v, test.paths...)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, o)
+
+			// v is not modified
+			assert.Equal(t, "secret", v["principal"].(dict)["acct"])
+			assert.Len(t, v["tags"], 4)
+			assert.Equal(t, "y", v["items"].([]interface{})[1].(dict)["secret"])
+		})
+	}
+
+	o, err := Omit(json.RawMessage(largeTestVal1), "principal.acct", "principal.sub_acct", "environment")
+	require.NoError(t, err)
+	assert.False(t, Has(o, "principal.acct"))
+	assert.False(t, Has(o, "environment"))
+	assert.True(t, Has(o, "principal.sub"))
+
+	_, err = Omit(v, "..secret")
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package maps
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ComparerFunc compares two values for Contains and Equivalent.  If handled is false, the
+// values are compared as usual, and matched is ignored.  If handled is true, matched is the
+// result of the comparison.
+//
+// v1 is the value from the containing side.  ComparerFuncs should be symmetric if they are
+// used with Equivalent.
+type ComparerFunc func(v1, v2 interface{}) (matched, handled bool)
+
+var (
+	comparersMu sync.Mutex
+	comparers   atomic.Value // map[reflect.Type]ComparerFunc
+)
+
+// RegisterComparer registers a ComparerFunc for all values of type t.  Contains and Equivalent
+// call the ComparerFunc whenever either of the values being compared is of type t.
+//
+// Registered comparers are consulted twice for each pair of values: first with the raw values,
+// before they are normalized, and again with the normalized values, if normalizing changed either
+// of their types.  The latter is useful for comparing normalized types, like time.Time values
+// when NormalizeTime or ParseTimes is used.  Registered comparers take precedence over
+// all built-in comparisons, including the built-in time comparison, so registering a comparer
+// for time.Time disables the TimeDelta, TruncateTimes, RoundTimes, and IgnoreTimeZone options.
+// ContainsOptions like IgnoreKeys and MatchEmptyValues don't apply inside values handled by a
+// comparer.  Matchers, like NumberRange, take precedence over registered comparers.
+//
+// Registering another comparer for the same type replaces the previous one.  Registering a nil
+// function removes it.
+//
+// RegisterComparer is safe to call concurrently with Contains, but since comparers are global, they
+// should normally be registered during program initialization, in an init() function.
+func RegisterComparer(t reflect.Type, fn ComparerFunc) {
+	comparersMu.Lock()
+	defer comparersMu.Unlock()
+
+	old, _ := comparers.Load().(map[reflect.Type]ComparerFunc)
+	m := make(map[reflect.Type]ComparerFunc, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	if fn == nil {
+		delete(m, t)
+	} else {
+		m[t] = fn
+	}
+	comparers.Store(m)
+}
+
+func hasComparers() bool {
+	m, _ := comparers.Load().(map[reflect.Type]ComparerFunc)
+	return len(m) > 0
+}
+
+// compareRegistered looks for a registered comparer for the type of v1, then v2.  Returns
+// handled=false if there is none.
+func compareRegistered(v1, v2 interface{}) (matched, handled bool) {
+	m, _ := comparers.Load().(map[reflect.Type]ComparerFunc)
+	if len(m) == 0 {
+		return false, false
+	}
+	if fn := m[reflect.TypeOf(v1)]; fn != nil {
+		if matched, handled = fn(v1, v2); handled {
+			return matched, handled
+		}
+	}
+	if fn := m[reflect.TypeOf(v2)]; fn != nil {
+		return fn(v1, v2)
+	}
+	return false, false
+}
+
+// NormalizerFunc converts a value into a form which can be normalized.  It returns the
+// replacement value, which is normalized in turn, so it should be a different type than v.
+type NormalizerFunc func(v interface{}) (interface{}, error)
+
+type normalizerRegistry struct {
+	byType  map[reflect.Type]NormalizerFunc
+	ordered []reflect.Type // in order of registration
+}
+
+var (
+	normalizersMu sync.Mutex
+	normalizers   atomic.Value // *normalizerRegistry
+)
+
+// RegisterNormalizer registers a NormalizerFunc for values of type t.  When normalizing a
+// value which isn't already a primitive, map[string]interface{}, or []interface{}, normalize
+// calls the NormalizerFunc, and normalizes the value it returns, instead of converting
+// the value with reflection or JSON marshaling.  For example, to normalize a decimal type
+// to a float, rather than the string it marshals to:
+//
+//	RegisterNormalizer(reflect.TypeOf(decimal.Decimal{}), func(v interface{}) (interface{}, error) {
+//	  f, _ := v.(decimal.Decimal).Float64()
+//	  return f, nil
+//	})
+//
+// A NormalizerFunc registered for t is used for values of exactly type t.  If none is
+// registered for the value's type, the first registered type the value is assignable to is
+// used, so a NormalizerFunc can be registered for an interface type, like fmt.Stringer.
+// Normalizers take precedence over json.Marshaler implementations.
+//
+// Registering another normalizer for the same type replaces the previous one.  Registering a
+// nil function removes it.
+//
+// RegisterNormalizer is safe to call concurrently with Normalize, but since normalizers are
+// global, they should normally be registered during program initialization, in an init() function.
+func RegisterNormalizer(t reflect.Type, fn NormalizerFunc) {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+
+	r := &normalizerRegistry{byType: map[reflect.Type]NormalizerFunc{}}
+	if old, _ := normalizers.Load().(*normalizerRegistry); old != nil {
+		for _, typ := range old.ordered {
+			if typ != t {
+				r.byType[typ] = old.byType[typ]
+				r.ordered = append(r.ordered, typ)
+			}
+		}
+	}
+	if fn != nil {
+		r.byType[t] = fn
+		r.ordered = append(r.ordered, t)
+	}
+	normalizers.Store(r)
+}
+
+// normalizeRegistered looks for a registered normalizer for the type of v.  Returns
+// handled=false if there is none.
+func normalizeRegistered(v interface{}) (v2 interface{}, handled bool, err error) {
+	r, _ := normalizers.Load().(*normalizerRegistry)
+	if r == nil || len(r.ordered) == 0 || v == nil {
+		return nil, false, nil
+	}
+	vt := reflect.TypeOf(v)
+	fn := r.byType[vt]
+	if fn == nil {
+		for _, t := range r.ordered {
+			if vt.AssignableTo(t) {
+				fn = r.byType[t]
+				break
+			}
+		}
+	}
+	if fn == nil {
+		return nil, false, nil
+	}
+	v2, err = fn(v)
+	return v2, true, err
+}
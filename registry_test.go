@@ -0,0 +1,133 @@
+package maps
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type semver string
+
+func compareSemver(v1, v2 interface{}) (bool, bool) {
+	s1, ok1 := v1.(semver)
+	s2, ok2 := v2.(semver)
+	if !ok1 || !ok2 {
+		return false, false
+	}
+	return strings.TrimPrefix(string(s1), "v") == strings.TrimPrefix(string(s2), "v"), true
+}
+
+func TestRegisterComparer(t *testing.T) {
+	RegisterComparer(reflect.TypeOf(semver("")), compareSemver)
+	t.Cleanup(func() { RegisterComparer(reflect.TypeOf(semver("")), nil) })
+
+	v1 := dict{"name": "bob", "version": semver("v1.2.0")}
+	assert.True(t, Contains(v1, dict{"version": semver("1.2.0")}))
+	assert.True(t, Equivalent(v1, dict{"name": "bob", "version": semver("1.2.0")}))
+
+	var trace string
+	assert.False(t, Contains(v1, dict{"version": semver("1.3.0")}, Trace(&trace)))
+	assert.Contains(t, trace, "values are not equal")
+
+	// not handled, so compared as usual
+	assert.True(t, Contains(v1, dict{"version": "v1.2.0"}))
+	assert.False(t, Contains(v1, dict{"version": "1.2.0"}))
+
+	// matchers take precedence
+	assert.True(t, Contains(dict{"version": semver("v1")}, dict{"version": IsString}))
+
+	RegisterComparer(reflect.TypeOf(semver("")), nil)
+	assert.False(t, Contains(v1, dict{"version": semver("1.2.0")}))
+}
+
+func TestRegisterComparer_normalizedType(t *testing.T) {
+	// registered comparers take precedence over the built-in time comparison
+	sameDay := func(v1, v2 interface{}) (bool, bool) {
+		t1, ok1 := v1.(time.Time)
+		t2, ok2 := v2.(time.Time)
+		if !ok1 || !ok2 {
+			return false, false
+		}
+		return t1.YearDay() == t2.YearDay() && t1.Year() == t2.Year(), true
+	}
+	RegisterComparer(reflect.TypeOf(time.Time{}), sameDay)
+	t.Cleanup(func() { RegisterComparer(reflect.TypeOf(time.Time{}), nil) })
+
+	tm := time.Date(2020, 3, 4, 10, 0, 0, 0, time.UTC)
+	v1 := dict{"created": tm.Format(time.RFC3339Nano)}
+	v2 := dict{"created": tm.Add(time.Hour).Format(time.RFC3339Nano)}
+	assert.False(t, Contains(v1, v2))
+	assert.True(t, Contains(v1, v2, ParseTimes()))
+	assert.False(t, Contains(v1, dict{"created": tm.Add(24 * time.Hour).Format(time.RFC3339Nano)}, ParseTimes()))
+}
+
+type money struct {
+	cents int64
+}
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(m.cents, 10) + `c"`), nil
+}
+
+type label interface {
+	Label() string
+}
+
+type color int
+
+func (c color) Label() string {
+	return [...]string{"red", "green"}[c]
+}
+
+func TestRegisterNormalizer(t *testing.T) {
+	n, err := Normalize(money{cents: 150})
+	require.NoError(t, err)
+	assert.Equal(t, "150c", n)
+
+	RegisterNormalizer(reflect.TypeOf(money{}), func(v interface{}) (interface{}, error) {
+		return float64(v.(money).cents) / 100, nil
+	})
+	t.Cleanup(func() { RegisterNormalizer(reflect.TypeOf(money{}), nil) })
+
+	// takes precedence over MarshalJSON, and applies to nested values
+	n, err = Normalize(dict{"prices": []money{{cents: 150}, {cents: 5}}})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"prices": []interface{}{1.5, 0.05}}, n)
+	assert.True(t, Contains(dict{"price": money{cents: 150}}, dict{"price": 1.5}))
+
+	// matched by assignability
+	RegisterNormalizer(reflect.TypeOf((*label)(nil)).Elem(), func(v interface{}) (interface{}, error) {
+		return v.(label).Label(), nil
+	})
+	t.Cleanup(func() { RegisterNormalizer(reflect.TypeOf((*label)(nil)).Elem(), nil) })
+	n, err = Normalize(dict{"color": color(1)})
+	require.NoError(t, err)
+	assert.Equal(t, dict{"color": "green"}, n)
+
+	// the exact type takes precedence
+	RegisterNormalizer(reflect.TypeOf(color(0)), func(v interface{}) (interface{}, error) {
+		return int(v.(color)), nil
+	})
+	n, err = Normalize(color(1))
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, n)
+
+	// removed
+	RegisterNormalizer(reflect.TypeOf(color(0)), nil)
+	n, err = Normalize(color(1))
+	require.NoError(t, err)
+	assert.Equal(t, "green", n)
+
+	// errors
+	RegisterNormalizer(reflect.TypeOf(color(0)), func(v interface{}) (interface{}, error) {
+		return nil, errors.New("bad color")
+	})
+	_, err = Normalize(dict{"color": color(1)})
+	assert.EqualError(t, err, "error normalizing at color: bad color")
+	RegisterNormalizer(reflect.TypeOf(color(0)), nil)
+}
@@ -0,0 +1,37 @@
+package maps
+
+// Similarity returns a score from 0 to 1 of how similar v1 and v2 are.
+//
+// Both values are flattened into leaf paths and values, as with Flatten.  The score is the
+// Jaccard index of the two sets of path/value pairs: the number of pairs in both (paths present
+// in both, with equivalent values), divided by the number of distinct pairs in either:
+//
+//	Similarity({"a":1,"b":2}, {"a":1,"b":3,"c":4}) // 1 / 4: a=1 matches; b=2, b=3, and c=4 don't
+//
+// Leaf values are compared with Equivalent, using opts, so options like ParseTimes and
+// TruncateTimes can loosen the comparison.  Equivalent values always score 1, and
+// values with no leaves in common score 0.
+//
+// Slices are flattened by index, so slice order matters: [1,2] and [2,1] score 0.
+// Empty maps and slices are leaves, so {"a":{}} and {"a":[]} score 0.  Scalars are
+// compared as a single leaf.  Returns an error if either value can't be flattened.
+func Similarity(v1, v2 interface{}, opts ...ContainsOption) (float64, error) {
+	f1, err := Flatten(v1)
+	if err != nil {
+		return 0, err
+	}
+	f2, err := Flatten(v2)
+	if err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for path, leaf1 := range f1 {
+		if leaf2, ok := f2[path]; ok && Equivalent(leaf1, leaf2, opts...) {
+			matched++
+		}
+	}
+	// f1 and f2 can't both be empty: a value with no leaves flattens to a single
+	// empty key.
+	return float64(matched) / float64(len(f1)+len(f2)-matched), nil
+}
@@ -0,0 +1,50 @@
+package maps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		name     string
+		v1, v2   interface{}
+		opts     []ContainsOption
+		expected float64
+	}{
+		{name: "equal", v1: dict{"a": 1, "b": dict{"c": "x"}}, v2: dict{"a": 1, "b": dict{"c": "x"}}, expected: 1},
+		{name: "disjoint", v1: dict{"a": 1}, v2: dict{"b": 1}, expected: 0},
+		{name: "overlap", v1: dict{"a": 1, "b": 2}, v2: dict{"a": 1, "b": 3, "c": 4}, expected: 1.0 / 4},
+		{name: "nested", v1: dict{"a": dict{"b": 1, "c": 2}}, v2: dict{"a": dict{"b": 1}}, expected: 1.0 / 2},
+		{name: "slices by index", v1: dict{"a": []int{1, 2, 3}}, v2: dict{"a": []int{1, 3}}, expected: 1.0 / 4},
+		{name: "slice order", v1: []int{1, 2}, v2: []int{2, 1}, expected: 0},
+		{name: "scalars", v1: "red", v2: "red", expected: 1},
+		{name: "different scalars", v1: "red", v2: "blue", expected: 0},
+		{name: "scalar and map", v1: "red", v2: dict{"a": "red"}, expected: 0},
+		{name: "empty", v1: dict{}, v2: dict{}, expected: 1},
+		{name: "empty containers", v1: dict{"a": dict{}}, v2: dict{"a": []int{}}, expected: 0},
+		{
+			name:     "options",
+			v1:       dict{"created": "2020-01-01T10:00:00Z", "b": "red"},
+			v2:       dict{"created": "2020-01-01T10:00:00.5Z", "b": "red"},
+			opts:     []ContainsOption{ParseTimes(), TruncateTimes(time.Second)},
+			expected: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score, err := Similarity(test.v1, test.v2, test.opts...)
+			require.NoError(t, err)
+			assert.InDelta(t, test.expected, score, 0.0001)
+			// symmetric
+			score, err = Similarity(test.v2, test.v1, test.opts...)
+			require.NoError(t, err)
+			assert.InDelta(t, test.expected, score, 0.0001)
+		})
+	}
+
+	_, err := Similarity(dict{"a": make(chan int)}, dict{})
+	assert.Error(t, err)
+}
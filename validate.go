@@ -0,0 +1,142 @@
+package maps
+
+import (
+	"fmt"
+	"github.com/ansel1/merry"
+	"sort"
+)
+
+// ValidationError describes one way a value failed to conform to a schema.
+// See Validate.
+type ValidationError struct {
+	Path    Path
+	Message string
+}
+
+// Error implements the error interface.  It returns the path and message, like:
+//
+//	resource.tags[1]: expected string, got number
+func (e ValidationError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return e.Path.String() + ": " + e.Message
+}
+
+type optional struct {
+	schema interface{}
+}
+
+// Optional marks a key in a Validate schema as optional.  If the key is
+// present, its value must still conform to schema.
+func Optional(schema interface{}) interface{} {
+	return optional{schema: schema}
+}
+
+// Validate checks v against schema, and returns all the places where v
+// doesn't conform.  If v conforms, the result is empty.
+//
+// The schema grammar is:
+//
+//   - A map[string]interface{} requires a map.  Each key in the schema is required
+//     to be present in v, and its value must conform to the key's schema.  Wrap the key's
+//     schema in Optional() to allow the key to be absent.  Keys in v which aren't in
+//     the schema are allowed.
+//   - A []interface{} with a single element requires a slice.  Every element of the slice
+//     must conform to that element's schema.
+//   - A TypeMatcher, like IsString or IsNumber, requires a value of that type.
+//   - Any other value is compared to v with Equivalent, so literal values and
+//     matchers like NumberBetween may be used too.
+//
+// For example:
+//
+//	schema := map[string]interface{}{
+//	  "name": IsString,
+//	  "size": NumberBetween(1, 10),
+//	  "tags": []interface{}{IsString},
+//	  "labels": Optional(map[string]interface{}{
+//	    "region": IsString,
+//	  }),
+//	}
+//	errs, err := Validate(v, schema)
+//
+// v is normalized first.  An error is returned if v can't be normalized, or if the
+// schema is invalid.
+func Validate(v interface{}, schema map[string]interface{}) ([]ValidationError, error) {
+	nv, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	var errs []ValidationError
+	if err := validate(nv, schema, nil, &errs); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func validate(v, schema interface{}, path Path, errs *[]ValidationError) error {
+	addErr := func(msg string, args ...interface{}) {
+		*errs = append(*errs, ValidationError{Path: path, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	switch s := schema.(type) {
+	case optional:
+		return validate(v, s.schema, path, errs)
+	case map[string]interface{}:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			addErr("expected %v, got %v", IsMap, jsonType(v))
+			return nil
+		}
+		keys := make([]string, 0, len(s))
+		for key := range s {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			keySchema := s[key]
+			opt, isOptional := keySchema.(optional)
+			if isOptional {
+				keySchema = opt.schema
+			}
+			keyPath := append(path[:len(path):len(path)], key)
+			val, present := m[key]
+			if !present {
+				if !isOptional {
+					*errs = append(*errs, ValidationError{Path: keyPath, Message: "required key is missing"})
+				}
+				continue
+			}
+			if err := validate(val, keySchema, keyPath, errs); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(s) != 1 {
+			return merry.Errorf("invalid schema at %v: slice schemas must have exactly one element", path)
+		}
+		sl, ok := v.([]interface{})
+		if !ok {
+			addErr("expected %v, got %v", IsSlice, jsonType(v))
+			return nil
+		}
+		for i, el := range sl {
+			if err := validate(el, s[0], append(path[:len(path):len(path)], i), errs); err != nil {
+				return err
+			}
+		}
+	case TypeMatcher:
+		if t := jsonType(v); t != s {
+			addErr("expected %v, got %v", s, t)
+		}
+	default:
+		m := EquivalentMatch(v, s)
+		if m.Error != nil {
+			return merry.Prependf(m.Error, "invalid schema at %v", path)
+		}
+		if !m.Matches {
+			addErr("expected %v, got %v", s, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package maps
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	schema := dict{
+		"name": IsString,
+		"size": NumberBetween(1, 10),
+		"kind": "widget",
+		"tags": []interface{}{IsString},
+		"labels": Optional(dict{
+			"region": IsString,
+			"zone":   Optional(IsNumber),
+		}),
+		"parts": []interface{}{dict{
+			"id":     IsNumber,
+			"active": IsBool,
+		}},
+	}
+
+	tests := []struct {
+		name     string
+		v        interface{}
+		expected []string
+	}{
+		{
+			name: "valid",
+			v: dict{
+				"name":  "bob",
+				"size":  5,
+				"kind":  "widget",
+				"tags":  []string{"red", "green"},
+				"parts": []interface{}{dict{"id": 1, "active": true}},
+				"extra": "allowed",
+			},
+		},
+		{
+			name: "valid optional",
+			v: dict{
+				"name":   "bob",
+				"size":   5,
+				"kind":   "widget",
+				"tags":   []string{},
+				"parts":  []interface{}{},
+				"labels": dict{"region": "east", "zone": 2},
+			},
+		},
+		{
+			name: "missing required",
+			v:    dict{"name": "bob", "labels": dict{}},
+			expected: []string{
+				"kind: required key is missing",
+				"labels.region: required key is missing",
+				"parts: required key is missing",
+				"size: required key is missing",
+				"tags: required key is missing",
+			},
+		},
+		{
+			name: "wrong types",
+			v: dict{
+				"name":   5,
+				"size":   20,
+				"kind":   "gadget",
+				"tags":   []interface{}{"red", 5, nil},
+				"parts":  dict{},
+				"labels": dict{"region": "east", "zone": "a"},
+			},
+			expected: []string{
+				"kind: expected widget, got gadget",
+				"labels.zone: expected number, got string",
+				"name: expected string, got number",
+				"parts: expected array, got object",
+				"size: expected [1, 10], got 20",
+				"tags[1]: expected string, got number",
+				"tags[2]: expected string, got null",
+			},
+		},
+		{
+			name: "nested slice",
+			v: dict{
+				"name":  "bob",
+				"size":  5,
+				"kind":  "widget",
+				"tags":  []string{},
+				"parts": []interface{}{dict{"id": 1, "active": true}, dict{"id": "2"}},
+			},
+			expected: []string{
+				"parts[1].active: required key is missing",
+				"parts[1].id: expected number, got string",
+			},
+		},
+		{
+			name:     "not a map",
+			v:        []string{"red"},
+			expected: []string{"expected object, got array"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs, err := Validate(test.v, schema)
+			require.NoError(t, err)
+			var msgs []string
+			for _, e := range errs {
+				msgs = append(msgs, e.Error())
+			}
+			assert.Equal(t, test.expected, msgs)
+		})
+	}
+
+	errs, err := Validate(dict{"tags": []interface{}{5}}, schema)
+	require.NoError(t, err)
+	assert.Contains(t, errs, ValidationError{Path: Path{"tags", 0}, Message: "expected string, got number"})
+
+	_, err = Validate(dict{"tags": []string{}}, dict{"tags": []interface{}{IsString, IsNumber}})
+	assert.EqualError(t, err, "invalid schema at tags: slice schemas must have exactly one element")
+
+	_, err = Validate(dict{"color": make(chan string)}, schema)
+	assert.Error(t, err)
+
+	// v isn't modified
+	v := dict{"name": "web", "size": 5, "tags": []interface{}{"a"}}
+	_, err = Validate(v, schema)
+	require.NoError(t, err)
+	assert.Equal(t, dict{"name": "web", "size": 5, "tags": []interface{}{"a"}}, v)
+}
+
+func TestTypeMatcher(t *testing.T) {
+	v1 := dict{"size": 5, "color": "red", "active": true, "tags": []string{"red"}, "labels": dict{}, "owner": nil}
+	assert.True(t, Contains(v1, dict{"size": IsNumber, "color": IsString, "active": IsBool, "tags": IsSlice, "labels": IsMap, "owner": IsNull}))
+	assert.False(t, Contains(v1, dict{"size": IsString}))
+	assert.True(t, Contains(dict{"createdAt": "2017-03-03T14:08:30Z"}, dict{"createdAt": IsString}, ParseTimes()))
+
+	var trace string
+	Contains(v1, dict{"size": IsString}, Trace(&trace))
+	assert.Equal(t, `v1 is a number, not a string
+v1.size -> 5
+v2.size -> "string"`, trace)
+}
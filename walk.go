@@ -0,0 +1,58 @@
+package maps
+
+import (
+	"github.com/ansel1/merry"
+)
+
+// Walk visits every value in v, depth-first, and calls fn with the path to each value,
+// and the value itself.  Maps and slices are passed to fn before their children.  Map
+// keys are visited in sorted order, and slice elements in index order.  The root is
+// visited first, with an empty path:
+//
+//	Walk({"a":[1,2],"b":"red"}, fn)
+//	// fn([], {"a":[1,2],"b":"red"})
+//	// fn(["a"], [1,2])
+//	// fn(["a", 0], 1)
+//	// fn(["a", 1], 2)
+//	// fn(["b"], "red")
+//
+// Each value is normalized, with the Marshal option, before it's passed to fn, but v is
+// not copied or modified.  fn may keep the paths it's passed; each is a new slice.
+//
+// If fn returns ErrStop, Walk stops, and returns nil.  Any other error stops the walk,
+// and is returned.
+func Walk(v interface{}, fn func(path Path, value interface{}) error) error {
+	err := walk(v, nil, fn, &NormalizeOptions{Marshal: true})
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+func walk(v interface{}, path Path, fn func(path Path, value interface{}) error, opts *NormalizeOptions) error {
+	v, err := normalize(v, opts)
+	if err != nil {
+		if len(path) > 0 {
+			return merry.Prependf(err, "normalizing %v", path)
+		}
+		return err
+	}
+	if err := fn(path, v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(t) {
+			if err := walk(t[key], append(path[:len(path):len(path)], key), fn, opts); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			if err := walk(value, append(path[:len(path):len(path)], i), fn, opts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package maps
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	type visit struct {
+		path  string
+		value interface{}
+	}
+	var visits []visit
+	record := func(path Path, value interface{}) error {
+		visits = append(visits, visit{path.String(), value})
+		return nil
+	}
+
+	v := dict{"b": "red", "a": []int{1, 2}, "c": dict{"d": true}}
+	require.NoError(t, Walk(v, record))
+	assert.Equal(t, []visit{
+		{"", dict{"b": "red", "a": []int{1, 2}, "c": dict{"d": true}}},
+		{"a", []interface{}{1, 2}},
+		{"a[0]", 1.0},
+		{"a[1]", 2.0},
+		{"b", "red"},
+		{"c", dict{"d": true}},
+		{"c.d", true},
+	}, visits)
+
+	// v is not modified
+	assert.Equal(t, dict{"b": "red", "a": []int{1, 2}, "c": dict{"d": true}}, v)
+
+	// structs are marshaled
+	visits = nil
+	require.NoError(t, Walk(struct {
+		Name string `json:"name"`
+	}{"bob"}, record))
+	assert.Equal(t, []visit{{"", dict{"name": "bob"}}, {"name", "bob"}}, visits)
+
+	// ErrStop ends the walk with no error
+	visits = nil
+	err := Walk(v, func(path Path, value interface{}) error {
+		visits = append(visits, visit{path.String(), value})
+		if path.String() == "a[0]" {
+			return ErrStop
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, visits, 3)
+
+	// other errors are returned
+	boom := errors.New("boom")
+	count := 0
+	err = Walk(v, func(path Path, value interface{}) error {
+		count++
+		if path.String() == "b" {
+			return boom
+		}
+		return nil
+	})
+	assert.Equal(t, boom, err)
+	assert.Equal(t, 5, count)
+
+	// paths can be kept
+	var paths []Path
+	require.NoError(t, Walk(dict{"a": dict{"b": 1, "c": 2}}, func(path Path, value interface{}) error {
+		paths = append(paths, path)
+		return nil
+	}))
+	assert.Equal(t, []Path{nil, {"a"}, {"a", "b"}, {"a", "c"}}, paths)
+
+	err = Walk(dict{"a": make(chan int)}, record)
+	assert.ErrorContains(t, err, "normalizing a")
+}